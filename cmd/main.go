@@ -1,66 +1,365 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"secure-messenger/config"
 	"secure-messenger/internal/handlers"
-	"secure-messenger/internal/models"
+	"secure-messenger/internal/metrics"
+	"secure-messenger/internal/migrations"
+	"secure-messenger/internal/realtime"
 	"secure-messenger/internal/repository"
 	"secure-messenger/internal/services"
+	"secure-messenger/internal/version"
+	"secure-messenger/pkg/encryption"
+	"secure-messenger/pkg/lifecycle"
+	"secure-messenger/pkg/logging"
+	"secure-messenger/pkg/push"
+	"secure-messenger/pkg/storage"
+	"secure-messenger/pkg/tracing"
 )
 
 func main() {
-	config.InitDB()
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	// Стандартный log и отладочный вывод gin идут через тот же логгер
+	slog.SetDefault(logger)
+	gin.DebugPrintFunc = func(format string, values ...interface{}) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(strings.TrimPrefix(format, "[WARNING] "), values...)))
+	}
+	gin.DebugPrintRouteFunc = func(method, path, handler string, _ int) {
+		slog.Debug("route registered", "method", method, "path", path, "handler", handler)
+	}
+
+	build := version.Get()
+	slog.Info("starting secure-messenger", "version", build.Version, "commit", build.Commit)
 
-	// ✅ Автоматическая миграция таблиц
-	if err := config.DB.AutoMigrate(
-		&models.User{},
-		&models.RefreshToken{},
-		&models.Message{},
-	); err != nil {
-		log.Fatalf("Migration failed: %v", err)
+	db, err := config.OpenDB(cfg.DB)
+	if err != nil {
+		fatal("failed to connect to database", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("failed to connect to database", err)
+	}
+	slog.Info("database connected", "driver", cfg.DB.Driver)
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		fatal("migrations init failed", err)
+	}
+
+	// secure-messenger migrate up|down [N]|status — управление схемой базы
+	if len(args) > 0 && args[0] == "migrate" {
+		err := runMigrate(context.Background(), migrator, args[1:])
+		sqlDB.Close()
+		if err != nil {
+			fatal("migrate failed", err)
+		}
+		return
+	}
+	if cfg.DB.MigrateOnStart {
+		count, err := migrator.Up(context.Background())
+		if err != nil {
+			fatal("migration failed", err)
+		}
+		if count > 0 {
+			slog.Info("migrations applied", "count", count)
+		}
+	} else if err := migrator.Check(context.Background()); err != nil {
+		fatal("database schema is not up to date, run secure-messenger migrate up", err)
 	}
 
-	r := gin.Default()
+	tokens := services.NewTokenService(cfg.Security.JWTSecret, cfg.Security.AccessTokenTTL, cfg.Security.RefreshTokenTTL)
+	aesKey := []byte(cfg.Security.AESKey)
+
+	appMetrics := metrics.New()
+	appMetrics.RegisterDB(sqlDB, cfg.DB.Driver)
+	tokens.Metrics = appMetrics
+
+	r := gin.New()
+	r.Use(
+		handlers.TracingMiddleware(),
+		handlers.RequestIDMiddleware(),
+		handlers.AccessLogMiddleware(logger),
+		handlers.RecoveryMiddleware(logger),
+		handlers.MetricsMiddleware(appMetrics),
+		handlers.LocaleMiddleware(db),
+		handlers.ErrorMiddleware(),
+	)
+	r.NoRoute(handlers.NoRoute)
+
+	// ===== Probes =====
+	health := services.NewHealthService(cfg.Server.ReadinessTimeout)
+	healthHandler := handlers.NewHealthHandler(health)
+	r.GET("/healthz", healthHandler.Healthz)
+	r.GET("/readyz", healthHandler.Readyz)
+	r.GET("/version", healthHandler.Version)
+	metricsHandler := handlers.MetricsHandler(appMetrics, cfg.Metrics.Token)
+	switch {
+	case cfg.Metrics.Addr != "":
+		// отдельный сервер регистрируется в жизненном цикле ниже
+	case cfg.Metrics.Token != "":
+		r.GET("/metrics", gin.WrapH(metricsHandler))
+	default:
+		slog.Warn("metrics endpoint disabled: set METRICS_ADDR or METRICS_TOKEN to expose /metrics")
+	}
 
 	// ===== API Group =====
 	api := r.Group("/api")
 
 	// --- Auth Endpoints ---
-	api.POST("/register", handlers.RegisterWithDB(config.DB))
-	api.POST("/login", handlers.Login)
-	api.POST("/refresh", handlers.Refresh)
+	api.POST("/register", handlers.RegisterWithDB(db))
+	api.POST("/login", handlers.LoginWithDB(db, tokens))
+	api.POST("/refresh", handlers.RefreshWithDB(db, tokens))
 
 	// --- Protected routes ---
-	api.GET("/profile", handlers.AuthMiddleware(""), handlers.ProfileHandler(config.DB))
+	api.GET("/profile", handlers.AuthMiddleware(tokens, ""), handlers.ProfileHandler(db))
+	api.PATCH("/profile/settings", handlers.AuthMiddleware(tokens, ""), handlers.UpdateSettingsWithDB(db))
 
 	// --- Admin routes ---
 	admin := api.Group("/admin")
-	admin.Use(handlers.AuthMiddleware("admin"))
+	admin.Use(handlers.AuthMiddleware(tokens, "admin"))
 	{
-		admin.GET("/users", handlers.GetAllUsersWithDB(config.DB))
-		admin.DELETE("/users/:id", handlers.DeleteUserWithDB(config.DB))
-		admin.PUT("/users/:id", handlers.UpdateUserWithDB(config.DB))
+		admin.GET("/users", handlers.GetAllUsersWithDB(db))
+		admin.DELETE("/users/:id", handlers.DeleteUserWithDB(db))
+		admin.PUT("/users/:id", handlers.UpdateUserWithDB(db))
 	}
 
 	// ===== Messaging Dependencies =====
-	messageRepo := repository.NewMessageRepository(config.DB)
-	messageService := services.NewMessageService(messageRepo, config.AESSecretKey) // ✅ передаём ключ
+	hub := realtime.NewHub()
+	messageRepo := repository.NewMessageRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	conversationRepo := repository.NewConversationRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	contactRepo := repository.NewContactRepository(db)
+	contactService := services.NewContactService(contactRepo, userRepo)
+	scheduledRepo := repository.NewScheduledMessageRepository(db)
+	messageService := services.NewMessageService(messageRepo, userRepo, conversationRepo, attachmentRepo, contactService, scheduledRepo, aesKey) // ✅ передаём ключ
+	messageService.EditWindow = cfg.Messages.EditWindow
+	messageService.DeleteWindow = cfg.Messages.DeleteWindow
+	messageService.MaxDistinctReactions = cfg.Messages.MaxDistinctReactions
+	messageService.MaxPins = cfg.Messages.MaxPins
+	messageService.Hub = hub
+	messageService.Metrics = appMetrics
+	appMetrics.RegisterGauge("realtime_connections", "Open realtime event streams.", func() float64 {
+		return float64(hub.ConnectionCount())
+	})
+	var pushProvider services.PushProvider
+	if cfg.Push.WebhookURL != "" {
+		pushProvider = push.NewWebhookProvider(cfg.Push.WebhookURL, []byte(cfg.Push.WebhookSecret))
+	}
+	pushService := services.NewPushService(repository.NewPushRepository(db), userRepo, conversationRepo, hub, pushProvider, aesKey)
+	pushService.MaxAttempts = cfg.Push.MaxAttempts
+	messageService.Push = pushService
+	if cfg.Security.SearchIndexKey != "" {
+		messageService.Index = encryption.NewBlindIndex([]byte(cfg.Security.SearchIndexKey))
+	}
+
+	// secure-messenger reindex — пересобрать поисковый индекс для уже сохранённых сообщений
+	if len(args) > 0 && args[0] == "reindex" {
+		count, err := messageService.RebuildSearchIndex(context.Background(), cfg.Workers.BatchSize)
+		if err != nil {
+			fatal("reindex failed", err)
+		}
+		slog.Info("search index rebuilt", "messages", count)
+		sqlDB.Close()
+		return
+	}
 	messageHandler := handlers.NewMessageHandler(messageService)
+	conversationHandler := handlers.NewConversationHandler(services.NewConversationService(conversationRepo, userRepo))
+	contactHandler := handlers.NewContactHandler(contactService)
+	userHandler := handlers.NewUserHandler(services.NewUserService(userRepo, contactRepo, attachmentRepo))
+	presenceService := services.NewPresenceService(userRepo, contactService, hub)
+	presenceService.AwayAfter = cfg.Presence.AwayAfter
+	presenceService.TypingTimeout = cfg.Presence.TypingTimeout
+	presenceHandler := handlers.NewPresenceHandler(presenceService)
+	pushHandler := handlers.NewPushHandler(pushService)
+
+	attachmentStorage, err := storage.NewLocalStorage(cfg.Attachments.Dir)
+	if err != nil {
+		fatal("attachment storage init failed", err)
+	}
+	attachmentService := services.NewAttachmentService(attachmentRepo, messageRepo, attachmentStorage, aesKey)
+	attachmentService.MaxSize = cfg.Attachments.MaxSize
+	if len(cfg.Attachments.AllowedTypes) > 0 {
+		attachmentService.AllowedTypes = cfg.Attachments.AllowedTypes
+	}
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
 
 	// --- Messaging Endpoints ---
-	api.Use(handlers.AuthMiddleware("")) // 🔐 Require auth for message routes
+	api.Use(handlers.AuthMiddleware(tokens, ""), handlers.ActivityMiddleware(presenceService)) // 🔐 Require auth for message routes
 	{
+		api.GET("/events", handlers.EventsHandler(presenceService))
+
 		api.POST("/messages/send", messageHandler.SendMessage)
 		api.GET("/messages", messageHandler.GetMessages)
+		api.GET("/messages/search", messageHandler.SearchMessages)
+		api.GET("/messages/starred", messageHandler.ListStarred)
+		api.GET("/messages/scheduled", messageHandler.ListScheduled)
+		api.PATCH("/messages/scheduled/:id", messageHandler.UpdateScheduled)
+		api.DELETE("/messages/scheduled/:id", messageHandler.CancelScheduled)
+		api.POST("/messages/read", messageHandler.MarkRead)
+		api.PATCH("/messages/:id", messageHandler.EditMessage)
+		api.GET("/messages/:id/history", messageHandler.GetHistory)
+		api.GET("/messages/:id/thread", messageHandler.GetThread)
+		api.POST("/messages/:id/reactions", messageHandler.AddReaction)
+		api.DELETE("/messages/:id/reactions/:emoji", messageHandler.RemoveReaction)
+		api.POST("/messages/:id/pin", messageHandler.PinMessage)
+		api.DELETE("/messages/:id/pin", messageHandler.UnpinMessage)
+		api.POST("/messages/:id/star", messageHandler.StarMessage)
+		api.DELETE("/messages/:id/star", messageHandler.UnstarMessage)
 		api.DELETE("/messages/:id", messageHandler.DeleteMessage)
+
+		api.GET("/conversations/:peer_id/settings", conversationHandler.GetSettings)
+		api.PUT("/conversations/:peer_id/ttl", conversationHandler.SetTTL)
+		api.GET("/conversations/:peer_id/pins", messageHandler.ListPins)
+		api.POST("/conversations/:peer_id/typing", presenceHandler.SetTyping)
+		api.PUT("/conversations/:peer_id/mute", conversationHandler.Mute)
+		api.DELETE("/conversations/:peer_id/mute", conversationHandler.Unmute)
+
+		api.GET("/devices", pushHandler.ListDevices)
+		api.POST("/devices", pushHandler.RegisterDevice)
+		api.DELETE("/devices/:id", pushHandler.UnregisterDevice)
+
+		api.GET("/contacts", contactHandler.ListContacts)
+		api.POST("/contacts", contactHandler.AddContact)
+		api.DELETE("/contacts/:user_id", contactHandler.RemoveContact)
+		api.GET("/blocks", contactHandler.ListBlocked)
+		api.POST("/blocks", contactHandler.Block)
+		api.DELETE("/blocks/:user_id", contactHandler.Unblock)
+		api.GET("/message-requests", contactHandler.ListRequests)
+		api.POST("/message-requests/:id/accept", contactHandler.AcceptRequest)
+		api.POST("/message-requests/:id/decline", contactHandler.DeclineRequest)
+
+		api.GET("/users/search", userHandler.SearchUsers)
+		api.GET("/users/:user_id", userHandler.GetProfile)
+		api.GET("/users/:user_id/presence", presenceHandler.GetPresence)
+		api.PATCH("/profile", userHandler.UpdateProfile)
+
+		api.POST("/attachments", attachmentHandler.CreateUpload)
+		api.GET("/attachments/:id", attachmentHandler.GetAttachment)
+		api.PUT("/attachments/:id/chunks/:index", attachmentHandler.UploadChunk)
+		api.GET("/attachments/:id/content", attachmentHandler.Download)
+	}
+
+	// ===== Tracing =====
+	// Только для сервера: подкоманды выше трассы не пишут
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:       cfg.Tracing.Exporter,
+		Endpoint:       cfg.Tracing.Endpoint,
+		ServiceName:    cfg.Tracing.ServiceName,
+		ServiceVersion: build.Version,
+		SampleRatio:    cfg.Tracing.SampleRatio,
+		Writer:         os.Stdout,
+	})
+	if err != nil {
+		fatal("tracing init failed", err)
 	}
 
-	// Запуск
-	fmt.Println("Server running at :8081")
-	_ = r.Run(":8081")
+	// ===== Lifecycle =====
+	// Компоненты запускаются сверху вниз и останавливаются снизу вверх: сначала закрываются
+	// потоки событий, затем сервер дожидается активных запросов, затем останавливаются
+	// фоновые задачи и последним закрывается пул соединений с базой.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app := lifecycle.NewManager(cfg.Server.ShutdownTimeout)
+	app.Add("database", nil, func(context.Context) error { return sqlDB.Close() })
+	// После всех источников спанов: отправляет накопленное
+	app.Add("tracing", nil, shutdownTracing)
+	if cfg.Metrics.Addr != "" {
+		// Останавливается после основного сервера, чтобы метрики снимались до конца остановки
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metricsHandler)
+		metricsSrv := &http.Server{
+			Addr:              cfg.Metrics.Addr,
+			Handler:           mux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		app.AddHTTPServer("metrics server", metricsSrv, func(err error) {
+			slog.Error("metrics server stopped", "error", err)
+			stop()
+		})
+	}
+
+	workers := map[string]services.Runner{}
+	addWorker := func(name string, w interface {
+		lifecycle.Worker
+		services.Runner
+	}) {
+		app.AddWorker(name, w)
+		workers[name] = w
+	}
+	addWorker("expiry reaper", services.NewExpiryReaper(messageRepo, cfg.Workers.ReaperInterval, cfg.Workers.BatchSize))
+	addWorker("attachment gc", services.NewAttachmentGC(attachmentRepo, attachmentStorage, cfg.Workers.ReaperInterval, cfg.Attachments.UploadTTL, cfg.Workers.BatchSize))
+	addWorker("message scheduler", services.NewMessageScheduler(messageService, cfg.Workers.SchedulerInterval, cfg.Workers.BatchSize))
+	addWorker("presence sweeper", services.NewPresenceSweeper(presenceService, cfg.Workers.ReaperInterval))
+	if pushProvider != nil {
+		addWorker("push dispatcher", services.NewPushDispatcher(pushService, cfg.Push.Interval, cfg.Workers.BatchSize))
+	}
+
+	health.Add("database", services.DatabaseCheck(sqlDB))
+	health.Add("migrations", migrator.Check)
+	health.Add("keys", services.KeysCheck(aesKey, tokens))
+	health.Add("workers", services.WorkersCheck(workers))
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr(),
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	app.AddHTTPServer("http server", srv, func(err error) {
+		slog.Error("server stopped", "error", err)
+		stop()
+	})
+	app.Add("realtime hub", nil, func(context.Context) error {
+		hub.Close()
+		return nil
+	})
+	// Останавливается первой: /readyz начинает отвечать 503, и балансировщик
+	// успевает убрать сервер из ротации до закрытия соединений
+	app.Add("readiness", nil, func(ctx context.Context) error {
+		health.SetDraining()
+		select {
+		case <-time.After(cfg.Server.ShutdownDelay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	if err := app.Run(ctx); err != nil {
+		fatal("shutdown failed", err)
+	}
+	slog.Info("server stopped")
+}
+
+// fatal пишет ошибку запуска в лог и завершает процесс
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
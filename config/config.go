@@ -1,53 +1,449 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
-var (
-	DB           *gorm.DB
-	JWTSecret    string
-	AESSecretKey []byte // ✅ просто объявим, инициализируем позже
-)
+// Config — все настройки сервера. Источники в порядке возрастания приоритета:
+// значения по умолчанию, файл YAML/TOML (-config или CONFIG_FILE), переменные
+// окружения (в том числе из необязательного .env) и флаги командной строки.
+//
+// Поле с тегом env задаётся переменной окружения с этим именем или флагом
+// с тем же именем в нижнем регистре через дефис: DB_HOST → -db-host.
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	DB          DBConfig          `yaml:"db"`
+	Security    SecurityConfig    `yaml:"security"`
+	Messages    MessagesConfig    `yaml:"messages"`
+	Workers     WorkersConfig     `yaml:"workers"`
+	Attachments AttachmentsConfig `yaml:"attachments"`
+	Presence    PresenceConfig    `yaml:"presence"`
+	Push        PushConfig        `yaml:"push"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Log         LogConfig         `yaml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+}
 
-func InitDB() {
-	// Загружаем переменные из .env
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("No .env file found")
+type ServerConfig struct {
+	Port              int           `yaml:"port" env:"PORT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"` // потоки событий и скачивание вложений его снимают
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`  // сколько ждать остановки каждого компонента
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" env:"SERVER_SHUTDOWN_DELAY"`      // сколько отвечать неготовностью до закрытия соединений
+	ReadinessTimeout  time.Duration `yaml:"readiness_timeout" env:"READINESS_CHECK_TIMEOUT"` // на каждую проверку /readyz
+}
+
+// Addr — адрес, на котором слушает HTTP-сервер
+func (c ServerConfig) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+type DBConfig struct {
+	Driver string `yaml:"driver" env:"DB_DRIVER"` // postgres или sqlite
+	DSN    string `yaml:"dsn" env:"DB_DSN"`       // готовая строка подключения Postgres; важнее отдельных полей
+	Path   string `yaml:"path" env:"DB_PATH"`     // файл SQLite или ":memory:"
+
+	Host           string        `yaml:"host" env:"DB_HOST"`
+	Port           int           `yaml:"port" env:"DB_PORT"`
+	User           string        `yaml:"user" env:"DB_USER"`
+	Password       string        `yaml:"password" env:"DB_PASSWORD"`
+	Name           string        `yaml:"name" env:"DB_NAME"`
+	SSLMode        string        `yaml:"sslmode" env:"DB_SSLMODE"`
+	SSLRootCert    string        `yaml:"sslrootcert" env:"DB_SSLROOTCERT"`
+	SSLCert        string        `yaml:"sslcert" env:"DB_SSLCERT"`
+	SSLKey         string        `yaml:"sslkey" env:"DB_SSLKEY"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"` // 0 — без ограничения
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`   // 0 — без ограничения
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"` // 0 — без ограничения
+
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"DB_MIGRATE_ON_START"` // false — сервер не стартует, пока есть неприменённые миграции
+}
+
+type SecurityConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret" env:"JWT_SECRET"`
+	AccessTokenTTL  time.Duration `yaml:"token_expiry" env:"TOKEN_EXPIRY"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_expiry" env:"REFRESH_TOKEN_EXPIRY"`
+	AESKey          string        `yaml:"aes_secret_key" env:"AES_SECRET_KEY"`
+	SearchIndexKey  string        `yaml:"search_index_key" env:"SEARCH_INDEX_KEY"` // пусто — выводится из AES-ключа
+}
+
+type MessagesConfig struct {
+	EditWindow           time.Duration `yaml:"edit_window" env:"MESSAGE_EDIT_WINDOW"`     // 0 — без ограничения
+	DeleteWindow         time.Duration `yaml:"delete_window" env:"MESSAGE_DELETE_WINDOW"` // 0 — без ограничения
+	MaxDistinctReactions int           `yaml:"max_distinct_reactions" env:"REACTIONS_MAX_DISTINCT"`
+	MaxPins              int           `yaml:"max_pins" env:"PINS_MAX_PER_CONVERSATION"`
+}
+
+type WorkersConfig struct {
+	ReaperInterval    time.Duration `yaml:"reaper_interval" env:"REAPER_INTERVAL"`
+	BatchSize         int           `yaml:"batch_size" env:"REAPER_BATCH_SIZE"`
+	SchedulerInterval time.Duration `yaml:"scheduler_interval" env:"SCHEDULER_INTERVAL"`
+}
+
+type AttachmentsConfig struct {
+	Dir          string        `yaml:"dir" env:"ATTACHMENT_DIR"`
+	MaxSize      int64         `yaml:"max_size" env:"ATTACHMENT_MAX_SIZE"`
+	AllowedTypes []string      `yaml:"allowed_types" env:"ATTACHMENT_ALLOWED_TYPES"` // пусто — список по умолчанию
+	UploadTTL    time.Duration `yaml:"upload_ttl" env:"ATTACHMENT_UPLOAD_TTL"`
+}
+
+type PresenceConfig struct {
+	AwayAfter     time.Duration `yaml:"away_after" env:"PRESENCE_AWAY_AFTER"`
+	TypingTimeout time.Duration `yaml:"typing_timeout" env:"TYPING_TIMEOUT"`
+}
+
+type PushConfig struct {
+	WebhookURL    string        `yaml:"webhook_url" env:"PUSH_WEBHOOK_URL"` // пусто — уведомления не отправляются
+	WebhookSecret string        `yaml:"webhook_secret" env:"PUSH_WEBHOOK_SECRET"`
+	Interval      time.Duration `yaml:"interval" env:"PUSH_INTERVAL"`
+	MaxAttempts   int           `yaml:"max_attempts" env:"PUSH_MAX_ATTEMPTS"`
+}
+
+// MetricsConfig — где отдавать /metrics. Без адреса и токена метрики собираются, но не публикуются.
+type MetricsConfig struct {
+	Addr  string `yaml:"addr" env:"METRICS_ADDR"`   // отдельный адрес (":9090"); пусто — основной сервер, только с токеном
+	Token string `yaml:"token" env:"METRICS_TOKEN"` // bearer-токен для /metrics
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`   // debug, info, warn или error
+	Format string `yaml:"format" env:"LOG_FORMAT"` // json или text
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`           // none, stdout или otlp
+	Endpoint    string  `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"` // URL коллектора OTLP/HTTP; пусто — стандартные OTEL_EXPORTER_OTLP_*
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"` // доля трасс, начатых сервером; входящее решение о выборке соблюдается
+}
+
+// Default возвращает настройки по умолчанию; секреты и параметры БД не заданы
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:              8081,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       time.Minute,
+			WriteTimeout:      time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+			ReadinessTimeout:  2 * time.Second,
+		},
+		DB: DBConfig{
+			Driver:          DriverPostgres,
+			Port:            5432,
+			SSLMode:         "prefer",
+			ConnectTimeout:  5 * time.Second,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			MigrateOnStart:  true,
+		},
+		Security: SecurityConfig{
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+		},
+		Messages: MessagesConfig{
+			EditWindow:           15 * time.Minute,
+			DeleteWindow:         48 * time.Hour,
+			MaxDistinctReactions: 20,
+			MaxPins:              10,
+		},
+		Workers: WorkersConfig{
+			ReaperInterval:    time.Minute,
+			BatchSize:         500,
+			SchedulerInterval: 10 * time.Second,
+		},
+		Attachments: AttachmentsConfig{
+			Dir:       "./data/attachments",
+			MaxSize:   25 << 20,
+			UploadTTL: 24 * time.Hour,
+		},
+		Presence: PresenceConfig{
+			AwayAfter:     5 * time.Minute,
+			TypingTimeout: 5 * time.Second,
+		},
+		Push: PushConfig{
+			Interval:    2 * time.Second,
+			MaxAttempts: 5,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "secure-messenger",
+			SampleRatio: 1,
+		},
 	}
+}
+
+// Load собирает настройки из всех источников и проверяет их. args — аргументы
+// командной строки без имени программы; возвращаются аргументы после флагов (команда).
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	fields := envFields(&cfg)
 
-	JWTSecret = os.Getenv("JWT_SECRET")
-	if JWTSecret == "" {
-		log.Fatal("JWT_SECRET is not set!")
+	fs := flag.NewFlagSet("secure-messenger", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a YAML or TOML config file (or CONFIG_FILE)")
+	overrides := make(map[string]string)
+	for _, f := range fields {
+		env := f.env
+		fs.Func(flagName(env), "overrides "+env, func(value string) error {
+			overrides[env] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
 	}
 
-	aesKey := os.Getenv("AES_SECRET_KEY")
-	if aesKey == "" {
-		log.Fatal("AES_SECRET_KEY is not set!")
+	// .env необязателен: в контейнерах переменные задаются окружением напрямую
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf(".env: %w", err)
 	}
-	AESSecretKey = []byte(aesKey) // ✅ безопасно инициализируем после Load()
 
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	var errs []error
+	for _, f := range fields {
+		if value := os.Getenv(f.env); value != "" {
+			if err := setField(f.value, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+		if value, ok := overrides[f.env]; ok {
+			if err := setField(f.value, value); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", flagName(f.env), err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, fs.Args(), nil
+}
+
+// Validate проверяет настройки и возвращает все найденные ошибки сразу
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	check(validPort(c.Server.Port), "PORT: must be between 1 and 65535")
+	check(c.Server.ReadHeaderTimeout >= 0, "SERVER_READ_HEADER_TIMEOUT: must not be negative")
+	check(c.Server.ReadTimeout >= 0, "SERVER_READ_TIMEOUT: must not be negative")
+	check(c.Server.WriteTimeout >= 0, "SERVER_WRITE_TIMEOUT: must not be negative")
+	check(c.Server.IdleTimeout >= 0, "SERVER_IDLE_TIMEOUT: must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT: must be positive")
+	check(c.Server.ShutdownDelay >= 0 && c.Server.ShutdownDelay < c.Server.ShutdownTimeout,
+		"SERVER_SHUTDOWN_DELAY: must not be negative and must be shorter than SERVER_SHUTDOWN_TIMEOUT")
+	check(c.Server.ReadinessTimeout > 0, "READINESS_CHECK_TIMEOUT: must be positive")
+
+	errs = append(errs, c.DB.validate()...)
+
+	check(c.Security.JWTSecret != "", "JWT_SECRET: is required")
+	switch len(c.Security.AESKey) {
+	case 16, 24, 32:
+	default:
+		errs = append(errs, fmt.Errorf("AES_SECRET_KEY: must be 16, 24 or 32 bytes long, got %d", len(c.Security.AESKey)))
+	}
+	check(c.Security.AccessTokenTTL > 0, "TOKEN_EXPIRY: must be positive")
+	check(c.Security.RefreshTokenTTL > 0, "REFRESH_TOKEN_EXPIRY: must be positive")
+
+	check(c.Messages.EditWindow >= 0, "MESSAGE_EDIT_WINDOW: must not be negative")
+	check(c.Messages.DeleteWindow >= 0, "MESSAGE_DELETE_WINDOW: must not be negative")
+	check(c.Messages.MaxDistinctReactions >= 0, "REACTIONS_MAX_DISTINCT: must not be negative")
+	check(c.Messages.MaxPins >= 0, "PINS_MAX_PER_CONVERSATION: must not be negative")
+
+	check(c.Workers.ReaperInterval > 0, "REAPER_INTERVAL: must be positive")
+	check(c.Workers.BatchSize > 0, "REAPER_BATCH_SIZE: must be positive")
+	check(c.Workers.SchedulerInterval > 0, "SCHEDULER_INTERVAL: must be positive")
+
+	check(c.Attachments.Dir != "", "ATTACHMENT_DIR: is required")
+	check(c.Attachments.MaxSize > 0, "ATTACHMENT_MAX_SIZE: must be positive")
+	check(c.Attachments.UploadTTL > 0, "ATTACHMENT_UPLOAD_TTL: must be positive")
+
+	check(c.Presence.AwayAfter > 0, "PRESENCE_AWAY_AFTER: must be positive")
+	check(c.Presence.TypingTimeout > 0, "TYPING_TIMEOUT: must be positive")
+
+	if c.Push.WebhookURL != "" {
+		u, err := url.Parse(c.Push.WebhookURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"PUSH_WEBHOOK_URL: must be an http(s) URL")
+	}
+	check(c.Push.Interval > 0, "PUSH_INTERVAL: must be positive")
+	check(c.Push.MaxAttempts > 0, "PUSH_MAX_ATTEMPTS: must be positive")
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: unknown level %q, use debug, info, warn or error", c.Log.Level))
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "LOG_FORMAT: must be json or text")
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER: unknown exporter %q, use none, stdout or otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"TRACING_OTLP_ENDPOINT: must be an http(s) URL")
+	}
+	check(c.Tracing.ServiceName != "", "TRACING_SERVICE_NAME: is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO: must be between 0 and 1")
+
+	if c.Metrics.Addr != "" {
+		_, port, err := net.SplitHostPort(c.Metrics.Addr)
+		n, _ := strconv.Atoi(port)
+		check(err == nil && validPort(n), "METRICS_ADDR: must be host:port or :port")
+		check(c.Metrics.Addr != c.Server.Addr(), "METRICS_ADDR: must differ from the API server address")
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port < 65536
+}
+
+// loadFile читает файл настроек; формат определяется по расширению
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return fmt.Errorf("config file: %w", err)
 	}
 
-	DB = db
-	log.Println("Database connected successfully!")
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		// TOML приводим к YAML, чтобы у обоих форматов были одни ключи и одни правила
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yaml or .toml", path)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)                                              // неизвестный ключ — скорее всего опечатка, молча игнорировать его нельзя
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) { // пустой файл — не ошибка
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+type envField struct {
+	env   string
+	value reflect.Value
+}
+
+// envFields перечисляет поля настроек, у которых есть переменная окружения
+func envFields(cfg *Config) []envField {
+	var fields []envField
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if env := v.Type().Field(i).Tag.Get("env"); env != "" {
+				fields = append(fields, envField{env: env, value: field})
+			} else if field.Kind() == reflect.Struct {
+				walk(field)
+			}
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField разбирает строковое значение в поле нужного типа
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+func flagName(env string) string {
+	return strings.ToLower(strings.ReplaceAll(env, "_", "-"))
 }
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolate убирает влияние окружения и .env из рабочего каталога и задаёт обязательные секреты
+func isolate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var cfg Config
+	for _, f := range envFields(&cfg) {
+		t.Setenv(f.env, "")
+	}
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("AES_SECRET_KEY", "0123456789abcdef")
+	t.Setenv("DB_DRIVER", DriverSQLite)
+	t.Setenv("DB_PATH", SQLiteMemory)
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	isolate(t)
+	path := writeFile(t, "config.yaml", `
+server:
+  port: 9000
+workers:
+  batch_size: 100
+log:
+  level: debug
+  format: text
+`)
+	t.Setenv("PORT", "9100")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	cfg, rest, err := Load([]string{"-config", path, "-port", "9200", "migrate", "up"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 9200, cfg.Server.Port)      // флаг важнее окружения
+	assert.Equal(t, "warn", cfg.Log.Level)      // окружение важнее файла
+	assert.Equal(t, "text", cfg.Log.Format)     // файл важнее значений по умолчанию
+	assert.Equal(t, 100, cfg.Workers.BatchSize) // файл важнее значений по умолчанию
+	assert.Equal(t, time.Minute, cfg.Workers.ReaperInterval)
+	assert.Equal(t, []string{"migrate", "up"}, rest)
+
+	// Файл можно указать и через CONFIG_FILE
+	t.Setenv("CONFIG_FILE", path)
+	cfg, _, err = Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 9100, cfg.Server.Port)
+	assert.Equal(t, 100, cfg.Workers.BatchSize)
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	isolate(t)
+	yamlPath := writeFile(t, "config.yml", `
+messages:
+  edit_window: 30s
+  max_pins: 3
+attachments:
+  allowed_types: [image/png, text/plain]
+tracing:
+  sample_ratio: 0.25
+`)
+	tomlPath := writeFile(t, "config.toml", `
+[messages]
+edit_window = "30s"
+max_pins = 3
+
+[attachments]
+allowed_types = ["image/png", "text/plain"]
+
+[tracing]
+sample_ratio = 0.25
+`)
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		cfg, _, err := Load([]string{"-config", path})
+		require.NoError(t, err, path)
+		assert.Equal(t, 30*time.Second, cfg.Messages.EditWindow, path)
+		assert.Equal(t, 3, cfg.Messages.MaxPins, path)
+		assert.Equal(t, []string{"image/png", "text/plain"}, cfg.Attachments.AllowedTypes, path)
+		assert.Equal(t, 0.25, cfg.Tracing.SampleRatio, path)
+	}
+
+	// Пустой файл — только значения по умолчанию
+	cfg, _, err := Load([]string{"-config", writeFile(t, "empty.yaml", "")})
+	require.NoError(t, err)
+	assert.Equal(t, Default().Server.Port, cfg.Server.Port)
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	isolate(t)
+	cases := map[string]string{
+		"typo.yaml":   "server:\n  prot: 9000\n",
+		"section.yml": "sever:\n  port: 9000\n",
+		"typo.toml":   "[server]\nprot = 9000\n",
+	}
+	for name, content := range cases {
+		_, _, err := Load([]string{"-config", writeFile(t, name, content)})
+		assert.Error(t, err, name)
+	}
+
+	_, _, err := Load([]string{"-config", writeFile(t, "config.json", `{}`)})
+	assert.ErrorContains(t, err, "unsupported format")
+
+	_, _, err = Load([]string{"-no-such-flag", "1"})
+	assert.Error(t, err)
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	isolate(t)
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("REAPER_INTERVAL", "0s")
+	t.Setenv("REAPER_BATCH_SIZE", "0")
+	t.Setenv("SCHEDULER_INTERVAL", "-1s")
+	t.Setenv("PUSH_MAX_ATTEMPTS", "-2")
+
+	_, _, err := Load([]string{"-port", "70000"})
+	require.Error(t, err)
+	for _, msg := range []string{
+		"PORT: must be between 1 and 65535",
+		"JWT_SECRET: is required",
+		"REAPER_INTERVAL: must be positive",
+		"REAPER_BATCH_SIZE: must be positive",
+		"SCHEDULER_INTERVAL: must be positive",
+		"PUSH_MAX_ATTEMPTS: must be positive",
+	} {
+		assert.ErrorContains(t, err, msg)
+	}
+
+	// Ошибки разбора значений тоже собираются вместе, а не по одной
+	isolate(t)
+	t.Setenv("PORT", "eighty")
+	t.Setenv("TOKEN_EXPIRY", "soon")
+	_, _, err = Load([]string{"-db-migrate-on-start", "maybe"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `PORT: invalid number "eighty"`)
+	assert.ErrorContains(t, err, `TOKEN_EXPIRY: invalid duration "soon"`)
+	assert.ErrorContains(t, err, `-db-migrate-on-start: invalid boolean "maybe"`)
+
+	// Значения по умолчанию с обязательными секретами проходят проверку
+	cfg := Default()
+	cfg.Security.JWTSecret = "secret"
+	cfg.Security.AESKey = "0123456789abcdef"
+	cfg.DB.Driver, cfg.DB.Path = DriverSQLite, SQLiteMemory
+	assert.NoError(t, cfg.Validate())
+	cfg.Workers.BatchSize = -1
+	cfg.Workers.ReaperInterval = 0
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "REAPER_INTERVAL")
+	assert.ErrorContains(t, err, "REAPER_BATCH_SIZE")
+}
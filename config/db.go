@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"secure-messenger/pkg/logging"
+	"secure-messenger/pkg/tracing"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+
+	// SQLiteMemory — значение DB_PATH для базы в памяти (тесты, демо)
+	SQLiteMemory = ":memory:"
+)
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true,
+}
+
+func (c DBConfig) validate() []error {
+	var errs []error
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	switch c.Driver {
+	case DriverPostgres:
+		if c.DSN == "" {
+			check(c.Host != "", "DB_HOST: is required")
+			check(validPort(c.Port), "DB_PORT: must be between 1 and 65535")
+			check(c.User != "", "DB_USER: is required")
+			check(c.Name != "", "DB_NAME: is required")
+			check(sslModes[c.SSLMode], "DB_SSLMODE: must be one of disable, allow, prefer, require, verify-ca, verify-full")
+			check(c.ConnectTimeout >= 0, "DB_CONNECT_TIMEOUT: must not be negative")
+		}
+	case DriverSQLite:
+		check(c.Path != "", "DB_PATH: is required for sqlite")
+	default:
+		errs = append(errs, fmt.Errorf("DB_DRIVER: unknown driver %q, use postgres or sqlite", c.Driver))
+	}
+
+	check(c.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS: must not be negative")
+	check(c.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS: must not be negative")
+	check(c.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME: must not be negative")
+	check(c.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME: must not be negative")
+	return errs
+}
+
+// OpenDB подключается к базе данных выбранным драйвером и настраивает пул соединений
+func OpenDB(cfg DBConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case DriverPostgres:
+		dialector = postgres.Open(postgresDSN(cfg))
+	case DriverSQLite:
+		dsn, err := sqliteDSN(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		dialector = sqlite.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logging.NewGormLogger()})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracing.NewGormPlugin(cfg.Driver)); err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if cfg.Driver == DriverSQLite && cfg.Path == SQLiteMemory {
+		// база в памяти живёт, пока открыто хотя бы одно соединение
+		sqlDB.SetMaxIdleConns(max(cfg.MaxIdleConns, 1))
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
+	return db, nil
+}
+
+func postgresDSN(cfg DBConfig) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+
+	params := []string{
+		"host=" + pgQuote(cfg.Host),
+		fmt.Sprintf("port=%d", cfg.Port),
+		"user=" + pgQuote(cfg.User),
+		"password=" + pgQuote(cfg.Password),
+		"dbname=" + pgQuote(cfg.Name),
+		"sslmode=" + cfg.SSLMode,
+	}
+	if cfg.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+pgQuote(cfg.SSLRootCert))
+	}
+	if cfg.SSLCert != "" {
+		params = append(params, "sslcert="+pgQuote(cfg.SSLCert))
+	}
+	if cfg.SSLKey != "" {
+		params = append(params, "sslkey="+pgQuote(cfg.SSLKey))
+	}
+	if cfg.ConnectTimeout > 0 {
+		params = append(params, fmt.Sprintf("connect_timeout=%d", max(int(cfg.ConnectTimeout.Seconds()), 1)))
+	}
+	return strings.Join(params, " ")
+}
+
+// pgQuote экранирует значение для строки подключения вида key=value
+func pgQuote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + value + "'"
+}
+
+func sqliteDSN(path string) (string, error) {
+	if path == SQLiteMemory {
+		return "file::memory:?cache=shared", nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("sqlite directory: %w", err)
+	}
+	// WAL позволяет читать во время записи, busy_timeout — ждать блокировку вместо ошибки,
+	// а immediate-транзакции сразу берут блокировку записи и не падают при её повышении
+	return "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", nil
+}
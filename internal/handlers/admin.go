@@ -10,9 +10,10 @@ import (
 
 func GetAllUsersWithDB(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var users []models.User
 		if err := db.Find(&users).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+			abortWithError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, users)
@@ -21,34 +22,36 @@ func GetAllUsersWithDB(db *gorm.DB) gin.HandlerFunc {
 
 func DeleteUserWithDB(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		idParam := c.Param("id")
 		id, err := strconv.Atoi(idParam)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			abortWithError(c, invalidParam("id", "integer", ""))
 			return
 		}
 
 		if err := db.Delete(&models.User{}, id).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+			abortWithError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+		c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "user_deleted")})
 	}
 }
 
 func UpdateUserWithDB(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		idParam := c.Param("id")
 		id, err := strconv.Atoi(idParam)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			abortWithError(c, invalidParam("id", "integer", ""))
 			return
 		}
 
 		var user models.User
 		if err := db.First(&user, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			abortWithError(c, userLookupError(err))
 			return
 		}
 
@@ -57,8 +60,7 @@ func UpdateUserWithDB(db *gorm.DB) gin.HandlerFunc {
 			Email string `json:"email"`
 			Role  string `json:"role"`
 		}
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindJSON(c, &req) {
 			return
 		}
 
@@ -67,10 +69,10 @@ func UpdateUserWithDB(db *gorm.DB) gin.HandlerFunc {
 		user.Role = req.Role
 
 		if err := db.Save(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			abortWithError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+		c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "user_updated")})
 	}
 }
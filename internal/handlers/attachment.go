@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/services"
+)
+
+type AttachmentHandler struct {
+	Service *services.AttachmentService
+}
+
+func NewAttachmentHandler(s *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{Service: s}
+}
+
+// CreateUpload начинает загрузку вложения; дальше фрагменты отправляются в UploadChunk
+func (h *AttachmentHandler) CreateUpload(c *gin.Context) {
+	var req struct {
+		FileName string `json:"file_name" binding:"required"`
+		MimeType string `json:"mime_type" binding:"required"`
+		Size     int64  `json:"size" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	attachment, err := h.Service.CreateUpload(c.GetUint("user_id"), req.FileName, req.MimeType, req.Size)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// UploadChunk принимает фрагмент в теле запроса как есть (application/octet-stream)
+func (h *AttachmentHandler) UploadChunk(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		abortWithError(c, invalidParam("index", "integer", ""))
+		return
+	}
+
+	attachment, err := h.Service.UploadChunk(c.Param("id"), c.GetUint("user_id"), index, c.Request.Body)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+// GetAttachment возвращает метаданные и состояние загрузки (для возобновления)
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	attachment, err := h.Service.GetAttachment(c.Param("id"), c.GetUint("user_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+func (h *AttachmentHandler) Download(c *gin.Context) {
+	attachment, content, err := h.Service.Open(c.Param("id"), c.GetUint("user_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	defer content.Close()
+
+	disableWriteTimeout(c)
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.MimeType, content, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+	})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+)
+
+func uploadChunk(router *gin.Engine, token, id string, index int, data []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/attachments/%s/chunks/%d", id, index), bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAttachmentUploadAndDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	_, senderToken := createTestUser(t, db, "attach-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "attach-receiver@example.com")
+	_, strangerToken := createTestUser(t, db, "attach-stranger@example.com")
+
+	// Файл на два с половиной фрагмента
+	content := bytes.Repeat([]byte("0123456789abcdef"), services.AttachmentChunkSize*5/2/16)
+
+	w := doJSON(router, http.MethodPost, "/api/attachments", senderToken,
+		fmt.Sprintf(`{"file_name": "../notes.txt", "mime_type": "text/plain", "size": %d}`, len(content)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var upload models.Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+	assert.Equal(t, 3, upload.ChunkCount)
+	assert.Equal(t, "notes.txt", upload.FileName)
+
+	chunk := func(i int) []byte {
+		end := (i + 1) * services.AttachmentChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		return content[i*services.AttachmentChunkSize : end]
+	}
+
+	assert.Equal(t, http.StatusOK, uploadChunk(router, senderToken, upload.ID, 0, chunk(0)).Code)
+	// Фрагменты принимаются только по порядку; повтор уже принятого безопасен
+	assert.Equal(t, http.StatusConflict, uploadChunk(router, senderToken, upload.ID, 2, chunk(2)).Code)
+	assert.Equal(t, http.StatusOK, uploadChunk(router, senderToken, upload.ID, 0, chunk(0)).Code)
+	// Чужую загрузку продолжить нельзя
+	assert.Equal(t, http.StatusNotFound, uploadChunk(router, strangerToken, upload.ID, 1, chunk(1)).Code)
+
+	// Возобновление: узнаём, сколько фрагментов уже принято
+	w = doJSON(router, http.MethodGet, "/api/attachments/"+upload.ID, senderToken, "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+	assert.Equal(t, 1, upload.UploadedChunks)
+
+	for i := upload.UploadedChunks; i < upload.ChunkCount; i++ {
+		assert.Equal(t, http.StatusOK, uploadChunk(router, senderToken, upload.ID, i, chunk(i)).Code)
+	}
+
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "see file", "attachment_ids": [%q]}`, receiver.ID, upload.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	msgs := listMessages(t, router, receiverToken)
+	assert.Len(t, msgs, 1)
+	assert.Len(t, msgs[0]["Attachments"], 1)
+
+	w = doJSON(router, http.MethodGet, "/api/attachments/"+upload.ID+"/content", receiverToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.Equal(content, w.Body.Bytes()))
+
+	// Посторонний пользователь не может скачать вложение
+	w = doJSON(router, http.MethodGet, "/api/attachments/"+upload.ID+"/content", strangerToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Одно вложение нельзя прикрепить дважды
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "again", "attachment_ids": [%q]}`, receiver.ID, upload.ID))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAttachmentLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	_, token := createTestUser(t, db, "attach-limits@example.com")
+
+	w := doJSON(router, http.MethodPost, "/api/attachments", token,
+		`{"file_name": "run.exe", "mime_type": "application/x-msdownload", "size": 100}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = doJSON(router, http.MethodPost, "/api/attachments", token,
+		fmt.Sprintf(`{"file_name": "huge.zip", "mime_type": "application/zip", "size": %d}`, int64(1)<<40))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestAttachmentGarbageCollection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	repo := repository.NewAttachmentRepository(db)
+	owner, _ := createTestUser(t, db, "attach-gc@example.com")
+
+	stale := time.Now().Add(-time.Hour)
+	newUpload := func(id string) {
+		assert.NoError(t, db.Create(&models.Attachment{
+			ID: id, OwnerID: owner.ID, FileName: "f", MimeType: "text/plain", Size: 1,
+			ChunkSize: 1, ChunkCount: 1, UploadedChunks: 1, Status: models.AttachmentComplete,
+			Key: "k", CreatedAt: stale,
+		}).Error)
+	}
+	newUpload("gcabandoned")
+	newUpload("gcraced")
+
+	purged := map[string]bool{}
+	purge := func(id string) func() error {
+		return func() error { purged[id] = true; return nil }
+	}
+
+	// Между FindGarbage и удалением загрузку прикрепили к сообщению
+	msgID := uint(424242)
+	db.Model(&models.Attachment{}).Where("id = ?", "gcraced").Update("message_id", msgID)
+
+	deleted, err := repo.DeleteGarbage("gcraced", time.Now(), purge("gcraced"))
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	assert.False(t, purged["gcraced"])
+	_, err = repo.GetByID("gcraced")
+	assert.NoError(t, err)
+
+	// Ошибка при удалении файлов оставляет запись для следующего прохода
+	deleted, err = repo.DeleteGarbage("gcabandoned", time.Now(), func() error { return errors.New("storage down") })
+	assert.Error(t, err)
+	assert.False(t, deleted)
+	_, err = repo.GetByID("gcabandoned")
+	assert.NoError(t, err)
+
+	deleted, err = repo.DeleteGarbage("gcabandoned", time.Now(), purge("gcabandoned"))
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.True(t, purged["gcabandoned"])
+	_, err = repo.GetByID("gcabandoned")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
@@ -1,78 +1,87 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"net/http"
-	"secure-messenger/config"
 	"secure-messenger/internal/models"
 	"secure-messenger/internal/services"
 )
 
-func Login(c *gin.Context) {
-	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+func LoginWithDB(db *gorm.DB, tokens *services.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
+		var req struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
-	}
+		if !bindJSON(c, &req) {
+			return
+		}
 
-	var user models.User
-	if err := config.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
-		return
-	}
+		var user models.User
+		if err := db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				abortWithError(c, err)
+				return
+			}
+			tokens.Metrics.Login(false)
+			abortWithError(c, services.ErrInvalidCredentials)
+			return
+		}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
-		return
-	}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+			tokens.Metrics.Login(false)
+			abortWithError(c, services.ErrInvalidCredentials)
+			return
+		}
+		tokens.Metrics.Login(true)
 
-	accessToken, err := services.GenerateJWT(user.ID, user.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
-		return
-	}
+		accessToken, err := tokens.GenerateJWT(user.ID, user.Role)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
 
-	refreshToken, err := services.GenerateRefreshToken(config.DB, user.ID)
+		refreshToken, err := tokens.GenerateRefreshToken(db, user.ID)
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
-		return
-	}
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  accessToken,
+			"refresh_token": refreshToken,
+		})
+	}
 }
 
 func RegisterWithDB(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req struct {
 			Name     string `json:"name" binding:"required"`
 			Email    string `json:"email" binding:"required,email"`
 			Password string `json:"password" binding:"required,min=6"`
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !bindJSON(c, &req) {
 			return
 		}
 
 		var existing models.User
 		if err := db.Where("email = ?", req.Email).First(&existing).Error; err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already registered"})
+			abortWithError(c, services.ErrEmailTaken)
 			return
 		}
 
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			abortWithError(c, err)
 			return
 		}
 
@@ -84,59 +93,61 @@ func RegisterWithDB(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		if err := db.Create(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			abortWithError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
+		c.JSON(http.StatusCreated, gin.H{"message": systemMessage(c, "user_registered")})
 	}
 }
 
-func Refresh(c *gin.Context) {
-	var request struct {
-		RefreshToken string `json:"refresh_token"`
-	}
-	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token required"})
-		return
-	}
-
-	// Проверка refresh token в БД
-	rt, err := services.ValidateRefreshToken(config.DB, request.RefreshToken)
-
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
-		return
-	}
-
-	// Получаем пользователя
-	var user models.User
-	if err := config.DB.First(&user, rt.UserID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	// Генерация нового access token
-	accessToken, err := services.GenerateJWT(user.ID, user.Role)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
-		return
-	}
+func RefreshWithDB(db *gorm.DB, tokens *services.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
+		var request struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if !bindJSON(c, &request) {
+			return
+		}
 
-	// Генерация нового refresh token (и удаление старого желательно)
-	newRefreshToken, err := services.GenerateRefreshToken(config.DB, user.ID)
+		// Старый токен удаляется в той же транзакции, что выдаётся новый: из двух
+		// одновременных обменов одним токеном успешен только один
+		var accessToken, newRefreshToken string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			rt, err := services.ValidateRefreshToken(tx, request.RefreshToken)
+			if err != nil {
+				return err
+			}
+
+			var user models.User
+			if err := tx.First(&user, rt.UserID).Error; err != nil {
+				return userLookupError(err)
+			}
+
+			if err := services.ConsumeRefreshToken(tx, rt); err != nil {
+				return err
+			}
+
+			accessToken, err = tokens.GenerateJWT(user.ID, user.Role)
+			if err != nil {
+				return err
+			}
+			newRefreshToken, err = tokens.GenerateRefreshToken(tx, user.ID)
+			return err
+		})
+		if errors.Is(err, services.ErrRefreshTokenReused) {
+			tokens.Metrics.RefreshReused()
+		}
+		tokens.Metrics.Refresh(err == nil)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
-		return
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  accessToken,
+			"refresh_token": newRefreshToken,
+		})
 	}
-
-	// Удаление старого refresh token
-	config.DB.Delete(&rt)
-
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": newRefreshToken,
-	})
 }
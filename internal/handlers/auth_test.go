@@ -1,41 +1,72 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/glebarez/sqlite" // 👈 используем вместо gorm.io/driver/sqlite
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"secure-messenger/config"
+	"secure-messenger/internal/migrations"
 	"secure-messenger/internal/models"
 	"secure-messenger/internal/services"
 	"strings"
 	"testing"
+	"time"
 )
 
+// testTokens подписывает токены тестовых пользователей
+var testTokens = services.NewTokenService("testsecret", time.Hour, 7*24*time.Hour)
+
+// testDBConfig — по умолчанию SQLite в памяти. Тот же набор тестов прогоняется на другой базе
+// через TEST_DB_DRIVER и TEST_DB_DSN (строка подключения Postgres или путь к файлу SQLite);
+// база должна быть пустой.
+func testDBConfig() config.DBConfig {
+	cfg := config.Default().DB
+	cfg.Driver = config.DriverSQLite
+	cfg.Path = config.SQLiteMemory
+	switch os.Getenv("TEST_DB_DRIVER") {
+	case config.DriverPostgres:
+		cfg.Driver = config.DriverPostgres
+		cfg.DSN = os.Getenv("TEST_DB_DSN")
+	case config.DriverSQLite:
+		if path := os.Getenv("TEST_DB_DSN"); path != "" {
+			cfg.Path = path
+		}
+	}
+	return cfg
+}
+
 func setupTestDB() *gorm.DB {
-	config.JWTSecret = "testsecret"
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	return openTestDB(testDBConfig())
+}
+
+func openTestDB(cfg config.DBConfig) *gorm.DB {
+	db, err := config.OpenDB(cfg)
 	if err != nil {
 		panic("failed to connect database")
 	}
-	_ = db.AutoMigrate(&models.User{}, &models.RefreshToken{}) // ✅ теперь обе таблицы
+	migrator, err := migrations.New(db)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		panic(err)
+	}
 	return db
 }
 
-func setupTestEnv() {
-	config.JWTSecret = "testsecret"
-}
 func TestRegister(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestEnv()
 
 	db := setupTestDB()
 	router := gin.Default()
+	router.Use(ErrorMiddleware())
 
 	// Используем обёртку RegisterWithDB
 	router.POST("/register", RegisterWithDB(db))
@@ -61,10 +92,10 @@ func TestRegister(t *testing.T) {
 }
 func TestLogin(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestEnv()
 
 	db := setupTestDB()
 	router := gin.Default()
+	router.Use(ErrorMiddleware())
 
 	// Регистрируем пользователя напрямую в БД
 	password := "mypassword"
@@ -78,13 +109,7 @@ func TestLogin(t *testing.T) {
 	db.Create(&user)
 
 	// Регистрируем endpoint логина
-	router.POST("/login", func(c *gin.Context) {
-		configBackup := config.DB // если ты всё ещё используешь config.DB в Login
-		config.DB = db
-		defer func() { config.DB = configBackup }()
-
-		Login(c)
-	})
+	router.POST("/login", LoginWithDB(db, testTokens))
 
 	// Формируем запрос логина
 	payload := `{
@@ -108,10 +133,10 @@ func TestLogin(t *testing.T) {
 }
 func TestRefreshToken(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestEnv()
 
 	db := setupTestDB()
 	router := gin.Default()
+	router.Use(ErrorMiddleware())
 
 	// Создаём пользователя
 	user := models.User{
@@ -123,19 +148,15 @@ func TestRefreshToken(t *testing.T) {
 	db.Create(&user)
 
 	// Генерируем refresh token
-	refreshToken, err := services.GenerateRefreshToken(db, user.ID)
+	refreshToken, err := testTokens.GenerateRefreshToken(db, user.ID)
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, refreshToken)
+	consumed, err := services.ValidateRefreshToken(db, refreshToken)
+	assert.NoError(t, err)
 
 	// Регистрируем endpoint /refresh
-	router.POST("/refresh", func(c *gin.Context) {
-		configBackup := config.DB
-		config.DB = db
-		defer func() { config.DB = configBackup }()
-
-		Refresh(c)
-	})
+	router.POST("/refresh", RefreshWithDB(db, testTokens))
 
 	// Формируем запрос
 	payload := fmt.Sprintf(`{"refresh_token": "%s"}`, refreshToken)
@@ -152,13 +173,19 @@ func TestRefreshToken(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, resp, "access_token")
 	assert.Contains(t, resp, "refresh_token")
+
+	// Старый токен удалён: повторно его не обменять
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(payload)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.ErrorIs(t, services.ConsumeRefreshToken(db, consumed), services.ErrRefreshTokenReused)
 }
 func TestProfileAccess(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestEnv()
 
 	db := setupTestDB()
 	router := gin.Default()
+	router.Use(ErrorMiddleware())
 
 	// Создаём пользователя
 	user := models.User{
@@ -170,13 +197,13 @@ func TestProfileAccess(t *testing.T) {
 	db.Create(&user)
 
 	// Генерируем access token
-	accessToken, err := services.GenerateJWT(user.ID, user.Role)
+	accessToken, err := testTokens.GenerateJWT(user.ID, user.Role)
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, accessToken)
 
 	// Регистрируем /profile endpoint
-	router.GET("/profile", AuthMiddleware(""), ProfileHandler(db))
+	router.GET("/profile", AuthMiddleware(testTokens, ""), ProfileHandler(db))
 
 	// Создаём GET-запрос с заголовком Authorization
 	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
@@ -194,10 +221,10 @@ func TestProfileAccess(t *testing.T) {
 }
 func TestAdminGetAllUsers(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestEnv()
 
 	db := setupTestDB()
 	router := gin.Default()
+	router.Use(ErrorMiddleware())
 
 	// Создаём admin-пользователя
 	admin := models.User{
@@ -218,13 +245,13 @@ func TestAdminGetAllUsers(t *testing.T) {
 	db.Create(&user)
 
 	// Генерируем access token для admin
-	accessToken, err := services.GenerateJWT(admin.ID, admin.Role) // ✅ role: admin
+	accessToken, err := testTokens.GenerateJWT(admin.ID, admin.Role) // ✅ role: admin
 
 	assert.NoError(t, err)
 
 	// Регистрируем /admin/users endpoint
 	adminGroup := router.Group("/admin")
-	adminGroup.Use(AuthMiddleware("admin")) // только админ
+	adminGroup.Use(AuthMiddleware(testTokens, "admin")) // только админ
 	{
 		adminGroup.GET("/users", GetAllUsersWithDB(db))
 
@@ -248,9 +275,9 @@ func TestAdminGetAllUsers(t *testing.T) {
 }
 func TestAdminDeleteUser(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestEnv()
 	db := setupTestDB()
 	router := gin.Default()
+	router.Use(ErrorMiddleware())
 
 	// Создаём admin-пользователя
 	admin := models.User{
@@ -271,12 +298,12 @@ func TestAdminDeleteUser(t *testing.T) {
 	db.Create(&user)
 
 	// Генерируем admin access token
-	token, err := services.GenerateJWT(admin.ID, admin.Role)
+	token, err := testTokens.GenerateJWT(admin.ID, admin.Role)
 	assert.NoError(t, err)
 
 	// Регистрируем DELETE endpoint
 	adminGroup := router.Group("/admin")
-	adminGroup.Use(AuthMiddleware("admin"))
+	adminGroup.Use(AuthMiddleware(testTokens, "admin"))
 	{
 		adminGroup.DELETE("/users/:id", DeleteUserWithDB(db))
 	}
@@ -303,9 +330,9 @@ func TestAdminDeleteUser(t *testing.T) {
 }
 func TestAdminUpdateUser(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestEnv()
 	db := setupTestDB()
 	router := gin.Default()
+	router.Use(ErrorMiddleware())
 
 	// Админ
 	admin := models.User{
@@ -326,12 +353,12 @@ func TestAdminUpdateUser(t *testing.T) {
 	db.Create(&user)
 
 	// Токен для админа
-	token, err := services.GenerateJWT(admin.ID, admin.Role)
+	token, err := testTokens.GenerateJWT(admin.ID, admin.Role)
 	assert.NoError(t, err)
 
 	// Регистрируем endpoint
 	adminGroup := router.Group("/admin")
-	adminGroup.Use(AuthMiddleware("admin"))
+	adminGroup.Use(AuthMiddleware(testTokens, "admin"))
 	{
 		adminGroup.PUT("/users/:id", UpdateUserWithDB(db))
 	}
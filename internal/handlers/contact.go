@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/services"
+)
+
+// UserSummary — публичные сведения о пользователе в списках контактов и блокировок
+type UserSummary struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type ContactHandler struct {
+	Service *services.ContactService
+}
+
+func NewContactHandler(s *services.ContactService) *ContactHandler {
+	return &ContactHandler{Service: s}
+}
+
+func (h *ContactHandler) ListContacts(c *gin.Context) {
+	users, err := h.Service.ListContacts(c.GetUint("user_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"contacts": userSummaries(users)})
+}
+
+func (h *ContactHandler) AddContact(c *gin.Context) {
+	userID, ok := bindTargetUser(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.AddContact(c.GetUint("user_id"), userID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "contact_added")})
+}
+
+func (h *ContactHandler) RemoveContact(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.RemoveContact(c.GetUint("user_id"), userID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "contact_removed")})
+}
+
+func (h *ContactHandler) ListBlocked(c *gin.Context) {
+	users, err := h.Service.ListBlocked(c.GetUint("user_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"blocked": userSummaries(users)})
+}
+
+func (h *ContactHandler) Block(c *gin.Context) {
+	userID, ok := bindTargetUser(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.Block(c.GetUint("user_id"), userID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "user_blocked")})
+}
+
+func (h *ContactHandler) Unblock(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.Unblock(c.GetUint("user_id"), userID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "user_unblocked")})
+}
+
+// ListRequests — входящие запросы на переписку от незнакомцев
+func (h *ContactHandler) ListRequests(c *gin.Context) {
+	requests, err := h.Service.ListRequests(c.GetUint("user_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+func (h *ContactHandler) AcceptRequest(c *gin.Context) {
+	h.decideRequest(c, h.Service.AcceptRequest)
+}
+
+func (h *ContactHandler) DeclineRequest(c *gin.Context) {
+	h.decideRequest(c, h.Service.DeclineRequest)
+}
+
+func (h *ContactHandler) decideRequest(c *gin.Context, decide func(userID, requestID uint) (*models.MessageRequest, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		abortWithError(c, invalidParam("id", "positive_integer", ""))
+		return
+	}
+
+	req, err := decide(c.GetUint("user_id"), uint(id))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+func bindTargetUser(c *gin.Context) (uint, bool) {
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return 0, false
+	}
+	return req.UserID, true
+}
+
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil || id == 0 {
+		abortWithError(c, invalidParam("user_id", "positive_integer", ""))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func userSummaries(users []models.User) []UserSummary {
+	summaries := make([]UserSummary, 0, len(users))
+	for _, u := range users {
+		summaries = append(summaries, UserSummary{ID: u.ID, Name: u.Name})
+	}
+	return summaries
+}
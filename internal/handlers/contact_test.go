@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"secure-messenger/internal/models"
+)
+
+func TestSendValidatesReceiver(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	sender, senderToken := createTestUser(t, db, "validate-sender@example.com")
+	gone, _ := createTestUser(t, db, "validate-gone@example.com")
+	assert.NoError(t, db.Delete(&gone).Error)
+
+	w := doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "me"}`, sender.ID))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken, `{"receiver_id": 999999, "content": "nobody"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Удалённый аккаунт — то же, что несуществующий
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "gone"}`, gone.ID))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestContactsAndBlocking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	alice, aliceToken := createTestUser(t, db, "block-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "block-bob@example.com")
+
+	w := doJSON(router, http.MethodPost, "/api/contacts", aliceToken, fmt.Sprintf(`{"user_id": %d}`, bob.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/contacts", aliceToken, fmt.Sprintf(`{"user_id": %d}`, alice.ID))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, http.MethodGet, "/api/contacts", aliceToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var contacts struct {
+		Contacts []UserSummary `json:"contacts"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &contacts))
+	assert.Equal(t, []UserSummary{{ID: bob.ID, Name: bob.Name}}, contacts.Contacts)
+
+	// Блокировка убирает из контактов; по умолчанию отказ молчаливый
+	w = doJSON(router, http.MethodPost, "/api/blocks", aliceToken, fmt.Sprintf(`{"user_id": %d}`, bob.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodGet, "/api/contacts", aliceToken, "")
+	assert.JSONEq(t, `{"contacts": []}`, w.Body.String())
+
+	w = doJSON(router, http.MethodPost, "/api/messages/send", bobToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "let me in"}`, alice.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, listMessages(t, router, aliceToken))
+	// Отправитель видит своё сообщение как обычное неотправленное — без признаков блокировки
+	sent := listMessages(t, router, bobToken)
+	assert.Len(t, sent, 1)
+	assert.Equal(t, "sent", sent[0]["Status"])
+	assert.NotContains(t, sent[0], "Suppressed")
+
+	// Сама Алиса тоже не может писать заблокированному
+	w = doJSON(router, http.MethodPost, "/api/messages/send", aliceToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "hi"}`, bob.ID))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Явный отказ
+	w = doJSON(router, http.MethodPatch, "/api/profile/settings", aliceToken, `{"block_silent": false}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/messages/send", bobToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "let me in"}`, alice.ID))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/blocks/%d", bob.ID), aliceToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/blocks/%d", bob.ID), aliceToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// После разблокировки новые сообщения доходят, а присланные во время блокировки — нет
+	sendTestMessage(t, router, db, bobToken, alice.ID, "friends again")
+	msgs := listMessages(t, router, aliceToken)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "friends again", msgs[0]["Content"])
+}
+
+func TestMessageRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	owner, ownerToken := createTestUser(t, db, "requests-owner@example.com")
+	friend, friendToken := createTestUser(t, db, "requests-friend@example.com")
+	stranger, strangerToken := createTestUser(t, db, "requests-stranger@example.com")
+	spammer, spammerToken := createTestUser(t, db, "requests-spammer@example.com")
+
+	w := doJSON(router, http.MethodPatch, "/api/profile/settings", ownerToken, `{"only_contacts": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/contacts", ownerToken, fmt.Sprintf(`{"user_id": %d}`, friend.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	sendTestMessage(t, router, db, friendToken, owner.ID, "from friend")
+	sendTestMessage(t, router, db, strangerToken, owner.ID, "hello?")
+	sendTestMessage(t, router, db, strangerToken, owner.ID, "anyone?")
+	sendTestMessage(t, router, db, spammerToken, owner.ID, "buy now")
+
+	// Неудачная отправка не оставляет запроса без сообщения
+	failed, failedToken := createTestUser(t, db, "requests-failed@example.com")
+	w = doJSON(router, http.MethodPost, "/api/messages/send", failedToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "hi", "reply_to_id": 999999}`, owner.ID))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var orphans int64
+	db.Model(&models.MessageRequest{}).Where("sender_id = ?", failed.ID).Count(&orphans)
+	assert.Zero(t, orphans)
+
+	// Сообщения незнакомцев ждут решения и не видны получателю
+	msgs := listMessages(t, router, ownerToken)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "from friend", msgs[0]["Content"])
+	assert.Len(t, listMessages(t, router, strangerToken), 2)
+	assert.Equal(t, "sent", listMessages(t, router, strangerToken)[0]["Status"])
+
+	w = doJSON(router, http.MethodGet, "/api/message-requests", ownerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Requests []models.MessageRequest `json:"requests"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Requests, 2)
+	requestIDs := map[uint]uint{}
+	for _, r := range resp.Requests {
+		requestIDs[r.SenderID] = r.ID
+	}
+
+	// Решать может только получатель
+	w = doJSON(router, http.MethodPost, fmt.Sprintf("/api/message-requests/%d/accept", requestIDs[stranger.ID]), strangerToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSON(router, http.MethodPost, fmt.Sprintf("/api/message-requests/%d/accept", requestIDs[stranger.ID]), ownerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, listMessages(t, router, ownerToken), 3)
+	sendTestMessage(t, router, db, strangerToken, owner.ID, "thanks")
+	assert.Len(t, listMessages(t, router, ownerToken), 4)
+
+	w = doJSON(router, http.MethodPost, fmt.Sprintf("/api/message-requests/%d/decline", requestIDs[spammer.ID]), ownerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var count int64
+	db.Model(&models.Message{}).Where("sender_id = ?", spammer.ID).Count(&count)
+	assert.Zero(t, count)
+
+	w = doJSON(router, http.MethodPost, "/api/messages/send", spammerToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "again"}`, owner.ID))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(router, http.MethodGet, "/api/message-requests", ownerToken, "")
+	assert.JSONEq(t, `{"requests": []}`, w.Body.String())
+}
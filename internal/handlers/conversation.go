@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/services"
+)
+
+type ConversationHandler struct {
+	Service *services.ConversationService
+}
+
+func NewConversationHandler(s *services.ConversationService) *ConversationHandler {
+	return &ConversationHandler{Service: s}
+}
+
+func (h *ConversationHandler) GetSettings(c *gin.Context) {
+	peerID, ok := peerIDParam(c)
+	if !ok {
+		return
+	}
+
+	setting, err := h.Service.GetSettings(c.GetUint("user_id"), peerID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	mute, err := h.Service.GetMute(c.GetUint("user_id"), peerID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ttl_seconds":    setting.TTLSeconds,
+		"ttl_after_read": setting.TTLAfterRead,
+		"muted":          mute != nil,
+		"muted_until":    mutedUntil(mute),
+	})
+}
+
+// SetTTL включает или выключает исчезающие сообщения для переписки
+func (h *ConversationHandler) SetTTL(c *gin.Context) {
+	peerID, ok := peerIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TTLSeconds   int  `json:"ttl_seconds"`
+		TTLAfterRead bool `json:"ttl_after_read"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	setting, err := h.Service.SetTTL(c.GetUint("user_id"), peerID, req.TTLSeconds, req.TTLAfterRead)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ttl_seconds":    setting.TTLSeconds,
+		"ttl_after_read": setting.TTLAfterRead,
+	})
+}
+
+// Mute отключает push-уведомления о сообщениях собеседника; без until — до отмены
+func (h *ConversationHandler) Mute(c *gin.Context) {
+	peerID, ok := peerIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Until *time.Time `json:"until"` // RFC 3339
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	mute, err := h.Service.Mute(c.GetUint("user_id"), peerID, req.Until)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"muted": true, "muted_until": mutedUntil(mute)})
+}
+
+func (h *ConversationHandler) Unmute(c *gin.Context) {
+	peerID, ok := peerIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Unmute(c.GetUint("user_id"), peerID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"muted": false, "muted_until": nil})
+}
+
+func mutedUntil(mute *models.ConversationMute) *time.Time {
+	if mute == nil {
+		return nil
+	}
+	return mute.MutedUntil
+}
+
+func peerIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("peer_id"), 10, 64)
+	if err != nil || id == 0 {
+		abortWithError(c, invalidParam("peer_id", "positive_integer", ""))
+		return 0, false
+	}
+	return uint(id), true
+}
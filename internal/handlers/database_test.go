@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"secure-messenger/config"
+)
+
+func TestSQLiteFileBackend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default().DB
+	cfg.Driver = config.DriverSQLite
+	cfg.Path = filepath.Join(t.TempDir(), "data", "messenger.db") // каталог создаётся при открытии
+	db := openTestDB(cfg)
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	var journalMode string
+	assert.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "wal", journalMode)
+
+	router := setupMessagingRouter(t, db)
+	sender, senderToken := createTestUser(t, db, "sqlite-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "sqlite-receiver@example.com")
+
+	msgID := sendTestMessage(t, router, db, senderToken, receiver.ID, "stored on disk")
+	msgs := listMessages(t, router, receiverToken)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "stored on disk", msgs[0]["Content"])
+
+	w := doJSON(router, http.MethodPost, "/api/messages/read", receiverToken,
+		fmt.Sprintf(`{"peer_id": %d, "up_to_id": %d}`, sender.ID, msgID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "read", listMessages(t, router, senderToken)[0]["Status"])
+
+	// Переоткрываем базу — данные пережили закрытие соединений
+	assert.NoError(t, sqlDB.Close())
+	db = openTestDB(cfg)
+	reopened, err := db.DB()
+	assert.NoError(t, err)
+	t.Cleanup(func() { reopened.Close() })
+	var count int64
+	assert.NoError(t, db.Table("messages").Where("sender_id = ?", sender.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestDatabaseConfigValidation(t *testing.T) {
+	cfg := config.Default()
+	cfg.Security.JWTSecret = "secret"
+	cfg.Security.AESKey = "0123456789abcdef"
+
+	// Postgres без параметров подключения
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "DB_HOST: is required")
+	assert.ErrorContains(t, err, "DB_NAME: is required")
+
+	// Готовая строка подключения заменяет отдельные поля
+	cfg.DB.DSN = "postgres://user@localhost/messenger?sslmode=verify-full"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.DB = config.Default().DB
+	cfg.DB.Driver = config.DriverSQLite
+	assert.ErrorContains(t, cfg.Validate(), "DB_PATH: is required for sqlite")
+	cfg.DB.Path = config.SQLiteMemory
+	assert.NoError(t, cfg.Validate())
+
+	cfg.DB.Driver = "mysql"
+	cfg.DB.MaxOpenConns = -1
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, `DB_DRIVER: unknown driver "mysql"`)
+	assert.ErrorContains(t, err, "DB_MAX_OPEN_CONNS: must not be negative")
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/services"
+)
+
+// UserHandler — каталог пользователей и публичные профили
+type UserHandler struct {
+	Service *services.UserService
+}
+
+func NewUserHandler(s *services.UserService) *UserHandler {
+	return &UserHandler{Service: s}
+}
+
+// SearchUsers ищет по началу имени (?q=ali) или по точному email (?q=alice@example.com)
+func (h *UserHandler) SearchUsers(c *gin.Context) {
+	limit, beforeID, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	users, err := h.Service.Search(c.GetUint("user_id"), c.Query("q"), beforeID, limit+1)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "has_more": hasMore})
+}
+
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	profile, err := h.Service.GetProfile(c.GetUint("user_id"), userID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateProfile меняет публичные поля профиля текущего пользователя
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	var req struct {
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		StatusText  *string `json:"status_text"`
+		AvatarID    *string `json:"avatar_id"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	profile, err := h.Service.UpdateProfile(c.GetUint("user_id"), services.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+		StatusText:  req.StatusText,
+		AvatarID:    req.AvatarID,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
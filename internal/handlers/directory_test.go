@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+)
+
+type userSearchResponse struct {
+	Users   []services.PublicProfile `json:"users"`
+	HasMore bool                     `json:"has_more"`
+}
+
+func searchUsers(t *testing.T, router *gin.Engine, token, query string) userSearchResponse {
+	w := doJSON(router, http.MethodGet, "/api/users/search?"+query, token, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp userSearchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestUserDirectorySearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	viewer, viewerToken := createTestUser(t, db, "dirviewer@example.com")
+	first, _ := createTestUser(t, db, "dirzed-one@example.com")
+	second, _ := createTestUser(t, db, "dirzed-two@example.com")
+	hidden, hiddenToken := createTestUser(t, db, "dirzed-hidden@example.com")
+	blocker, blockerToken := createTestUser(t, db, "dirzed-blocker@example.com")
+
+	w := doJSON(router, http.MethodPatch, "/api/profile/settings", hiddenToken, `{"discoverable": false}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/blocks", blockerToken, fmt.Sprintf(`{"user_id": %d}`, viewer.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Скрытые и заблокировавшие не находятся; новые — первыми
+	resp := searchUsers(t, router, viewerToken, "q=DirZed")
+	assert.Len(t, resp.Users, 2)
+	assert.Equal(t, second.ID, resp.Users[0].ID)
+	assert.Equal(t, first.ID, resp.Users[1].ID)
+
+	resp = searchUsers(t, router, viewerToken, "q=dirzed&limit=1")
+	assert.Len(t, resp.Users, 1)
+	assert.True(t, resp.HasMore)
+	resp = searchUsers(t, router, viewerToken, fmt.Sprintf("q=dirzed&limit=1&before_id=%d", resp.Users[0].ID))
+	assert.Equal(t, first.ID, resp.Users[0].ID)
+	assert.False(t, resp.HasMore)
+
+	// Email — только точное совпадение, и сам email в выдаче не раскрывается
+	resp = searchUsers(t, router, viewerToken, "q=dirzed-one@example.com")
+	assert.Len(t, resp.Users, 1)
+	assert.NotContains(t, doJSON(router, http.MethodGet, "/api/users/search?q=dirzed-one@example.com", viewerToken, "").Body.String(), "example.com")
+	assert.Empty(t, searchUsers(t, router, viewerToken, "q=dirzed-hidden@example.com").Users)
+	assert.Empty(t, searchUsers(t, router, viewerToken, "q=dirzed%25").Users)
+
+	w = doJSON(router, http.MethodGet, "/api/users/search?q=d", viewerToken, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Профиль по ID доступен и скрытому из поиска, но не заблокировавшему
+	w = doJSON(router, http.MethodGet, fmt.Sprintf("/api/users/%d", hidden.ID), viewerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodGet, fmt.Sprintf("/api/users/%d", blocker.ID), viewerToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPublicProfileAndAvatar(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	owner, ownerToken := createTestUser(t, db, "avatar-owner@example.com")
+	_, viewerToken := createTestUser(t, db, "avatar-viewer@example.com")
+
+	w := doJSON(router, http.MethodPatch, "/api/profile", ownerToken,
+		`{"display_name": "  Owner  ", "bio": "hello there", "status_text": "busy"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var profile services.PublicProfile
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+	assert.Equal(t, "Owner", profile.DisplayName)
+	assert.Nil(t, profile.AvatarID)
+
+	w = doJSON(router, http.MethodPatch, "/api/profile", ownerToken,
+		fmt.Sprintf(`{"status_text": %q}`, strings.Repeat("я", services.MaxStatusTextLength+1)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Аватар — загруженное изображение
+	avatar := []byte("\x89PNG fake image")
+	w = doJSON(router, http.MethodPost, "/api/attachments", ownerToken,
+		fmt.Sprintf(`{"file_name": "me.png", "mime_type": "image/png", "size": %d}`, len(avatar)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var upload models.Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+
+	// Недогруженный файл аватаром быть не может
+	w = doJSON(router, http.MethodPatch, "/api/profile", ownerToken, fmt.Sprintf(`{"avatar_id": %q}`, upload.ID))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusOK, uploadChunk(router, ownerToken, upload.ID, 0, avatar).Code)
+	w = doJSON(router, http.MethodPatch, "/api/profile", ownerToken, fmt.Sprintf(`{"avatar_id": %q}`, upload.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(router, http.MethodGet, fmt.Sprintf("/api/users/%d", owner.ID), viewerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+	assert.Equal(t, "hello there", profile.Bio)
+	assert.Equal(t, upload.ID, *profile.AvatarID)
+
+	w = doJSON(router, http.MethodGet, "/api/attachments/"+upload.ID+"/content", viewerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, avatar, w.Body.Bytes())
+
+	// Сборщик мусора не трогает аватар, хотя он не прикреплён к сообщению
+	garbage, err := repository.NewAttachmentRepository(db).FindGarbage(time.Now().Add(time.Hour), 1000)
+	assert.NoError(t, err)
+	for _, a := range garbage {
+		assert.NotEqual(t, upload.ID, a.ID)
+	}
+
+	// Аватар нельзя отправить в сообщении
+	receiver, _ := createTestUser(t, db, "avatar-receiver@example.com")
+	w = doJSON(router, http.MethodPost, "/api/messages/send", ownerToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "me", "attachment_ids": [%q]}`, receiver.ID, upload.ID))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// После снятия аватар снова обычная неприкреплённая загрузка
+	w = doJSON(router, http.MethodPatch, "/api/profile", ownerToken, `{"avatar_id": ""}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodGet, "/api/attachments/"+upload.ID+"/content", viewerToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"secure-messenger/internal/services"
+	"secure-messenger/pkg/apperror"
+	"secure-messenger/pkg/i18n"
+)
+
+// ProblemContentType — тип ответа с ошибкой по RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix + код ошибки — значение поля type
+const ProblemTypePrefix = "urn:secure-messenger:error:"
+
+var (
+	errMalformedBody         = apperror.New(apperror.KindInvalid, "malformed_body", "request body is not valid JSON")
+	errAuthorizationRequired = apperror.New(apperror.KindUnauthorized, "authorization_required", "authorization header missing or malformed")
+	errRouteNotFound         = apperror.New(apperror.KindNotFound, "route_not_found", "route not found")
+)
+
+// Problem — тело ответа с ошибкой. Клиенты ветвятся по code; detail и title — для человека.
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      string                `json:"code"`
+	Errors    []apperror.FieldError `json:"errors,omitempty"`
+	RequestID string                `json:"request_id,omitempty"`
+}
+
+func init() {
+	// В подробностях проверки поля называются так же, как в JSON запроса
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// ErrorMiddleware превращает ошибку, переданную обработчиком через abortWithError,
+// в ответ problem+json. Причина внутренних ошибок клиенту не отдаётся — она остаётся
+// в c.Errors и попадает в журнал доступа и трассировку.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		last := c.Errors.Last()
+		if last == nil || c.Writer.Written() {
+			return
+		}
+		writeProblem(c, apperror.From(last.Err))
+	}
+}
+
+// NoRoute отвечает на запросы к несуществующим маршрутам в том же формате
+func NoRoute(c *gin.Context) {
+	abortWithError(c, errRouteNotFound)
+}
+
+// abortWithError прерывает обработку запроса; ответ формирует ErrorMiddleware
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// writeProblem отвечает ошибкой e; title, detail и сообщения по полям — на языке запроса
+func writeProblem(c *gin.Context, e *apperror.Error) {
+	status := e.Status()
+	lang := requestLocale(c)
+	fields := make([]apperror.FieldError, len(e.Fields))
+	for i, f := range e.Fields {
+		f.Message = i18n.T(lang, "validation."+f.Code, f.Message, f.Param)
+		fields[i] = f
+	}
+
+	setLanguage(c, lang)
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(status, Problem{
+		Type:      ProblemTypePrefix + e.Code,
+		Title:     i18n.T(lang, fmt.Sprintf("title.%d", status), http.StatusText(status), ""),
+		Status:    status,
+		Detail:    i18n.T(lang, "error."+e.Code, e.Message, ""),
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		Errors:    fields,
+		RequestID: c.GetString("request_id"),
+	})
+}
+
+// bindJSON разбирает тело запроса в obj. При ошибке запрос прерывается
+// с validation_failed (подробности по полям) или malformed_body.
+func bindJSON(c *gin.Context, obj any) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		abortWithError(c, bindingError(err))
+		return false
+	}
+	return true
+}
+
+func bindingError(err error) error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]apperror.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, fieldError(fe))
+		}
+		return apperror.ErrValidation.WithFields(fields...).Wrap(err)
+	case errors.As(err, &typeErr):
+		return apperror.ErrValidation.WithFields(newFieldError(typeErr.Field, "type", jsonType(typeErr.Type))).Wrap(err)
+	default:
+		return errMalformedBody.Wrap(err)
+	}
+}
+
+func fieldError(fe validator.FieldError) apperror.FieldError {
+	code := fe.Tag()
+	if (code == "min" || code == "max") && fe.Kind() == reflect.String {
+		code += "_length"
+	}
+	return newFieldError(fe.Field(), code, fe.Param())
+}
+
+// newFieldError заполняет Message английским текстом; перевод подставляет writeProblem
+func newFieldError(field, code, param string) apperror.FieldError {
+	return apperror.FieldError{
+		Field:   field,
+		Code:    code,
+		Param:   param,
+		Message: i18n.T(i18n.Default, "validation."+code, "is invalid", param),
+	}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// invalidParam — ошибка в параметре пути или строки запроса; code — правило из каталога validation.*
+func invalidParam(name, code, param string) error {
+	return apperror.ErrValidation.WithFields(newFieldError(name, code, param))
+}
+
+// userLookupError — ошибка поиска пользователя напрямую через gorm
+func userLookupError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return services.ErrUserNotFound
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+	"secure-messenger/pkg/apperror"
+)
+
+func decodeProblem(t *testing.T, body []byte) Problem {
+	var p Problem
+	assert.NoError(t, json.Unmarshal(body, &p))
+	return p
+}
+
+func TestErrorModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+	_, token := createTestUser(t, db, "errors-user@example.com")
+
+	// Отдельный роутер: регистрация, идентификатор запроса и ошибки без кода
+	plain := gin.New()
+	plain.Use(RequestIDMiddleware(), ErrorMiddleware())
+	plain.POST("/register", RegisterWithDB(db))
+	plain.GET("/internal", func(c *gin.Context) {
+		abortWithError(c, errors.New("dial postgres://app:hunter2@db failed"))
+	})
+	plain.NoRoute(NoRoute)
+
+	t.Run("validation details per field", func(t *testing.T) {
+		w := doJSON(plain, http.MethodPost, "/register", "", `{"name": "", "email": "not-an-email", "password": "123"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+		p := decodeProblem(t, w.Body.Bytes())
+		assert.Equal(t, "validation_failed", p.Code)
+		assert.Equal(t, ProblemTypePrefix+"validation_failed", p.Type)
+		assert.Equal(t, http.StatusBadRequest, p.Status)
+		assert.Equal(t, "Bad Request", p.Title)
+		assert.Equal(t, "/register", p.Instance)
+		assert.Equal(t, w.Header().Get(RequestIDHeader), p.RequestID)
+		assert.ElementsMatch(t, []apperror.FieldError{
+			{Field: "name", Code: "required", Message: "is required"},
+			{Field: "email", Code: "email", Message: "must be a valid email address"},
+			{Field: "password", Code: "min_length", Param: "6", Message: "must be at least 6 characters"},
+		}, p.Errors)
+		// Сырой вывод валидатора наружу не попадает
+		assert.NotContains(t, w.Body.String(), "Key:")
+	})
+
+	t.Run("malformed body and wrong types", func(t *testing.T) {
+		w := doJSON(plain, http.MethodPost, "/register", "", `{"name":`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "malformed_body", decodeProblem(t, w.Body.Bytes()).Code)
+
+		w = doJSON(router, http.MethodPost, "/api/contacts", token, `{"user_id": "seven"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		p := decodeProblem(t, w.Body.Bytes())
+		assert.Equal(t, "validation_failed", p.Code)
+		assert.Equal(t, []apperror.FieldError{{Field: "user_id", Code: "type", Param: "number", Message: "must be of type number"}}, p.Errors)
+
+		w = doJSON(router, http.MethodGet, "/api/messages/search?q=hi&limit=500", token, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		p = decodeProblem(t, w.Body.Bytes())
+		if assert.Len(t, p.Errors, 1) {
+			assert.Equal(t, "limit", p.Errors[0].Field)
+		}
+	})
+
+	t.Run("service sentinels map to codes and statuses", func(t *testing.T) {
+		cases := []struct {
+			method, url, token, body string
+			status                   int
+			code                     string
+		}{
+			{http.MethodPatch, "/api/messages/999999", token, `{"content": "x"}`, http.StatusNotFound, "message_not_found"},
+			{http.MethodGet, "/api/users/999999", token, "", http.StatusNotFound, "user_not_found"},
+			{http.MethodGet, "/api/messages/search?q=", token, "", http.StatusBadRequest, "empty_query"},
+			{http.MethodGet, "/api/messages", "", "", http.StatusUnauthorized, "authorization_required"},
+			{http.MethodGet, "/api/messages", "garbage", "", http.StatusUnauthorized, "invalid_access_token"},
+		}
+		for _, tc := range cases {
+			w := doJSON(router, tc.method, tc.url, tc.token, tc.body)
+			assert.Equal(t, tc.status, w.Code, tc.url)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"), tc.url)
+			p := decodeProblem(t, w.Body.Bytes())
+			assert.Equal(t, tc.code, p.Code, tc.url)
+			assert.Equal(t, tc.status, p.Status, tc.url)
+		}
+
+		email := "errors-taken@example.com"
+		payload := fmt.Sprintf(`{"name": "Taken", "email": %q, "password": "123456"}`, email)
+		assert.Equal(t, http.StatusCreated, doJSON(plain, http.MethodPost, "/register", "", payload).Code)
+		w := doJSON(plain, http.MethodPost, "/register", "", payload)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "email_taken", decodeProblem(t, w.Body.Bytes()).Code)
+	})
+
+	t.Run("internal errors are not disclosed", func(t *testing.T) {
+		w := doJSON(plain, http.MethodGet, "/internal", "", "")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		p := decodeProblem(t, w.Body.Bytes())
+		assert.Equal(t, "internal_error", p.Code)
+		assert.False(t, strings.Contains(w.Body.String(), "hunter2"))
+
+		w = doJSON(plain, http.MethodGet, "/no/such/route", "", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "route_not_found", decodeProblem(t, w.Body.Bytes()).Code)
+	})
+
+	t.Run("typed sentinels", func(t *testing.T) {
+		assert.True(t, errors.Is(services.ErrMessageNotFound, apperror.ErrNotFound))
+		assert.True(t, errors.Is(services.ErrBlocked, apperror.ErrForbidden))
+		assert.False(t, errors.Is(services.ErrMessageNotFound, services.ErrUserNotFound))
+		assert.False(t, errors.Is(services.ErrMessageNotFound, apperror.ErrForbidden))
+
+		wrapped := fmt.Errorf("send: %w", services.ErrIdempotencyConflict.Wrap(errors.New("unique violation")))
+		assert.True(t, errors.Is(wrapped, services.ErrIdempotencyConflict))
+		assert.Equal(t, "idempotency_conflict", apperror.From(wrapped).Code)
+		assert.Equal(t, http.StatusConflict, apperror.From(wrapped).Status())
+
+		_, err := repository.NewUserRepository(db).GetByID(999999)
+		assert.True(t, errors.Is(err, repository.ErrNotFound))
+		assert.True(t, errors.Is(err, apperror.ErrNotFound))
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	})
+}
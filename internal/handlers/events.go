@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/realtime"
+)
+
+// heartbeatInterval не даёт прокси закрыть простаивающее соединение
+const heartbeatInterval = 25 * time.Second
+
+// EventSource — откуда берутся события пользователя (services.PresenceService:
+// подписка на realtime.Hub с отметкой присутствия). ctx — контекст запроса.
+type EventSource interface {
+	Subscribe(ctx context.Context, userID uint) (<-chan realtime.Event, func())
+}
+
+// EventsHandler отдаёт события пользователя потоком Server-Sent Events
+func EventsHandler(source EventSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, cancel := source.Subscribe(c.Request.Context(), c.GetUint("user_id"))
+		defer cancel()
+		disableWriteTimeout(c)
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		// заголовки уходят сразу: клиент узнаёт, что подписка установлена, не дожидаясь первого события
+		c.Writer.WriteHeaderNow()
+		c.Writer.Flush()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case event, ok := <-events:
+				if !ok {
+					return false
+				}
+				c.SSEvent(event.Type, event.Data)
+				return true
+			case <-heartbeat.C:
+				c.SSEvent("ping", "")
+				return true
+			}
+		})
+	}
+}
+
+// disableWriteTimeout снимает WriteTimeout сервера с долгих ответов: потока событий
+// и скачивания больших вложений
+func disableWriteTimeout(c *gin.Context) {
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}) // httptest не поддерживает дедлайны
+}
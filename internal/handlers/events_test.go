@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+)
+
+// При остановке сервера hub закрывается первым, чтобы потоки событий не держали Shutdown
+func TestEventsStreamEndsOnHubClose(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	users := repository.NewUserRepository(db)
+	presence := services.NewPresenceService(users, services.NewContactService(repository.NewContactRepository(db), users), hub)
+	user, _ := createTestUser(t, db, "events-close@example.com")
+
+	router := gin.New()
+	router.GET("/events", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		EventsHandler(presence)(c)
+	})
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	stream, err := http.Get(srv.URL + "/events")
+	assert.NoError(t, err)
+	defer stream.Body.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.ReadAll(stream.Body)
+	}()
+	assert.Eventually(t, func() bool { return hub.Online(user.ID) }, time.Second, 10*time.Millisecond)
+
+	hub.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("events stream did not end after hub close")
+	}
+	assert.False(t, hub.Online(user.ID))
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"secure-messenger/internal/services"
+	"secure-messenger/internal/version"
+)
+
+type HealthHandler struct {
+	Health *services.HealthService
+}
+
+func NewHealthHandler(health *services.HealthService) *HealthHandler {
+	return &HealthHandler{Health: health}
+}
+
+// Healthz отвечает, пока процесс жив; зависимости не проверяются
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": services.HealthOK})
+}
+
+// Readyz — готов ли сервер принимать трафик: 503, если хоть одна проверка не прошла
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.Health.Ready(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != services.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
+
+func (h *HealthHandler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
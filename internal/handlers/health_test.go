@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"secure-messenger/internal/migrations"
+	"secure-messenger/internal/services"
+	"secure-messenger/internal/version"
+)
+
+type fakeRunner struct{ running atomic.Bool }
+
+func (r *fakeRunner) Running() bool { return r.running.Load() }
+
+func readiness(t *testing.T, router *gin.Engine) (int, services.Readiness) {
+	w := doJSON(router, http.MethodGet, "/readyz", "", "")
+	var report services.Readiness
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	migrator, err := migrations.New(db)
+	assert.NoError(t, err)
+
+	reaper := &fakeRunner{}
+	reaper.running.Store(true)
+	var slow atomic.Bool
+	health := services.NewHealthService(50 * time.Millisecond)
+	health.Add("database", services.DatabaseCheck(sqlDB))
+	health.Add("migrations", migrator.Check)
+	health.Add("keys", services.KeysCheck([]byte("0123456789abcdef"), testTokens))
+	health.Add("workers", services.WorkersCheck(map[string]services.Runner{"expiry reaper": reaper}))
+	health.Add("search", func(ctx context.Context) error {
+		if slow.Load() {
+			<-ctx.Done()
+		}
+		return nil
+	})
+
+	handler := NewHealthHandler(health)
+	router := gin.New()
+	router.GET("/healthz", handler.Healthz)
+	router.GET("/readyz", handler.Readyz)
+	router.GET("/version", handler.Version)
+
+	w := doJSON(router, http.MethodGet, "/healthz", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+
+	code, report := readiness(t, router)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, services.HealthOK, report.Status)
+	assert.Len(t, report.Checks, 5)
+	for name, check := range report.Checks {
+		assert.Equal(t, services.HealthOK, check.Status, name)
+	}
+
+	// Зависшая проверка обрывается по таймауту, остальные не страдают
+	slow.Store(true)
+	reaper.running.Store(false)
+	code, report = readiness(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, services.HealthFail, report.Status)
+	assert.Equal(t, services.HealthFail, report.Checks["search"].Status)
+	assert.Contains(t, report.Checks["search"].Error, "deadline exceeded")
+	assert.Equal(t, "not running: expiry reaper", report.Checks["workers"].Error)
+	assert.Equal(t, services.HealthOK, report.Checks["database"].Status)
+
+	// Во время остановки сервер не готов, даже если все проверки проходят
+	slow.Store(false)
+	reaper.running.Store(true)
+	health.SetDraining()
+	code, report = readiness(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, services.HealthFail, report.Checks["shutdown"].Status)
+	assert.Equal(t, services.HealthOK, report.Checks["database"].Status)
+	w = doJSON(router, http.MethodGet, "/healthz", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Версия, заданная при сборке
+	defer func(v, c string) { version.Version, version.Commit = v, c }(version.Version, version.Commit)
+	version.Version, version.Commit = "v1.2.3", "abc123"
+	w = doJSON(router, http.MethodGet, "/version", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var info version.Info
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, "abc123", info.Commit)
+	assert.NotEmpty(t, info.GoVersion)
+}
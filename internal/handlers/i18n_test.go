@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/pkg/apperror"
+	"secure-messenger/pkg/i18n"
+)
+
+func doJSONLang(router *gin.Engine, method, url, token, payload, acceptLanguage string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// Коды ошибок сервисов и репозиториев регистрируются при импорте их пакетов, поэтому
+// полноту переводов по всем кодам проверяем здесь; сами каталоги — в пакете i18n
+func TestErrorCodesTranslated(t *testing.T) {
+	for _, lang := range i18n.Languages() {
+		for _, code := range apperror.Codes() {
+			_, ok := i18n.Lookup(lang, "error."+code)
+			assert.True(t, ok, "%s: error.%s", lang, code)
+		}
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+	user, token := createTestUser(t, db, "i18n-user@example.com")
+
+	t.Run("accept-language", func(t *testing.T) {
+		w := doJSONLang(router, http.MethodGet, "/api/messages/999999/history", token, "", "ru-RU,ru;q=0.9,en;q=0.8")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "ru", w.Header().Get("Content-Language"))
+		p := decodeProblem(t, w.Body.Bytes())
+		assert.Equal(t, "message_not_found", p.Code) // код от языка не зависит
+		assert.Equal(t, "сообщение не найдено", p.Detail)
+		assert.Equal(t, "Не найдено", p.Title)
+
+		w = doJSONLang(router, http.MethodGet, "/api/messages/search?q=hi&limit=500", token, "", "ru")
+		p = decodeProblem(t, w.Body.Bytes())
+		if assert.Len(t, p.Errors, 1) {
+			assert.Equal(t, "range", p.Errors[0].Code)
+			assert.Equal(t, "допустимый диапазон: 1..100", p.Errors[0].Message)
+		}
+
+		// Неподдерживаемый язык и отсутствие заголовка — английский
+		for _, header := range []string{"de-DE,fr;q=0.5", ""} {
+			w = doJSONLang(router, http.MethodGet, "/api/messages/999999/history", token, "", header)
+			assert.Equal(t, "en", w.Header().Get("Content-Language"), header)
+			assert.Equal(t, "message not found", decodeProblem(t, w.Body.Bytes()).Detail, header)
+		}
+	})
+
+	t.Run("user preference", func(t *testing.T) {
+		w := doJSONLang(router, http.MethodPatch, "/api/profile/settings", token, `{"locale": "de"}`, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		p := decodeProblem(t, w.Body.Bytes())
+		if assert.Len(t, p.Errors, 1) {
+			assert.Equal(t, apperror.FieldError{Field: "locale", Code: "oneof", Param: "en ru", Message: "must be one of: en ru"}, p.Errors[0])
+		}
+
+		// Настройка важнее заголовка; ответ на само изменение уже на новом языке
+		w = doJSONLang(router, http.MethodPatch, "/api/profile/settings", token, `{"locale": "ru"}`, "en")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Настройки сохранены", resp["message"])
+
+		var stored models.User
+		assert.NoError(t, db.First(&stored, user.ID).Error)
+		assert.Equal(t, i18n.Russian, stored.Locale)
+
+		w = doJSONLang(router, http.MethodDelete, "/api/contacts/999999", token, "", "en-US")
+		assert.Equal(t, "ru", w.Header().Get("Content-Language"))
+		assert.Equal(t, "контакт не найден", decodeProblem(t, w.Body.Bytes()).Detail)
+
+		// Пустая строка возвращает выбор по Accept-Language
+		w = doJSONLang(router, http.MethodPatch, "/api/profile/settings", token, `{"locale": ""}`, "en")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Settings updated successfully", resp["message"])
+	})
+}
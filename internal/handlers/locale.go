@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/pkg/i18n"
+)
+
+const (
+	localeKey           = "locale"
+	userLocaleLookupKey = "user_locale_lookup"
+)
+
+// LocaleMiddleware позволяет учитывать язык из настроек пользователя. Настройка читается
+// из базы только когда нужен текст ответа (ошибка или системное сообщение), и только
+// для авторизованного запроса — AuthMiddleware к этому моменту уже отработал.
+func LocaleMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(userLocaleLookupKey, func(userID uint) string {
+			var user models.User
+			if err := db.WithContext(c.Request.Context()).Select("locale").Take(&user, userID).Error; err != nil {
+				return ""
+			}
+			return user.Locale
+		})
+		c.Next()
+	}
+}
+
+// requestLocale выбирает язык ответа: настройка пользователя, затем Accept-Language, затем английский
+func requestLocale(c *gin.Context) string {
+	if lang := c.GetString(localeKey); lang != "" {
+		return lang
+	}
+
+	var lang string
+	if lookup, ok := c.Get(userLocaleLookupKey); ok {
+		if userID := c.GetUint("user_id"); userID != 0 {
+			lang = lookup.(func(uint) string)(userID)
+		}
+	}
+	if !i18n.Supported(lang) {
+		lang = i18n.Match(c.GetHeader("Accept-Language"))
+	}
+	c.Set(localeKey, lang)
+	return lang
+}
+
+func setLanguage(c *gin.Context, lang string) {
+	c.Header("Content-Language", lang)
+	c.Writer.Header().Add("Vary", "Accept-Language")
+}
+
+// systemMessage возвращает текст системного сообщения message.<key> на языке запроса
+func systemMessage(c *gin.Context, key string) string {
+	lang := requestLocale(c)
+	setLanguage(c, lang)
+	return i18n.T(lang, "message."+key, key, "")
+}
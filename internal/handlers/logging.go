@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"secure-messenger/pkg/apperror"
+	"secure-messenger/pkg/logging"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса; принимается от клиента или прокси и возвращается в ответе
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware присваивает запросу идентификатор и кладёт его вместе с маршрутом
+// в контекст: логгер дописывает их к каждой записи этого запроса
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set("request_id", id)
+
+		info := &logging.RequestInfo{ID: id, Route: c.FullPath()}
+		c.Request = c.Request.WithContext(logging.WithRequest(c.Request.Context(), info))
+		c.Next()
+	}
+}
+
+// validRequestID пропускает только короткие идентификаторы из безопасных символов,
+// чтобы чужой заголовок не ломал разбор логов
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLogMiddleware пишет по записи на каждый запрос. Строка запроса не логируется:
+// в ней бывают поисковые фразы и другие пользовательские данные.
+func AccessLogMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// RecoveryMiddleware отвечает 500 на панику в обработчике и пишет её в лог со стеком
+func RecoveryMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logger.ErrorContext(c.Request.Context(), "panic recovered",
+			"panic", recovered,
+			"stack", string(debug.Stack()),
+		)
+		writeProblem(c, apperror.ErrInternal)
+	})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/pkg/logging"
+)
+
+// logEntries разбирает JSON-записи лога, по одной на строку
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry), scanner.Text())
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestStructuredLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.FormatJSON, "info")
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), AccessLogMiddleware(logger), RecoveryMiddleware(logger), ErrorMiddleware())
+	router.POST("/things/:id", AuthMiddleware(testTokens, ""), func(c *gin.Context) {
+		logger.InfoContext(c.Request.Context(), "thing updated",
+			"password", "hunter2",
+			"refresh_token", "rt-value",
+			"content", "top secret message",
+			"content_type", "text/plain",
+			"error", errors.New("upstream rejected Bearer abc.def.ghi"),
+		)
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	accessToken, err := testTokens.GenerateJWT(42, "user")
+	assert.NoError(t, err)
+
+	// Идентификатор от клиента возвращается и попадает во все записи запроса
+	req := httptest.NewRequest(http.MethodPost, "/things/7?q=private", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set(RequestIDHeader, "client-req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "client-req-1", w.Header().Get(RequestIDHeader))
+
+	entries := logEntries(t, &buf)
+	assert.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, "client-req-1", entry["request_id"])
+		assert.Equal(t, "/things/:id", entry["route"])
+		assert.Equal(t, float64(42), entry["user_id"])
+	}
+	assert.Equal(t, "thing updated", entries[0]["msg"])
+	assert.Equal(t, logging.Redacted, entries[0]["password"])
+	assert.Equal(t, logging.Redacted, entries[0]["refresh_token"])
+	assert.Equal(t, logging.Redacted, entries[0]["content"])
+	assert.Equal(t, "text/plain", entries[0]["content_type"])
+	assert.Equal(t, "upstream rejected "+logging.Redacted, entries[0]["error"])
+
+	assert.Equal(t, "request", entries[1]["msg"])
+	assert.Equal(t, "POST", entries[1]["method"])
+	assert.Equal(t, "/things/7", entries[1]["path"])
+	assert.Equal(t, float64(http.StatusNoContent), entries[1]["status"])
+
+	for _, secret := range []string{"hunter2", "rt-value", "top secret", "abc.def.ghi", accessToken, "private"} {
+		assert.NotContains(t, buf.String(), secret)
+	}
+
+	// Без заголовка или с недопустимым значением идентификатор генерируется
+	buf.Reset()
+	w = doJSON(router, http.MethodGet, "/panic", "", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	generated := w.Header().Get(RequestIDHeader)
+	assert.Len(t, generated, 32)
+
+	entries = logEntries(t, &buf)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "panic recovered", entries[0]["msg"])
+	assert.Equal(t, "boom", entries[0]["panic"])
+	assert.Equal(t, "ERROR", entries[1]["level"])
+	assert.Equal(t, generated, entries[1]["request_id"])
+	assert.Nil(t, entries[1]["user_id"])
+
+	req = httptest.NewRequest(http.MethodGet, "/unknown", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Len(t, w.Header().Get(RequestIDHeader), 32)
+
+	// Ошибки базы пишутся через тот же логгер без значений параметров
+	buf.Reset()
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+	db := setupTestDB()
+	assert.Error(t, db.Exec("SELECT * FROM no_such_table WHERE email = ?", "leak@example.com").Error)
+	entries = logEntries(t, &buf)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "database query failed", entries[0]["msg"])
+	assert.Contains(t, entries[0]["sql"], "email = ?")
+	assert.NotContains(t, buf.String(), "leak@example.com")
+}
+
+// Записи сервисов тоже несут идентификатор запроса, в котором возникли
+func TestServiceLogsCarryRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.FormatJSON, "info")
+	assert.NoError(t, err)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+	alice, aliceToken := createTestUser(t, db, "service-log-alice@example.com")
+	bob, _ := createTestUser(t, db, "service-log-bob@example.com")
+	id := sendTestMessage(t, router, db, aliceToken, bob.ID, "soon broken")
+	assert.NoError(t, db.Model(&models.Message{}).Where("id = ?", id).Update("content", "not a ciphertext").Error)
+
+	buf.Reset()
+	req := httptest.NewRequest(http.MethodGet, "/api/messages", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	req.Header.Set(RequestIDHeader, "service-req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var found bool
+	for _, entry := range logEntries(t, &buf) {
+		if entry["msg"] == "crypto: failed to decrypt message content" {
+			found = true
+			assert.Equal(t, "service-req-1", entry["request_id"])
+			assert.Equal(t, "/api/messages", entry["route"])
+			assert.Equal(t, float64(alice.ID), entry["user_id"])
+		}
+	}
+	assert.True(t, found, buf.String())
+}
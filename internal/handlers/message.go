@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"secure-messenger/internal/services"
 	"strconv"
+	"time"
 )
 
 type MessageHandler struct {
@@ -15,49 +17,299 @@ func NewMessageHandler(s *services.MessageService) *MessageHandler {
 	return &MessageHandler{Service: s}
 }
 
+// service привязывает сервис к контексту запроса: трасса и отмена запроса доходят до базы
+func (h *MessageHandler) service(c *gin.Context) *services.MessageService {
+	return h.Service.WithContext(c.Request.Context())
+}
+
 func (h *MessageHandler) SendMessage(c *gin.Context) {
 	var req struct {
-		ReceiverID uint   `json:"receiver_id"`
-		Content    string `json:"content"`
+		ReceiverID   uint   `json:"receiver_id"`
+		Content      string `json:"content"`
+		TTLSeconds   *int   `json:"ttl_seconds"`
+		TTLAfterRead bool   `json:"ttl_after_read"`
+
+		AttachmentIDs []string `json:"attachment_ids"`
+		ReplyToID     *uint    `json:"reply_to_id"`
+		ThreadRootID  *uint    `json:"thread_root_id"`
+
+		SendAt *time.Time `json:"send_at"` // RFC 3339; отложенная отправка
+
+		// Можно передать и заголовком Idempotency-Key
+		ClientMessageID string `json:"client_message_id"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+	if !bindJSON(c, &req) {
 		return
 	}
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		if req.ClientMessageID != "" && req.ClientMessageID != key {
+			abortWithError(c, invalidParam("client_message_id", "mismatch", "Idempotency-Key"))
+			return
+		}
+		req.ClientMessageID = key
+	}
 
 	userID := c.GetUint("user_id")
-	err := h.Service.SendMessage(userID, req.ReceiverID, req.Content) // ✅ key убран
+	opts := services.SendOptions{
+		TTLSeconds:    req.TTLSeconds,
+		TTLAfterRead:  req.TTLAfterRead,
+		AttachmentIDs: req.AttachmentIDs,
+		ReplyToID:     req.ReplyToID,
+		ThreadRootID:  req.ThreadRootID,
+		SendAt:        req.SendAt,
+
+		ClientMessageID: req.ClientMessageID,
+	}
+	if req.SendAt != nil {
+		scheduled, created, err := h.service(c).ScheduleMessage(userID, req.ReceiverID, req.Content, opts)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		markReplayed(c, created)
+		c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "message_scheduled"), "scheduled_message": scheduled})
+		return
+	}
+
+	message, created, err := h.service(c).SendMessage(userID, req.ReceiverID, req.Content, opts) // ✅ key убран
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send"})
+		abortWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "sent"})
+	markReplayed(c, created)
+	c.JSON(http.StatusOK, message)
+}
+
+// markReplayed помечает ответ на повторный запрос с уже использованным ключом идемпотентности
+func markReplayed(c *gin.Context, created bool) {
+	if !created {
+		c.Header("Idempotent-Replayed", "true")
+	}
 }
 
 func (h *MessageHandler) GetMessages(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
-	messages, err := h.Service.GetMessages(userID)
+	messages, err := h.service(c).GetMessages(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get messages"})
+		abortWithError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, messages)
 }
 
+func (h *MessageHandler) MarkRead(c *gin.Context) {
+	var req struct {
+		PeerID uint `json:"peer_id" binding:"required"`
+		UpToID uint `json:"up_to_id" binding:"required"`
+	}
+
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	updated, err := h.service(c).MarkRead(userID, req.PeerID, req.UpToID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated})
+}
+
+// DeleteMessage: ?scope=me (по умолчанию) скрывает сообщение у себя, ?scope=everyone — удаляет у всех
 func (h *MessageHandler) DeleteMessage(c *gin.Context) {
-	idStr := c.Param("id")
-	id, _ := strconv.Atoi(idStr)
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	var forEveryone bool
+	switch c.DefaultQuery("scope", "me") {
+	case "me":
+	case "everyone":
+		forEveryone = true
+	default:
+		abortWithError(c, invalidParam("scope", "oneof", "me everyone"))
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err := h.service(c).DeleteMessage(id, userID, forEveryone)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "message_deleted")})
+}
+
+func (h *MessageHandler) EditMessage(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
 	userID := c.GetUint("user_id")
+	message, err := h.service(c).EditMessage(id, userID, req.Content)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
 
-	err := h.Service.DeleteMessage(uint(id), userID)
+func (h *MessageHandler) GetHistory(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	versions, err := h.service(c).GetHistory(id, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
+		abortWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetThread: ?limit=50&before_id=<id> — страница ветки от новых к старым, внутри по возрастанию
+func (h *MessageHandler) GetThread(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+	limit, beforeID, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	messages, err := h.service(c).GetThread(id, userID, beforeID, limit+1)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// Запросили на одно больше, чтобы понять, есть ли ещё страницы
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[1:]
+	}
+	c.JSON(http.StatusOK, gin.H{"messages": messages, "has_more": hasMore})
+}
+
+// SearchMessages: ?q=слова&peer_id=<id>&limit=50&before_id=<id> — все слова должны встречаться в сообщении
+func (h *MessageHandler) SearchMessages(c *gin.Context) {
+	limit, beforeID, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	var peerID uint
+	if v := c.Query("peer_id"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			abortWithError(c, invalidParam("peer_id", "integer", ""))
+			return
+		}
+		peerID = uint(n)
+	}
+
+	userID := c.GetUint("user_id")
+	messages, err := h.service(c).SearchMessages(userID, c.Query("q"), peerID, beforeID, limit+1)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"messages": messages, "has_more": hasMore})
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+func pageParams(c *gin.Context) (limit int, beforeID uint, ok bool) {
+	limit = defaultPageSize
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxPageSize {
+			abortWithError(c, invalidParam("limit", "range", fmt.Sprintf("1..%d", maxPageSize)))
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if v := c.Query("before_id"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			abortWithError(c, invalidParam("before_id", "integer", ""))
+			return 0, 0, false
+		}
+		beforeID = uint(n)
+	}
+	return limit, beforeID, true
+}
+
+func (h *MessageHandler) AddReaction(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Emoji string `json:"emoji" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.service(c).AddReaction(id, c.GetUint("user_id"), req.Emoji); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "reaction_added")})
+}
+
+func (h *MessageHandler) RemoveReaction(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service(c).RemoveReaction(id, c.GetUint("user_id"), c.Param("emoji")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "reaction_removed")})
+}
+
+func messageIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		abortWithError(c, invalidParam("id", "positive_integer", ""))
+		return 0, false
+	}
+	return uint(id), true
 }
@@ -0,0 +1,619 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+	"secure-messenger/pkg/storage"
+)
+
+var testAESKey = []byte("mysecretaeskey12")
+
+func setupMessagingRouter(t *testing.T, db *gorm.DB) *gin.Engine {
+	return setupMessagingRouterWithHub(t, db, realtime.NewHub())
+}
+
+func setupMessagingRouterWithHub(t *testing.T, db *gorm.DB, hub *realtime.Hub) *gin.Engine {
+	return setupMessagingRouterWithPush(t, db, hub, nil)
+}
+
+// setupMessagingRouterWithPush — то же с провайдером push-уведомлений (nil — без уведомлений)
+func setupMessagingRouterWithPush(t *testing.T, db *gorm.DB, hub *realtime.Hub, provider services.PushProvider) *gin.Engine {
+	router := gin.Default()
+	router.Use(RequestIDMiddleware(), TracingMiddleware(), LocaleMiddleware(db), ErrorMiddleware())
+
+	messageRepo := repository.NewMessageRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	conversationRepo := repository.NewConversationRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	contactRepo := repository.NewContactRepository(db)
+	contactService := services.NewContactService(contactRepo, userRepo)
+	messageService := services.NewMessageService(
+		messageRepo,
+		userRepo,
+		conversationRepo,
+		attachmentRepo,
+		contactService,
+		repository.NewScheduledMessageRepository(db),
+		testAESKey,
+	)
+	messageService.Hub = hub
+	pushService := newTestPushService(db, hub, provider)
+	messageService.Push = pushService
+	messageHandler := NewMessageHandler(messageService)
+	conversationHandler := NewConversationHandler(services.NewConversationService(conversationRepo, userRepo))
+	contactHandler := NewContactHandler(contactService)
+	userHandler := NewUserHandler(services.NewUserService(userRepo, contactRepo, attachmentRepo))
+	presenceService := services.NewPresenceService(userRepo, contactService, hub)
+	presenceHandler := NewPresenceHandler(presenceService)
+	pushHandler := NewPushHandler(pushService)
+
+	attachmentStorage, err := storage.NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	attachmentHandler := NewAttachmentHandler(
+		services.NewAttachmentService(attachmentRepo, messageRepo, attachmentStorage, testAESKey),
+	)
+
+	api := router.Group("/api")
+	api.Use(AuthMiddleware(testTokens, ""), ActivityMiddleware(presenceService))
+	{
+		api.PATCH("/profile/settings", UpdateSettingsWithDB(db))
+		api.POST("/messages/send", messageHandler.SendMessage)
+		api.GET("/messages", messageHandler.GetMessages)
+		api.GET("/messages/search", messageHandler.SearchMessages)
+		api.GET("/messages/starred", messageHandler.ListStarred)
+		api.GET("/messages/scheduled", messageHandler.ListScheduled)
+		api.PATCH("/messages/scheduled/:id", messageHandler.UpdateScheduled)
+		api.DELETE("/messages/scheduled/:id", messageHandler.CancelScheduled)
+		api.POST("/messages/read", messageHandler.MarkRead)
+		api.PATCH("/messages/:id", messageHandler.EditMessage)
+		api.GET("/messages/:id/history", messageHandler.GetHistory)
+		api.GET("/messages/:id/thread", messageHandler.GetThread)
+		api.POST("/messages/:id/reactions", messageHandler.AddReaction)
+		api.DELETE("/messages/:id/reactions/:emoji", messageHandler.RemoveReaction)
+		api.POST("/messages/:id/pin", messageHandler.PinMessage)
+		api.DELETE("/messages/:id/pin", messageHandler.UnpinMessage)
+		api.POST("/messages/:id/star", messageHandler.StarMessage)
+		api.DELETE("/messages/:id/star", messageHandler.UnstarMessage)
+		api.DELETE("/messages/:id", messageHandler.DeleteMessage)
+
+		api.GET("/conversations/:peer_id/settings", conversationHandler.GetSettings)
+		api.PUT("/conversations/:peer_id/ttl", conversationHandler.SetTTL)
+		api.GET("/conversations/:peer_id/pins", messageHandler.ListPins)
+		api.POST("/conversations/:peer_id/typing", presenceHandler.SetTyping)
+		api.PUT("/conversations/:peer_id/mute", conversationHandler.Mute)
+		api.DELETE("/conversations/:peer_id/mute", conversationHandler.Unmute)
+
+		api.GET("/devices", pushHandler.ListDevices)
+		api.POST("/devices", pushHandler.RegisterDevice)
+		api.DELETE("/devices/:id", pushHandler.UnregisterDevice)
+
+		api.GET("/contacts", contactHandler.ListContacts)
+		api.POST("/contacts", contactHandler.AddContact)
+		api.DELETE("/contacts/:user_id", contactHandler.RemoveContact)
+		api.GET("/blocks", contactHandler.ListBlocked)
+		api.POST("/blocks", contactHandler.Block)
+		api.DELETE("/blocks/:user_id", contactHandler.Unblock)
+		api.GET("/message-requests", contactHandler.ListRequests)
+		api.POST("/message-requests/:id/accept", contactHandler.AcceptRequest)
+		api.POST("/message-requests/:id/decline", contactHandler.DeclineRequest)
+
+		api.GET("/users/search", userHandler.SearchUsers)
+		api.GET("/users/:user_id", userHandler.GetProfile)
+		api.GET("/users/:user_id/presence", presenceHandler.GetPresence)
+		api.PATCH("/profile", userHandler.UpdateProfile)
+
+		api.POST("/attachments", attachmentHandler.CreateUpload)
+		api.GET("/attachments/:id", attachmentHandler.GetAttachment)
+		api.PUT("/attachments/:id/chunks/:index", attachmentHandler.UploadChunk)
+		api.GET("/attachments/:id/content", attachmentHandler.Download)
+	}
+	return router
+}
+
+// createTestUser создаёт пользователя и возвращает его вместе с access token
+func createTestUser(t *testing.T, db *gorm.DB, email string) (models.User, string) {
+	user := models.User{
+		Name:         strings.Split(email, "@")[0],
+		Email:        email,
+		PasswordHash: "irrelevant",
+		Role:         "user",
+	}
+	assert.NoError(t, db.Create(&user).Error)
+
+	token, err := testTokens.GenerateJWT(user.ID, user.Role)
+	assert.NoError(t, err)
+	return user, token
+}
+
+func doJSON(router *gin.Engine, method, url, token, payload string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// sendTestMessage отправляет сообщение через API и возвращает его ID
+func sendTestMessage(t *testing.T, router *gin.Engine, db *gorm.DB, token string, receiverID uint, content string) uint {
+	w := doJSON(router, http.MethodPost, "/api/messages/send", token,
+		fmt.Sprintf(`{"receiver_id": %d, "content": %q}`, receiverID, content))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var msg services.MessageView
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &msg))
+	assert.NotZero(t, msg.ID)
+	return msg.ID
+}
+
+func listMessages(t *testing.T, router *gin.Engine, token string) []map[string]interface{} {
+	w := doJSON(router, http.MethodGet, "/api/messages", token, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestReadReceipts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	sender, senderToken := createTestUser(t, db, "receipts-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "receipts-receiver@example.com")
+
+	w := doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "hello"}`, receiver.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Получатель ещё не забирал сообщения
+	msgs := listMessages(t, router, senderToken)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "sent", msgs[0]["Status"])
+	msgID := uint(msgs[0]["ID"].(float64))
+
+	// Получатель загрузил список — сообщение доставлено
+	msgs = listMessages(t, router, receiverToken)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "hello", msgs[0]["Content"])
+	assert.Equal(t, "delivered", listMessages(t, router, senderToken)[0]["Status"])
+
+	w = doJSON(router, http.MethodPost, "/api/messages/read", receiverToken,
+		fmt.Sprintf(`{"peer_id": %d, "up_to_id": %d}`, sender.ID, msgID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	msgs = listMessages(t, router, senderToken)
+	assert.Equal(t, "read", msgs[0]["Status"])
+	assert.NotNil(t, msgs[0]["ReadAt"])
+
+	// Получатель отключил отчёты о прочтении — отправитель видит только доставку
+	w = doJSON(router, http.MethodPatch, "/api/profile/settings", receiverToken, `{"read_receipts": false}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	msgs = listMessages(t, router, senderToken)
+	assert.Equal(t, "delivered", msgs[0]["Status"])
+	assert.Nil(t, msgs[0]["ReadAt"])
+}
+
+func TestEditMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	_, senderToken := createTestUser(t, db, "edit-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "edit-receiver@example.com")
+
+	msgID := sendTestMessage(t, router, db, senderToken, receiver.ID, "helo")
+	url := fmt.Sprintf("/api/messages/%d", msgID)
+
+	// Редактировать может только отправитель
+	w := doJSON(router, http.MethodPatch, url, receiverToken, `{"content": "hacked"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(router, http.MethodPatch, url, senderToken, `{"content": "hello"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	msgs := listMessages(t, router, receiverToken)
+	assert.Equal(t, "hello", msgs[0]["Content"])
+	assert.Equal(t, true, msgs[0]["Edited"])
+
+	// Старая версия хранится в зашифрованном виде
+	var version models.MessageVersion
+	assert.NoError(t, db.Where("message_id = ?", msgID).First(&version).Error)
+	assert.True(t, version.Encrypted)
+	assert.NotEqual(t, "helo", version.Content)
+
+	w = doJSON(router, http.MethodGet, url+"/history", receiverToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 1)
+	assert.Equal(t, "helo", history[0]["Content"])
+
+	// Правка, основанная на устаревшей версии, не затирает чужую и не дублирует историю
+	var stale models.Message
+	assert.NoError(t, db.First(&stale, msgID).Error)
+	w = doJSON(router, http.MethodPatch, url, senderToken, `{"content": "hello!"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	err := repository.NewMessageRepository(db).UpdateContent(&stale, "lost", nil, time.Now())
+	assert.ErrorIs(t, err, repository.ErrStaleMessage)
+	var versions int64
+	db.Model(&models.MessageVersion{}).Where("message_id = ?", msgID).Count(&versions)
+	assert.Equal(t, int64(2), versions)
+	assert.Equal(t, "hello!", listMessages(t, router, receiverToken)[0]["Content"])
+
+	// Окно редактирования истекло
+	db.Model(&models.Message{}).Where("id = ?", msgID).Update("created_at", time.Now().Add(-time.Hour))
+	w = doJSON(router, http.MethodPatch, url, senderToken, `{"content": "too late"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Правка, начатая до удаления у всех, не возвращает текст и историю в затёртое сообщение
+	var beforeDelete models.Message
+	assert.NoError(t, db.First(&beforeDelete, msgID).Error)
+	assert.NoError(t, repository.NewMessageRepository(db).TombstoneMessage(msgID, time.Now()))
+	err = repository.NewMessageRepository(db).UpdateContent(&beforeDelete, "resurrected", []string{"token"}, time.Now())
+	assert.ErrorIs(t, err, repository.ErrDeletedMessage)
+	var tombstone models.Message
+	assert.NoError(t, db.First(&tombstone, msgID).Error)
+	assert.Empty(t, tombstone.Content)
+	db.Model(&models.MessageVersion{}).Where("message_id = ?", msgID).Count(&versions)
+	assert.Zero(t, versions)
+	var tokens int64
+	db.Model(&models.SearchToken{}).Where("message_id = ?", msgID).Count(&tokens)
+	assert.Zero(t, tokens)
+}
+
+func TestDeleteMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	_, senderToken := createTestUser(t, db, "delete-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "delete-receiver@example.com")
+	_, strangerToken := createTestUser(t, db, "delete-stranger@example.com")
+
+	hiddenID := sendTestMessage(t, router, db, senderToken, receiver.ID, "only for me")
+	tombID := sendTestMessage(t, router, db, senderToken, receiver.ID, "oops")
+
+	// Чужое сообщение — 404, несуществующее — тоже 404
+	w := doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d", hiddenID), strangerToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(router, http.MethodDelete, "/api/messages/999999", senderToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Получатель скрывает сообщение у себя — отправитель его по-прежнему видит
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d", hiddenID), receiverToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, listMessages(t, router, receiverToken), 1)
+	assert.Len(t, listMessages(t, router, senderToken), 2)
+
+	// Удалить у всех может только отправитель
+	url := fmt.Sprintf("/api/messages/%d?scope=everyone", tombID)
+	w = doJSON(router, http.MethodDelete, url, receiverToken, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(router, http.MethodDelete, url, senderToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	msgs := listMessages(t, router, receiverToken)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, true, msgs[0]["Deleted"])
+	assert.Equal(t, "", msgs[0]["Content"])
+
+	// Удаление у всех ограничено по времени
+	lateID := sendTestMessage(t, router, db, senderToken, receiver.ID, "old news")
+	db.Model(&models.Message{}).Where("id = ?", lateID).Update("created_at", time.Now().Add(-72*time.Hour))
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d?scope=everyone", lateID), senderToken, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestDisappearingMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	sender, senderToken := createTestUser(t, db, "ttl-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "ttl-receiver@example.com")
+
+	// Срок жизни из настроек переписки, отсчёт от прочтения
+	w := doJSON(router, http.MethodPut, fmt.Sprintf("/api/conversations/%d/ttl", sender.ID), receiverToken,
+		`{"ttl_seconds": 60, "ttl_after_read": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	afterReadID := sendTestMessage(t, router, db, senderToken, receiver.ID, "burn after reading")
+	var msg models.Message
+	db.First(&msg, afterReadID)
+	assert.Equal(t, 60, msg.TTLSeconds)
+	assert.Nil(t, msg.ExpiresAt)
+
+	w = doJSON(router, http.MethodPost, "/api/messages/read", receiverToken,
+		fmt.Sprintf(`{"peer_id": %d, "up_to_id": %d}`, sender.ID, afterReadID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.First(&msg, afterReadID)
+	assert.NotNil(t, msg.ExpiresAt)
+
+	// Явный срок жизни сообщения важнее настроек переписки
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "quick", "ttl_seconds": 5}`, receiver.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, listMessages(t, router, receiverToken), 2)
+
+	// Истёкшие, но ещё не удалённые сообщения не попадают в выдачу
+	db.Model(&models.Message{}).Where("receiver_id = ? AND ttl_seconds = 5", receiver.ID).
+		Update("expires_at", time.Now().Add(-time.Second))
+	assert.Len(t, listMessages(t, router, receiverToken), 1)
+
+	reaper := services.NewExpiryReaper(repository.NewMessageRepository(db), time.Minute, 1)
+	deleted, err := reaper.ReapOnce(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var count int64
+	db.Model(&models.Message{}).Where("receiver_id = ?", receiver.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Неположительные параметры не приводят к бесконечному циклу и панике тикера
+	fallback := services.NewExpiryReaper(repository.NewMessageRepository(db), 0, -1)
+	assert.Equal(t, services.DefaultReaperInterval, fallback.Interval)
+	assert.Equal(t, services.DefaultReaperBatchSize, fallback.BatchSize)
+	fallback.BatchSize = 0
+	_, err = fallback.ReapOnce(context.Background(), time.Now())
+	assert.Error(t, err)
+
+	w = doJSON(router, http.MethodPut, fmt.Sprintf("/api/conversations/%d/ttl", sender.ID), receiverToken,
+		`{"ttl_seconds": -1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRepliesAndThreads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	alice, aliceToken := createTestUser(t, db, "thread-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "thread-bob@example.com")
+	_, carolToken := createTestUser(t, db, "thread-carol@example.com")
+
+	rootID := sendTestMessage(t, router, db, aliceToken, bob.ID, "lunch?")
+	otherID := sendTestMessage(t, router, db, carolToken, alice.ID, "unrelated")
+
+	send := func(token string, receiverID uint, extra string) int {
+		return doJSON(router, http.MethodPost, "/api/messages/send", token,
+			fmt.Sprintf(`{"receiver_id": %d, "content": "reply", %s}`, receiverID, extra)).Code
+	}
+
+	// Ответ в основной ленте с цитатой
+	assert.Equal(t, http.StatusOK, send(bobToken, alice.ID, fmt.Sprintf(`"reply_to_id": %d`, rootID)))
+	// Нельзя сослаться на сообщение из другой переписки
+	assert.Equal(t, http.StatusBadRequest, send(bobToken, alice.ID, fmt.Sprintf(`"reply_to_id": %d`, otherID)))
+	assert.Equal(t, http.StatusBadRequest, send(aliceToken, bob.ID, fmt.Sprintf(`"reply_to_id": %d`, otherID)))
+	// Нельзя открыть ветку на сообщении, которое отправитель не видит
+	assert.Equal(t, http.StatusBadRequest, send(carolToken, alice.ID, fmt.Sprintf(`"thread_root_id": %d`, rootID)))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send(bobToken, alice.ID, fmt.Sprintf(`"thread_root_id": %d`, rootID)))
+	}
+
+	msgs := listMessages(t, router, aliceToken)
+	assert.Len(t, msgs, 3) // корень, сообщение Кэрол и ответ с цитатой; ветка в ленту не попадает
+	assert.Equal(t, float64(3), msgs[0]["ThreadReplyCount"])
+	quote := msgs[2]["ReplyTo"].(map[string]interface{})
+	assert.Equal(t, "lunch?", quote["Content"])
+
+	var page struct {
+		Messages []map[string]interface{} `json:"messages"`
+		HasMore  bool                     `json:"has_more"`
+	}
+	w := doJSON(router, http.MethodGet, fmt.Sprintf("/api/messages/%d/thread?limit=2", rootID), aliceToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Messages, 2)
+	assert.True(t, page.HasMore)
+
+	beforeID := uint(page.Messages[0]["ID"].(float64))
+	w = doJSON(router, http.MethodGet, fmt.Sprintf("/api/messages/%d/thread?limit=2&before_id=%d", rootID, beforeID), aliceToken, "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Messages, 1)
+	assert.False(t, page.HasMore)
+
+	w = doJSON(router, http.MethodGet, fmt.Sprintf("/api/messages/%d/thread", rootID), carolToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReactions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	router := setupMessagingRouterWithHub(t, db, hub)
+
+	sender, senderToken := createTestUser(t, db, "react-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "react-receiver@example.com")
+	_, strangerToken := createTestUser(t, db, "react-stranger@example.com")
+
+	msgID := sendTestMessage(t, router, db, senderToken, receiver.ID, "party tonight")
+	url := fmt.Sprintf("/api/messages/%d/reactions", msgID)
+
+	events, cancel := hub.Subscribe(sender.ID)
+	defer cancel()
+
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, url, receiverToken, `{"emoji": "🎉"}`).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, url, senderToken, `{"emoji": "🎉"}`).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, url, senderToken, `{"emoji": "👍🏽"}`).Code)
+
+	// Отправитель получает событие о реакции собеседника
+	select {
+	case event := <-events:
+		assert.Equal(t, services.EventReactionAdded, event.Type)
+		assert.Equal(t, receiver.ID, event.Data.(services.ReactionEvent).UserID)
+	default:
+		t.Fatal("expected reaction event")
+	}
+
+	// Реакции подчиняются тем же правилам видимости, что и сообщения
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodPost, url, strangerToken, `{"emoji": "😈"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, http.MethodPost, url, receiverToken, `{"emoji": "hello"}`).Code)
+
+	msgs := listMessages(t, router, receiverToken)
+	reactions := msgs[0]["Reactions"].([]interface{})
+	assert.Len(t, reactions, 2)
+	party := reactions[0].(map[string]interface{})
+	assert.Equal(t, "🎉", party["Emoji"])
+	assert.Equal(t, float64(2), party["Count"])
+	assert.Equal(t, true, party["ReactedByMe"])
+	assert.Equal(t, false, reactions[1].(map[string]interface{})["ReactedByMe"])
+
+	w := doJSON(router, http.MethodDelete, url+"/"+neturl.PathEscape("🎉"), receiverToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodDelete, url+"/"+neturl.PathEscape("🎉"), receiverToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Лимит разных реакций на сообщение
+	for _, emoji := range []string{"😀", "😁", "😂", "🤣", "😃", "😄", "😅", "😆", "😉", "😊",
+		"😋", "😎", "😍", "😘", "🥰", "😗", "😙", "😚"} {
+		assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, url, receiverToken,
+			fmt.Sprintf(`{"emoji": %q}`, emoji)).Code)
+	}
+	w = doJSON(router, http.MethodPost, url, receiverToken, `{"emoji": "🙂"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "too_many_reactions", decodeProblem(t, w.Body.Bytes()).Code)
+	// Уже поставленный вид эмодзи можно добавить и при исчерпанном лимите
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, url, senderToken, `{"emoji": "😀"}`).Code)
+}
+
+func TestSearchMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	alice, aliceToken := createTestUser(t, db, "search-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "search-bob@example.com")
+	_, carolToken := createTestUser(t, db, "search-carol@example.com")
+
+	pizzaID := sendTestMessage(t, router, db, aliceToken, bob.ID, "Let's order Pizza tonight!")
+	sendTestMessage(t, router, db, bobToken, alice.ID, "pizza again? fine")
+	sendTestMessage(t, router, db, carolToken, alice.ID, "Pizza tonight at my place")
+	sendTestMessage(t, router, db, carolToken, bob.ID, "secret pizza tonight")
+
+	search := func(token, query string) []map[string]interface{} {
+		w := doJSON(router, http.MethodGet, "/api/messages/search?"+query, token, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Messages []map[string]interface{} `json:"messages"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Messages
+	}
+
+	// Поисковые токены не совпадают с открытым текстом
+	var token models.SearchToken
+	assert.NoError(t, db.Where("message_id = ?", pizzaID).First(&token).Error)
+	assert.NotContains(t, []string{"pizza", "tonight", "order"}, token.Token)
+
+	assert.Len(t, search(aliceToken, "q=pizza"), 3)
+	assert.Len(t, search(aliceToken, "q=PIZZA+tonight"), 2)
+	assert.Len(t, search(aliceToken, fmt.Sprintf("q=pizza+tonight&peer_id=%d", bob.ID)), 1)
+	assert.Len(t, search(carolToken, "q=order"), 0)
+
+	page := search(aliceToken, "q=pizza&limit=2")
+	assert.Len(t, page, 2)
+	assert.Len(t, search(aliceToken, fmt.Sprintf("q=pizza&before_id=%d", uint(page[1]["ID"].(float64)))), 1)
+
+	// Индекс обновляется при редактировании и удалении
+	doJSON(router, http.MethodPatch, fmt.Sprintf("/api/messages/%d", pizzaID), aliceToken, `{"content": "let's order sushi"}`)
+	assert.Len(t, search(aliceToken, "q=sushi"), 1)
+	assert.Len(t, search(aliceToken, "q=pizza+order"), 0)
+
+	doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d?scope=everyone", pizzaID), aliceToken, "")
+	assert.Len(t, search(aliceToken, "q=sushi"), 0)
+
+	w := doJSON(router, http.MethodGet, "/api/messages/search?q=!", aliceToken, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIdempotentSend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	_, senderToken := createTestUser(t, db, "idempotent-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "idempotent-receiver@example.com")
+	other, _ := createTestUser(t, db, "idempotent-other@example.com")
+
+	send := func(body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/messages/send", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+senderToken)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	body := fmt.Sprintf(`{"receiver_id": %d, "content": "only once"}`, receiver.ID)
+
+	w := send(body, "retry-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	var first services.MessageView
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.Equal(t, "only once", first.Content)
+	assert.Equal(t, "retry-1", *first.ClientMessageID)
+
+	// Повтор (заголовком или полем тела) возвращает то же сообщение, дубль не создаётся
+	w = send(body, "retry-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	var retried services.MessageView
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &retried))
+	assert.Equal(t, first.ID, retried.ID)
+	assert.True(t, first.CreatedAt.Equal(retried.CreatedAt))
+
+	w = send(fmt.Sprintf(`{"receiver_id": %d, "content": "only once", "client_message_id": "retry-1"}`, receiver.ID), "")
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Len(t, listMessages(t, router, receiverToken), 1)
+
+	// Тот же ключ для другого получателя или текста — ошибка клиента
+	assert.Equal(t, http.StatusConflict, send(fmt.Sprintf(`{"receiver_id": %d, "content": "only once"}`, other.ID), "retry-1").Code)
+	assert.Equal(t, http.StatusConflict, send(fmt.Sprintf(`{"receiver_id": %d, "content": "changed"}`, receiver.ID), "retry-1").Code)
+
+	// Ключ уникален только в пределах отправителя
+	w = doJSON(router, http.MethodPost, "/api/messages/send", receiverToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "reply", "client_message_id": "retry-1"}`, first.SenderID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, send(fmt.Sprintf(`{"receiver_id": %d, "content": "x", "client_message_id": "a"}`, receiver.ID), "b").Code)
+	assert.Equal(t, http.StatusBadRequest, send(body, "has space").Code)
+	assert.Equal(t, http.StatusBadRequest, send(body, strings.Repeat("k", services.MaxClientMessageIDLength+1)).Code)
+
+	// Отложенная отправка тоже идемпотентна
+	sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	scheduled := fmt.Sprintf(`{"receiver_id": %d, "content": "later", "send_at": %q}`, receiver.ID, sendAt)
+	assert.Equal(t, http.StatusOK, send(scheduled, "later-1").Code)
+	w = send(scheduled, "later-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	list := listScheduled(t, router, senderToken)
+	assert.Len(t, list, 1)
+	assert.Equal(t, http.StatusConflict, send(body, "later-1").Code)
+
+	// Не оставляем сообщение планировщикам других тестов
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/scheduled/%d", list[0].ID), senderToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
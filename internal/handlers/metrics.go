@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"secure-messenger/internal/metrics"
+)
+
+// MetricsMiddleware считает запросы и их длительность по шаблону маршрута (/api/messages/:id),
+// а не по фактическому пути, чтобы число рядов не зависело от идентификаторов в URL
+func MetricsMiddleware(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		method, route := c.Request.Method, c.FullPath()
+		if route == "" {
+			// Неизвестные пути и методы приходят от клиента — сводим их в один ряд
+			method, route = "other", "unmatched"
+		}
+		m.ObserveRequest(method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// MetricsHandler отдаёт метрики; с непустым token требует Authorization: Bearer <token>
+func MetricsHandler(m *metrics.Metrics, token string) http.Handler {
+	next := m.Handler()
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
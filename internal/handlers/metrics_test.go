@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"secure-messenger/internal/metrics"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+)
+
+const testMetricsToken = "scrape-token"
+
+func scrapeMetrics(t *testing.T, router *gin.Engine) string {
+	w := doJSON(router, http.MethodGet, "/metrics", testMetricsToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+
+	m := metrics.New()
+	m.RegisterDB(sqlDB, "test")
+	hub := realtime.NewHub()
+	m.RegisterGauge("realtime_connections", "Open realtime event streams.", func() float64 {
+		return float64(hub.ConnectionCount())
+	})
+	_, cancel := hub.Subscribe(1)
+	defer cancel()
+
+	tokens := services.NewTokenService("testsecret", time.Hour, time.Hour)
+	tokens.Metrics = m
+	userRepo := repository.NewUserRepository(db)
+	messageService := services.NewMessageService(
+		repository.NewMessageRepository(db),
+		userRepo,
+		repository.NewConversationRepository(db),
+		repository.NewAttachmentRepository(db),
+		services.NewContactService(repository.NewContactRepository(db), userRepo),
+		repository.NewScheduledMessageRepository(db),
+		testAESKey,
+	)
+	messageService.Metrics = m
+	messageHandler := NewMessageHandler(messageService)
+
+	router := gin.Default()
+	router.Use(MetricsMiddleware(m), ErrorMiddleware())
+	router.GET("/metrics", gin.WrapH(MetricsHandler(m, testMetricsToken)))
+	router.POST("/api/login", LoginWithDB(db, tokens))
+	router.POST("/api/refresh", RefreshWithDB(db, tokens))
+	api := router.Group("/api", AuthMiddleware(tokens, ""))
+	api.POST("/messages/send", messageHandler.SendMessage)
+	api.GET("/messages", messageHandler.GetMessages)
+	api.POST("/messages/read", messageHandler.MarkRead)
+
+	// Без токена метрики не отдаются
+	assert.Equal(t, http.StatusUnauthorized, doJSON(router, http.MethodGet, "/metrics", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, doJSON(router, http.MethodGet, "/metrics", "wrong", "").Code)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("metrics-password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	sender := models.User{Name: "metrics", Email: "metrics-sender@example.com", PasswordHash: string(hashed), Role: "user"}
+	assert.NoError(t, db.Create(&sender).Error)
+	receiver, receiverToken := createTestUser(t, db, "metrics-receiver@example.com")
+	stranger, _ := createTestUser(t, db, "metrics-stranger@example.com")
+
+	// Вход: одна неудача и один успех
+	w := doJSON(router, http.MethodPost, "/api/login", "", `{"email": "metrics-sender@example.com", "password": "wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/login", "", `{"email": "metrics-sender@example.com", "password": "metrics-password"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	senderToken, err := tokens.GenerateJWT(sender.ID, sender.Role)
+	assert.NoError(t, err)
+	msgID := sendTestMessage(t, router, db, senderToken, receiver.ID, "hello metrics")
+
+	// Запись, которую не расшифровать, больше не проглатывается молча
+	broken := models.Message{SenderID: stranger.ID, ReceiverID: receiver.ID, Content: "not-a-ciphertext", Encrypted: true}
+	assert.NoError(t, db.Create(&broken).Error)
+	assert.Len(t, listMessages(t, router, receiverToken), 2)
+
+	w = doJSON(router, http.MethodPost, "/api/messages/read", receiverToken,
+		fmt.Sprintf(`{"peer_id": %d, "up_to_id": %d}`, sender.ID, msgID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Обмен refresh token: удачный и с уже использованным токеном
+	refreshToken, err := tokens.GenerateRefreshToken(db, sender.ID)
+	assert.NoError(t, err)
+	w = doJSON(router, http.MethodPost, "/api/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, refreshToken))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, refreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Параллельный обмен тем же токеном успел удалить его между проверкой и удалением
+	raced, err := tokens.GenerateRefreshToken(db, sender.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Callback().Delete().Before("gorm:delete").Register("test:concurrent_refresh", func(tx *gorm.DB) {
+		tx.Session(&gorm.Session{NewDB: true}).Exec("DELETE FROM refresh_tokens WHERE token = ?", raced)
+	}))
+	w = doJSON(router, http.MethodPost, "/api/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, raced))
+	assert.NoError(t, db.Callback().Delete().Remove("test:concurrent_refresh"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "refresh_token_reused", decodeProblem(t, w.Body.Bytes()).Code)
+	assert.NotContains(t, w.Body.String(), "access_token")
+
+	doJSON(router, http.MethodGet, "/no-such-route/42", "", "")
+
+	body := scrapeMetrics(t, router)
+	for _, line := range []string{
+		`secure_messenger_auth_logins_total{result="failure"} 1`,
+		`secure_messenger_auth_logins_total{result="success"} 1`,
+		`secure_messenger_auth_refreshes_total{result="failure"} 2`,
+		`secure_messenger_auth_refreshes_total{result="success"} 1`,
+		`secure_messenger_auth_refresh_reuse_total 1`,
+		`secure_messenger_messages_sent_total 1`,
+		`secure_messenger_messages_read_total 1`,
+		`secure_messenger_crypto_errors_total{operation="decrypt"} 1`,
+		`secure_messenger_crypto_errors_total{operation="encrypt"} 0`,
+		`secure_messenger_realtime_connections 1`,
+		`secure_messenger_http_requests_total{method="POST",route="/api/login",status="401"} 1`,
+		`secure_messenger_http_requests_total{method="POST",route="/api/refresh",status="401"} 2`,
+		`secure_messenger_http_requests_total{method="other",route="unmatched",status="404"} 1`,
+		`secure_messenger_http_request_duration_seconds_count{method="GET",route="/api/messages",status="200"} 1`,
+		`go_sql_max_open_connections{db_name="test"}`,
+	} {
+		assert.Contains(t, body, line)
+	}
+	// Маршрут учитывается по шаблону, а не по фактическому пути
+	assert.NotContains(t, body, "/no-such-route/42")
+	assert.False(t, strings.Contains(body, "hello metrics"))
+}
@@ -1,58 +1,54 @@
 package handlers
 
 import (
-	"fmt"
-	"net/http"
-	"secure-messenger/config"
 	"secure-messenger/internal/services"
+	"secure-messenger/pkg/logging"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(requiredRole string) gin.HandlerFunc {
+func AuthMiddleware(tokens *services.TokenService, requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
-			c.Abort()
+			abortWithError(c, errAuthorizationRequired)
 			return
 		}
 
 		// "Bearer <token>" → "<token>"
 		const prefix = "Bearer "
 		if len(tokenString) <= len(prefix) || tokenString[:len(prefix)] != prefix {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			abortWithError(c, errAuthorizationRequired)
 			return
 		}
 		tokenString = tokenString[len(prefix):]
 
-		// Парсим токен с кастомными claims
-		claims := &services.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret), nil
-		})
-		fmt.Printf("%+v\n", claims)
-		fmt.Printf("%+v\n", token.Valid)
-		fmt.Printf("%+v\n", err)
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+		claims, err := tokens.ParseJWT(tokenString)
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
 
 		// Проверка роли (если требуется)
 		if requiredRole != "" && claims.Role != requiredRole {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-			c.Abort()
+			abortWithError(c, services.ErrInsufficientRole)
 			return
 		}
 
 		// Передаём user_id и role дальше
+		logging.SetUserID(c.Request.Context(), claims.UserID)
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
 		c.Next()
 	}
 }
+
+// ActivityMiddleware отмечает активность авторизованного пользователя для статуса присутствия
+func ActivityMiddleware(presence *services.PresenceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := c.GetUint("user_id"); userID != 0 {
+			presence.Touch(c.Request.Context(), userID)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *MessageHandler) PinMessage(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.service(c).PinMessage(id, c.GetUint("user_id")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "message_pinned")})
+}
+
+func (h *MessageHandler) UnpinMessage(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.service(c).UnpinMessage(id, c.GetUint("user_id")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "message_unpinned")})
+}
+
+// ListPins — закреплённые сообщения переписки, последние закреплённые первыми
+func (h *MessageHandler) ListPins(c *gin.Context) {
+	peerID, ok := peerIDParam(c)
+	if !ok {
+		return
+	}
+	pins, err := h.service(c).ListPins(c.GetUint("user_id"), peerID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pins": pins})
+}
+
+func (h *MessageHandler) StarMessage(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.service(c).StarMessage(id, c.GetUint("user_id")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "message_starred")})
+}
+
+func (h *MessageHandler) UnstarMessage(c *gin.Context) {
+	id, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.service(c).UnstarMessage(id, c.GetUint("user_id")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "message_unstarred")})
+}
+
+// ListStarred: ?limit=50&before_id=<id> — избранное из всех переписок, от новых сообщений к старым
+func (h *MessageHandler) ListStarred(c *gin.Context) {
+	limit, beforeID, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	messages, err := h.service(c).ListStarred(c.GetUint("user_id"), beforeID, limit+1)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"messages": messages, "has_more": hasMore})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+)
+
+func listPins(t *testing.T, router *gin.Engine, token string, peerID uint) []services.PinnedMessage {
+	w := doJSON(router, http.MethodGet, fmt.Sprintf("/api/conversations/%d/pins", peerID), token, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Pins []services.PinnedMessage `json:"pins"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Pins
+}
+
+type starredPage struct {
+	Messages []services.MessageView `json:"messages"`
+	HasMore  bool                   `json:"has_more"`
+}
+
+func listStarred(t *testing.T, router *gin.Engine, token, query string) starredPage {
+	w := doJSON(router, http.MethodGet, "/api/messages/starred"+query, token, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var page starredPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	return page
+}
+
+func TestPinnedMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	router := setupMessagingRouterWithHub(t, db, hub)
+
+	alice, aliceToken := createTestUser(t, db, "pin-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "pin-bob@example.com")
+	_, carolToken := createTestUser(t, db, "pin-carol@example.com")
+
+	events, cancel := hub.Subscribe(alice.ID)
+	defer cancel()
+
+	first := sendTestMessage(t, router, db, aliceToken, bob.ID, "meeting at 10")
+	pinURL := fmt.Sprintf("/api/messages/%d/pin", first)
+
+	// Закрепить может любой участник, собеседник получает событие
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, pinURL, bobToken, "").Code)
+	event := nextEvent(t, events, time.Second)
+	assert.Equal(t, services.EventPinAdded, event.Type)
+	assert.Equal(t, services.PinEvent{MessageID: first, UserID: bob.ID}, event.Data)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, pinURL, aliceToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodPost, pinURL, carolToken, "").Code)
+
+	pins := listPins(t, router, aliceToken, bob.ID)
+	assert.Len(t, pins, 1)
+	assert.Equal(t, "meeting at 10", pins[0].Message.Content)
+	assert.Equal(t, bob.ID, pins[0].PinnedBy)
+	assert.True(t, pins[0].Message.Pinned)
+	assert.Len(t, listPins(t, router, bobToken, alice.ID), 1)
+	assert.Empty(t, listPins(t, router, carolToken, alice.ID))
+
+	// Лимит закреплений на переписку
+	for i := 1; i < 10; i++ {
+		id := sendTestMessage(t, router, db, bobToken, alice.ID, fmt.Sprintf("note %d", i))
+		assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, fmt.Sprintf("/api/messages/%d/pin", id), aliceToken, "").Code)
+	}
+	extra := sendTestMessage(t, router, db, bobToken, alice.ID, "one too many")
+	w := doJSON(router, http.MethodPost, fmt.Sprintf("/api/messages/%d/pin", extra), aliceToken, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Открепление освобождает место
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodDelete, pinURL, aliceToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodDelete, pinURL, aliceToken, "").Code)
+	w = doJSON(router, http.MethodPost, fmt.Sprintf("/api/messages/%d/pin", extra), aliceToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Удалённое у всех сообщение перестаёт быть закреплённым
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d?scope=everyone", extra), bobToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, listPins(t, router, aliceToken, bob.ID), 9)
+	w = doJSON(router, http.MethodPost, fmt.Sprintf("/api/messages/%d/pin", extra), aliceToken, "")
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestStarredMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+
+	alice, aliceToken := createTestUser(t, db, "star-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "star-bob@example.com")
+	_, carolToken := createTestUser(t, db, "star-carol@example.com")
+
+	// Избранное собирается из разных переписок
+	ids := []uint{
+		sendTestMessage(t, router, db, bobToken, alice.ID, "recipe"),
+		sendTestMessage(t, router, db, carolToken, alice.ID, "address"),
+		sendTestMessage(t, router, db, aliceToken, bob.ID, "my own note"),
+	}
+	for _, id := range ids {
+		w := doJSON(router, http.MethodPost, fmt.Sprintf("/api/messages/%d/star", id), aliceToken, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w := doJSON(router, http.MethodPost, fmt.Sprintf("/api/messages/%d/star", ids[0]), carolToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	page := listStarred(t, router, aliceToken, "?limit=2")
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Messages, 2)
+	assert.Equal(t, ids[2], page.Messages[0].ID)
+	assert.True(t, page.Messages[0].Starred)
+	page = listStarred(t, router, aliceToken, fmt.Sprintf("?limit=2&before_id=%d", page.Messages[1].ID))
+	assert.False(t, page.HasMore)
+	assert.Len(t, page.Messages, 1)
+	assert.Equal(t, "recipe", page.Messages[0].Content)
+
+	// Избранное личное
+	assert.Empty(t, listStarred(t, router, bobToken, "").Messages)
+	assert.Empty(t, listStarred(t, router, carolToken, "").Messages)
+
+	// Скрытые у себя, удалённые у всех и исчезнувшие сообщения пропадают из избранного
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d", ids[2]), aliceToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d?scope=everyone", ids[1]), carolToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	page = listStarred(t, router, aliceToken, "")
+	assert.Len(t, page.Messages, 1)
+
+	db.Model(&models.Message{}).Where("id = ?", ids[0]).Update("expires_at", time.Now().Add(-time.Second))
+	assert.Empty(t, listStarred(t, router, aliceToken, "").Messages)
+	reaper := services.NewExpiryReaper(repository.NewMessageRepository(db), time.Minute, 10)
+	_, err := reaper.ReapOnce(context.Background(), time.Now())
+	assert.NoError(t, err)
+	var count int64
+	assert.NoError(t, db.Model(&models.Star{}).Where("user_id = ?", alice.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count) // осталась только звезда на скрытом у себя сообщении
+
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d/star", ids[2]), aliceToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/%d/star", ids[2]), aliceToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
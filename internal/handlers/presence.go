@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/services"
+)
+
+type PresenceHandler struct {
+	Service *services.PresenceService
+}
+
+func NewPresenceHandler(s *services.PresenceService) *PresenceHandler {
+	return &PresenceHandler{Service: s}
+}
+
+func (h *PresenceHandler) GetPresence(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	presence, err := h.Service.GetPresence(c.GetUint("user_id"), userID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, presence)
+}
+
+// SetTyping — клиент сообщает, что пользователь начал или перестал печатать в переписке
+func (h *PresenceHandler) SetTyping(c *gin.Context) {
+	peerID, ok := peerIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Typing bool `json:"typing"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.Service.SetTyping(c.Request.Context(), c.GetUint("user_id"), peerID, req.Typing); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
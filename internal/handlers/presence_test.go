@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+)
+
+func nextEvent(t *testing.T, events <-chan realtime.Event, wait time.Duration) realtime.Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(wait):
+		t.Fatal("expected event")
+		return realtime.Event{}
+	}
+}
+
+func TestPresence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	router := setupMessagingRouterWithHub(t, db, hub)
+	presence := services.NewPresenceService(
+		repository.NewUserRepository(db),
+		services.NewContactService(repository.NewContactRepository(db), repository.NewUserRepository(db)),
+		hub,
+	)
+
+	alice, aliceToken := createTestUser(t, db, "presence-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "presence-bob@example.com")
+	_, carolToken := createTestUser(t, db, "presence-carol@example.com")
+
+	sendTestMessage(t, router, db, aliceToken, bob.ID, "hi bob")
+	url := fmt.Sprintf("/api/users/%d/presence", alice.ID)
+
+	// Алиса только что обращалась к API — собеседник видит её в сети
+	w := doJSON(router, http.MethodGet, url, bobToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var p services.Presence
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, services.PresenceOnline, p.Status)
+
+	// Посторонним статус не показывается
+	assert.Equal(t, http.StatusForbidden, doJSON(router, http.MethodGet, url, carolToken, "").Code)
+
+	// Соединение открывается и закрывается — собеседник получает события
+	events, cancel := hub.Subscribe(bob.ID)
+	defer cancel()
+	_, disconnect := presence.Subscribe(context.Background(), alice.ID)
+	event := nextEvent(t, events, time.Second)
+	assert.Equal(t, services.EventPresenceChanged, event.Type)
+	assert.Equal(t, services.PresenceOnline, event.Data.(*services.Presence).Status)
+
+	disconnect()
+	event = nextEvent(t, events, time.Second)
+	offline := event.Data.(*services.Presence)
+	assert.Equal(t, services.PresenceOffline, offline.Status)
+	assert.NotNil(t, offline.LastSeenAt)
+
+	// Видимость только для контактов
+	w = doJSON(router, http.MethodPatch, "/api/profile/settings", aliceToken, `{"presence_visibility": "contacts"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, http.MethodGet, url, bobToken, "").Code)
+	w = doJSON(router, http.MethodPost, "/api/contacts", aliceToken, fmt.Sprintf(`{"user_id": %d}`, bob.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodGet, url, bobToken, "").Code)
+
+	w = doJSON(router, http.MethodPatch, "/api/profile/settings", aliceToken, `{"presence_visibility": "everyone"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Время последней активности не попадает в общие выдачи пользователя
+	body, err := json.Marshal(alice)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "last_seen")
+}
+
+func TestTypingIndicator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	router := setupMessagingRouterWithHub(t, db, hub)
+	presence := services.NewPresenceService(
+		repository.NewUserRepository(db),
+		services.NewContactService(repository.NewContactRepository(db), repository.NewUserRepository(db)),
+		hub,
+	)
+	presence.TypingTimeout = 50 * time.Millisecond
+
+	alice, aliceToken := createTestUser(t, db, "typing-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "typing-bob@example.com")
+
+	events, cancel := hub.Subscribe(bob.ID)
+	defer cancel()
+
+	w := doJSON(router, http.MethodPost, fmt.Sprintf("/api/conversations/%d/typing", bob.ID), aliceToken, `{"typing": true}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	event := nextEvent(t, events, time.Second)
+	assert.Equal(t, services.EventTyping, event.Type)
+	typing := event.Data.(services.TypingEvent)
+	assert.Equal(t, alice.ID, typing.UserID)
+	assert.True(t, typing.Typing)
+	assert.NotNil(t, typing.ExpiresAt)
+
+	w = doJSON(router, http.MethodPost, fmt.Sprintf("/api/conversations/%d/typing", bob.ID), aliceToken, `{"typing": false}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.False(t, nextEvent(t, events, time.Second).Data.(services.TypingEvent).Typing)
+
+	// Без продления индикатор гаснет сам
+	assert.NoError(t, presence.SetTyping(context.Background(), alice.ID, bob.ID, true))
+	assert.True(t, nextEvent(t, events, time.Second).Data.(services.TypingEvent).Typing)
+	assert.False(t, nextEvent(t, events, time.Second).Data.(services.TypingEvent).Typing)
+
+	// Заблокировавший не получает событий, а отправитель не узнаёт об этом
+	w = doJSON(router, http.MethodPost, "/api/blocks", bobToken, fmt.Sprintf(`{"user_id": %d}`, alice.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPost, fmt.Sprintf("/api/conversations/%d/typing", bob.ID), aliceToken, `{"typing": true}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %s", event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	w = doJSON(router, http.MethodPost, "/api/conversations/999999/typing", aliceToken, `{"typing": true}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Пользователи, обращавшиеся только к REST API, не копятся в памяти: после простоя
+// время их активности сохраняется, а записи удаляются
+func TestPresenceSweep(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	users := repository.NewUserRepository(db)
+	presence := services.NewPresenceService(users, services.NewContactService(repository.NewContactRepository(db), users), hub)
+	presence.PersistInterval = time.Hour // запись в базу только при очистке
+
+	alice, _ := createTestUser(t, db, "sweep-alice@example.com")
+	bob, _ := createTestUser(t, db, "sweep-bob@example.com")
+	carol, _ := createTestUser(t, db, "sweep-carol@example.com")
+	ctx := context.Background()
+
+	presence.Touch(ctx, alice.ID)
+	time.Sleep(10 * time.Millisecond)
+	presence.Touch(ctx, alice.ID) // вторая активность в базу ещё не записана
+	_, disconnect := presence.Subscribe(ctx, bob.ID)
+	defer disconnect()
+	presence.Touch(ctx, carol.ID)
+
+	// Недавняя активность не забывается
+	assert.Zero(t, presence.Sweep(ctx, time.Now()))
+
+	// После простоя забываются все, кроме пользователя с открытым соединением
+	later := time.Now().Add(presence.AwayAfter + time.Minute)
+	assert.Equal(t, 2, presence.Sweep(ctx, later))
+	assert.Zero(t, presence.Sweep(ctx, later))
+
+	stored, err := users.GetByID(alice.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, stored.LastSeenAt) {
+		assert.WithinDuration(t, time.Now(), *stored.LastSeenAt, time.Second)
+	}
+	// Статус после очистки считается по сохранённому времени и не меняется
+	p, err := presence.GetPresence(alice.ID, alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, services.PresenceOnline, p.Status)
+
+	p, err = presence.GetPresence(bob.ID, bob.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, services.PresenceOnline, p.Status)
+}
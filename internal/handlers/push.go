@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/services"
+)
+
+// DeviceView — зарегистрированное устройство; сам токен обратно не отдаётся
+type DeviceView struct {
+	ID        uint      `json:"id"`
+	Platform  string    `json:"platform"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PushHandler struct {
+	Service *services.PushService
+}
+
+func NewPushHandler(s *services.PushService) *PushHandler {
+	return &PushHandler{Service: s}
+}
+
+// RegisterDevice регистрирует токен push-уведомлений; повторная регистрация того же токена безопасна
+func (h *PushHandler) RegisterDevice(c *gin.Context) {
+	var req struct {
+		Platform string `json:"platform"` // ios, android или web
+		Token    string `json:"token"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	device, err := h.Service.RegisterDevice(c.GetUint("user_id"), req.Platform, req.Token)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device": deviceView(device)})
+}
+
+func (h *PushHandler) ListDevices(c *gin.Context) {
+	devices, err := h.Service.ListDevices(c.GetUint("user_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	views := make([]DeviceView, len(devices))
+	for i := range devices {
+		views[i] = deviceView(&devices[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": views})
+}
+
+func (h *PushHandler) UnregisterDevice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		abortWithError(c, invalidParam("id", "positive_integer", ""))
+		return
+	}
+	if err := h.Service.UnregisterDevice(c.GetUint("user_id"), uint(id)); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "device_removed")})
+}
+
+func deviceView(d *models.DeviceToken) DeviceView {
+	return DeviceView{ID: d.ID, Platform: d.Platform, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+	"secure-messenger/pkg/push"
+)
+
+func newTestPushService(db *gorm.DB, hub *realtime.Hub, provider services.PushProvider) *services.PushService {
+	return services.NewPushService(
+		repository.NewPushRepository(db),
+		repository.NewUserRepository(db),
+		repository.NewConversationRepository(db),
+		hub,
+		provider,
+		testAESKey,
+	)
+}
+
+func registerTestDevice(t *testing.T, router *gin.Engine, token, deviceToken string) uint {
+	w := doJSON(router, http.MethodPost, "/api/devices", token,
+		fmt.Sprintf(`{"platform": "android", "token": %q}`, deviceToken))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Device DeviceView `json:"device"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Device.ID
+}
+
+func TestPushNotifications(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	provider := push.NewMemoryProvider()
+	router := setupMessagingRouterWithPush(t, db, hub, provider)
+	dispatcher := services.NewPushDispatcher(newTestPushService(db, hub, provider), time.Minute, 10)
+
+	alice, aliceToken := createTestUser(t, db, "push-alice@example.com")
+	bob, bobToken := createTestUser(t, db, "push-bob@example.com")
+
+	w := doJSON(router, http.MethodPost, "/api/devices", bobToken, `{"platform": "fax", "token": "abc"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	registerTestDevice(t, router, bobToken, "push-bob-phone")
+	registerTestDevice(t, router, bobToken, "push-bob-phone") // повторная регистрация не плодит устройства
+	w = doJSON(router, http.MethodGet, "/api/devices", bobToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "push-bob-phone")
+	var devices struct {
+		Devices []DeviceView `json:"devices"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &devices))
+	assert.Len(t, devices.Devices, 1)
+
+	dispatch := func() []push.Notification {
+		before := len(provider.Sent())
+		_, err := dispatcher.DispatchDue(context.Background(), time.Now())
+		assert.NoError(t, err)
+		return provider.Sent()[before:]
+	}
+
+	// По умолчанию в уведомлении нет ни текста, ни имени отправителя — ни в очереди, ни у провайдера
+	msgID := sendTestMessage(t, router, db, aliceToken, bob.ID, "secret plans")
+	var queued models.PushNotification
+	assert.NoError(t, db.Last(&queued).Error)
+	assert.NotContains(t, queued.Payload, "secret plans")
+	sent := dispatch()
+	assert.Len(t, sent, 1)
+	assert.Equal(t, "push-bob-phone", sent[0].Token)
+	assert.Empty(t, sent[0].Title)
+	assert.Empty(t, sent[0].Body)
+	assert.Equal(t, fmt.Sprint(msgID), sent[0].Data["message_id"])
+	assert.Equal(t, fmt.Sprint(alice.ID), sent[0].Data["sender_id"])
+
+	// Пользователь разрешил показывать текст
+	w = doJSON(router, http.MethodPatch, "/api/profile/settings", bobToken, `{"push_previews": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	sendTestMessage(t, router, db, aliceToken, bob.ID, "dinner at 8?")
+	sent = dispatch()
+	assert.Len(t, sent, 1)
+	assert.Equal(t, "push-alice", sent[0].Title)
+	assert.Equal(t, "dinner at 8?", sent[0].Body)
+
+	// С открытым соединением уведомления не нужны
+	_, cancel := hub.Subscribe(bob.ID)
+	sendTestMessage(t, router, db, aliceToken, bob.ID, "are you there?")
+	cancel()
+	assert.Empty(t, dispatch())
+
+	// Отключённая переписка не уведомляет до отмены
+	muteURL := fmt.Sprintf("/api/conversations/%d/mute", alice.ID)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, http.MethodPut, muteURL, bobToken, fmt.Sprintf(`{"until": %q}`, past)).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPut, muteURL, bobToken, "").Code)
+	w = doJSON(router, http.MethodGet, fmt.Sprintf("/api/conversations/%d/settings", alice.ID), bobToken, "")
+	assert.Contains(t, w.Body.String(), `"muted":true`)
+	sendTestMessage(t, router, db, aliceToken, bob.ID, "muted")
+	assert.Empty(t, dispatch())
+
+	// Отключение личное: Алиса уведомления от Боба получает
+	registerTestDevice(t, router, aliceToken, "push-alice-phone")
+	sendTestMessage(t, router, db, bobToken, alice.ID, "ping")
+	assert.Len(t, dispatch(), 1)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodDelete, muteURL, bobToken, "").Code)
+	sendTestMessage(t, router, db, aliceToken, bob.ID, "unmuted")
+	assert.Len(t, dispatch(), 1)
+}
+
+func TestPushRetries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	hub := realtime.NewHub()
+	provider := push.NewMemoryProvider()
+	router := setupMessagingRouterWithPush(t, db, hub, provider)
+	pushService := newTestPushService(db, hub, provider)
+	pushService.MaxAttempts = 3
+	dispatcher := services.NewPushDispatcher(pushService, time.Minute, 10)
+
+	_, senderToken := createTestUser(t, db, "push-retry-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "push-retry-receiver@example.com")
+	deviceID := registerTestDevice(t, router, receiverToken, "push-retry-phone")
+
+	dispatchAt := func(at time.Time) int {
+		sent, err := dispatcher.DispatchDue(context.Background(), at)
+		assert.NoError(t, err)
+		return sent
+	}
+
+	// Временный сбой шлюза — повтор с нарастающей задержкой
+	failures := 1
+	provider.Fail = func(push.Notification) error {
+		if failures > 0 {
+			failures--
+			return errors.New("gateway unavailable")
+		}
+		return nil
+	}
+	sendTestMessage(t, router, db, senderToken, receiver.ID, "retry me")
+	now := time.Now()
+	assert.Zero(t, dispatchAt(now))
+	assert.Zero(t, dispatchAt(now.Add(time.Second)))
+	assert.Equal(t, 1, dispatchAt(now.Add(time.Hour)))
+
+	// После MaxAttempts уведомление выбрасывается
+	provider.Fail = func(push.Notification) error { return errors.New("gateway unavailable") }
+	sendTestMessage(t, router, db, senderToken, receiver.ID, "give up")
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, dispatchAt(now.Add(time.Duration(i+2)*time.Hour)))
+	}
+	var count int64
+	assert.NoError(t, db.Model(&models.PushNotification{}).Where("device_token_id = ?", deviceID).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Недействительный токен удаляется вместе с очередью
+	provider.Fail = func(push.Notification) error { return push.ErrInvalidToken }
+	sendTestMessage(t, router, db, senderToken, receiver.ID, "gone")
+	assert.Zero(t, dispatchAt(now.Add(time.Hour)))
+	w := doJSON(router, http.MethodGet, "/api/devices", receiverToken, "")
+	assert.JSONEq(t, `{"devices": []}`, w.Body.String())
+
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/devices/%d", deviceID), receiverToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPushWebhookProvider(t *testing.T) {
+	secret := []byte("webhook-secret")
+	status := http.StatusOK
+	var received push.Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Push-Signature"))
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	provider := push.NewWebhookProvider(server.URL, secret)
+	n := push.Notification{Platform: "ios", Token: "device", Data: map[string]string{"message_id": "1"}}
+	assert.NoError(t, provider.Send(context.Background(), n))
+	assert.Equal(t, n, received)
+
+	status = http.StatusGone
+	assert.ErrorIs(t, provider.Send(context.Background(), n), push.ErrInvalidToken)
+	status = http.StatusBadRequest
+	assert.ErrorIs(t, provider.Send(context.Background(), n), push.ErrRejected)
+	status = http.StatusServiceUnavailable
+	err := provider.Send(context.Background(), n)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, push.ErrRejected)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"secure-messenger/internal/services"
+)
+
+// ListScheduled — отложенные сообщения текущего пользователя, ещё не доставленные
+func (h *MessageHandler) ListScheduled(c *gin.Context) {
+	list, err := h.service(c).ListScheduled(c.GetUint("user_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scheduled_messages": list})
+}
+
+func (h *MessageHandler) UpdateScheduled(c *gin.Context) {
+	id, ok := scheduledIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content *string    `json:"content"`
+		SendAt  *time.Time `json:"send_at"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	scheduled, err := h.service(c).UpdateScheduled(id, c.GetUint("user_id"), services.ScheduledUpdate{
+		Content: req.Content,
+		SendAt:  req.SendAt,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, scheduled)
+}
+
+func (h *MessageHandler) CancelScheduled(c *gin.Context) {
+	id, ok := scheduledIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service(c).CancelScheduled(id, c.GetUint("user_id")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "scheduled_cancelled")})
+}
+
+func scheduledIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		abortWithError(c, invalidParam("id", "positive_integer", ""))
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/internal/services"
+)
+
+func newTestScheduler(db *gorm.DB) *services.MessageScheduler {
+	userRepo := repository.NewUserRepository(db)
+	messageService := services.NewMessageService(
+		repository.NewMessageRepository(db),
+		userRepo,
+		repository.NewConversationRepository(db),
+		repository.NewAttachmentRepository(db),
+		services.NewContactService(repository.NewContactRepository(db), userRepo),
+		repository.NewScheduledMessageRepository(db),
+		testAESKey,
+	)
+	return services.NewMessageScheduler(messageService, time.Minute, 10)
+}
+
+func listScheduled(t *testing.T, router *gin.Engine, token string) []services.ScheduledMessageView {
+	w := doJSON(router, http.MethodGet, "/api/messages/scheduled", token, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		ScheduledMessages []services.ScheduledMessageView `json:"scheduled_messages"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.ScheduledMessages
+}
+
+func TestScheduledMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+	scheduler := newTestScheduler(db)
+
+	_, senderToken := createTestUser(t, db, "schedule-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "schedule-receiver@example.com")
+	_, otherToken := createTestUser(t, db, "schedule-other@example.com")
+
+	sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w := doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "happy birthday", "send_at": %q}`, receiver.ID, sendAt))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		ScheduledMessage services.ScheduledMessageView `json:"scheduled_message"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	id := resp.ScheduledMessage.ID
+	assert.Equal(t, "pending", resp.ScheduledMessage.Status)
+
+	// До срока получатель ничего не видит, а у автора сообщение в списке
+	assert.Empty(t, listMessages(t, router, receiverToken))
+	list := listScheduled(t, router, senderToken)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "happy birthday", list[0].Content)
+	assert.Empty(t, listScheduled(t, router, otherToken))
+
+	url := fmt.Sprintf("/api/messages/scheduled/%d", id)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodPatch, url, otherToken, `{"content": "hacked"}`).Code)
+	w = doJSON(router, http.MethodPatch, url, senderToken, `{"content": "happy birthday!!"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Планировщик доставляет сообщение ровно один раз
+	delivered, err := scheduler.DeliverDue(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+	delivered, err = scheduler.DeliverDue(context.Background(), time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	delivered, err = scheduler.DeliverDue(context.Background(), time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	msgs := listMessages(t, router, receiverToken)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "happy birthday!!", msgs[0]["Content"])
+	assert.Empty(t, listScheduled(t, router, senderToken))
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodDelete, url, senderToken, "").Code)
+
+	// Отменённое сообщение не доставляется
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "never mind", "send_at": %q}`, receiver.ID, sendAt))
+	assert.Equal(t, http.StatusOK, w.Code)
+	cancelID := listScheduled(t, router, senderToken)[0].ID
+	w = doJSON(router, http.MethodDelete, fmt.Sprintf("/api/messages/scheduled/%d", cancelID), senderToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	delivered, err = scheduler.DeliverDue(context.Background(), time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Len(t, listMessages(t, router, receiverToken), 1)
+}
+
+func TestScheduledMessageValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+	scheduler := newTestScheduler(db)
+
+	sender, senderToken := createTestUser(t, db, "schedule-check-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "schedule-check-receiver@example.com")
+
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	w := doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "late", "send_at": %q}`, receiver.ID, past))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "file", "send_at": %q, "attachment_ids": ["abc"]}`, receiver.ID, future))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": 999999, "content": "nobody", "send_at": %q}`, future))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Получатель заблокировал отправителя уже после планирования — доставка не состоится,
+	// и автор видит причину в списке
+	w = doJSON(router, http.MethodPost, "/api/messages/send", senderToken,
+		fmt.Sprintf(`{"receiver_id": %d, "content": "hello later", "send_at": %q}`, receiver.ID, future))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPatch, "/api/profile/settings", receiverToken, `{"block_silent": false}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, http.MethodPost, "/api/blocks", receiverToken, fmt.Sprintf(`{"user_id": %d}`, sender.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	delivered, err := scheduler.DeliverDue(context.Background(), time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+	list := listScheduled(t, router, senderToken)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "failed", list[0].Status)
+	assert.Equal(t, "blocked", list[0].FailureReason)
+	assert.Empty(t, listMessages(t, router, receiverToken))
+}
+
+// Запись, доставка которой падает с временной ошибкой, не задерживает следующие
+// и после MaxAttempts помечается ошибочной
+func TestScheduledDeliveryRetries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+	scheduler := newTestScheduler(db)
+	scheduler.BatchSize = 1
+	scheduler.MaxAttempts = 2
+
+	sender, senderToken := createTestUser(t, db, "schedule-retry-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "schedule-retry-receiver@example.com")
+
+	// Идентификатор уже занят обычным сообщением: вставка при доставке нарушит уникальность
+	taken := "taken-id"
+	assert.NoError(t, db.Create(&models.Message{SenderID: sender.ID, ReceiverID: receiver.ID, ClientMessageID: &taken}).Error)
+	sendAt := time.Now().Add(-time.Minute)
+	poison := models.ScheduledMessage{SenderID: sender.ID, ReceiverID: receiver.ID, Content: "stuck",
+		SendAt: sendAt, Status: models.ScheduledPending, ClientMessageID: &taken}
+	assert.NoError(t, db.Create(&poison).Error)
+	assert.NoError(t, db.Create(&models.ScheduledMessage{SenderID: sender.ID, ReceiverID: receiver.ID, Content: "fine",
+		SendAt: sendAt, Status: models.ScheduledPending}).Error)
+
+	delivered, err := scheduler.DeliverDue(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Len(t, listMessages(t, router, receiverToken), 2)
+	list := listScheduled(t, router, senderToken)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "pending", list[0].Status)
+
+	// Попытки исчерпаны — запись больше не доставляется, причина не раскрывает внутреннюю ошибку
+	delivered, err = scheduler.DeliverDue(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+	list = listScheduled(t, router, senderToken)
+	assert.Equal(t, "failed", list[0].Status)
+	assert.Equal(t, "delivery failed", list[0].FailureReason)
+	var stored models.ScheduledMessage
+	assert.NoError(t, db.First(&stored, poison.ID).Error)
+	assert.Equal(t, 2, stored.Attempts)
+
+	// Редактирование снова ставит сообщение в очередь с новым счётчиком попыток
+	w := doJSON(router, http.MethodPatch, fmt.Sprintf("/api/messages/scheduled/%d", poison.ID), senderToken, `{"content": "retry"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, db.First(&stored, poison.ID).Error)
+	assert.Equal(t, models.ScheduledPending, stored.Status)
+	assert.Zero(t, stored.Attempts)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentID = "00f067aa0ba902b7"
+)
+
+// spanTree индексирует записанные спаны по имени и по ID
+type spanTree struct {
+	byName map[string][]tracetest.SpanStub
+	byID   map[trace.SpanID]tracetest.SpanStub
+}
+
+func newSpanTree(spans tracetest.SpanStubs) spanTree {
+	tree := spanTree{byName: map[string][]tracetest.SpanStub{}, byID: map[trace.SpanID]tracetest.SpanStub{}}
+	for _, s := range spans {
+		tree.byName[s.Name] = append(tree.byName[s.Name], s)
+		tree.byID[s.SpanContext.SpanID()] = s
+	}
+	return tree
+}
+
+// hasAncestor проверяет, что спан вложен (не обязательно напрямую) в спан с именем ancestor
+func (tree spanTree) hasAncestor(span tracetest.SpanStub, ancestor string) bool {
+	for parent, ok := tree.byID[span.Parent.SpanID()]; ok; parent, ok = tree.byID[parent.Parent.SpanID()] {
+		if parent.Name == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func spanAttr(span tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	exporter := tracetest.NewInMemoryExporter()
+	processor := sdktrace.NewSimpleSpanProcessor(exporter)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// Остальные тесты пакета спаны не копят
+	defer provider.UnregisterSpanProcessor(processor)
+
+	db := setupTestDB()
+	router := setupMessagingRouter(t, db)
+	_, senderToken := createTestUser(t, db, "tracing-sender@example.com")
+	receiver, receiverToken := createTestUser(t, db, "tracing-receiver@example.com")
+
+	sendTestMessage(t, router, db, senderToken, receiver.ID, "traced secret text")
+	exporter.Reset()
+
+	// Входящий traceparent продолжается: спаны запроса попадают в трассу клиента
+	req := httptest.NewRequest(http.MethodGet, "/api/messages", nil)
+	req.Header.Set("Authorization", "Bearer "+receiverToken)
+	req.Header.Set("traceparent", "00-"+testTraceID+"-"+testParentID+"-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	tree := newSpanTree(exporter.GetSpans())
+	for _, span := range exporter.GetSpans() {
+		assert.Equal(t, testTraceID, span.SpanContext.TraceID().String(), span.Name)
+	}
+
+	if assert.Len(t, tree.byName["GET /api/messages"], 1) {
+		server := tree.byName["GET /api/messages"][0]
+		assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+		assert.Equal(t, testParentID, server.Parent.SpanID().String())
+		assert.True(t, server.Parent.IsRemote())
+		assert.Equal(t, "/api/messages", spanAttr(server, "http.route"))
+		assert.Equal(t, "200", spanAttr(server, "http.response.status_code"))
+	}
+	if assert.Len(t, tree.byName["MessageService.GetMessages"], 1) {
+		assert.True(t, tree.hasAncestor(tree.byName["MessageService.GetMessages"][0], "GET /api/messages"))
+	}
+	if assert.Len(t, tree.byName["encryption.DecryptAES"], 1) {
+		assert.True(t, tree.hasAncestor(tree.byName["encryption.DecryptAES"][0], "MessageService.buildViews"))
+	}
+
+	queries := append(tree.byName["gorm.query"], tree.byName["gorm.update"]...)
+	assert.NotEmpty(t, queries)
+	for _, span := range queries {
+		assert.True(t, tree.hasAncestor(span, "MessageService.GetMessages"), spanAttr(span, "db.query.text"))
+		assert.Equal(t, "sqlite", spanAttr(span, "db.system.name"))
+		assert.NotEmpty(t, spanAttr(span, "db.query.text"))
+	}
+
+	// Отправка: шифрование и запись в базу внутри спана метода; значения параметров в спаны не попадают
+	exporter.Reset()
+	sendTestMessage(t, router, db, senderToken, receiver.ID, "another secret text")
+	tree = newSpanTree(exporter.GetSpans())
+	if assert.Len(t, tree.byName["encryption.EncryptAES"], 1) {
+		assert.True(t, tree.hasAncestor(tree.byName["encryption.EncryptAES"][0], "MessageService.SendMessage"))
+	}
+	assert.NotEmpty(t, tree.byName["gorm.create"])
+	for _, span := range exporter.GetSpans() {
+		for _, kv := range span.Attributes {
+			assert.False(t, strings.Contains(kv.Value.Emit(), "secret text"), span.Name)
+		}
+	}
+
+	// Вне трассы (фоновые задачи) запросы к базе спанов не порождают
+	exporter.Reset()
+	assert.NoError(t, db.WithContext(context.Background()).Exec("SELECT 1").Error)
+	assert.Empty(t, exporter.GetSpans())
+}
@@ -4,24 +4,112 @@ import (
 	"gorm.io/gorm"
 	"net/http"
 	"secure-messenger/internal/models"
+	"secure-messenger/internal/services"
+	"secure-messenger/pkg/i18n"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 func ProfileHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetUint("user_id") // ✅ достаем user_id из контекста
 
 		var user models.User
 		if err := db.First(&user, userID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			abortWithError(c, userLookupError(err))
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"id":    user.ID,
-			"email": user.Email,
-			"role":  user.Role,
+			"id":            user.ID,
+			"email":         user.Email,
+			"role":          user.Role,
+			"read_receipts": user.ReadReceipts,
+			"only_contacts": user.OnlyContacts,
+			"block_silent":  user.BlockSilent,
+			"discoverable":  user.Discoverable,
+			"display_name":  user.DisplayName,
+			"bio":           user.Bio,
+			"status_text":   user.StatusText,
+			"avatar_id":     user.AvatarID,
+
+			"presence_visibility": user.PresenceVisibility,
+			"push_previews":       user.PushPreviews,
+			"locale":              user.Locale,
 		})
 	}
 }
+
+func UpdateSettingsWithDB(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
+		userID := c.GetUint("user_id")
+
+		// Указатели — чтобы отличать "не передано" от false
+		var req struct {
+			ReadReceipts *bool `json:"read_receipts"`
+			OnlyContacts *bool `json:"only_contacts"`
+			BlockSilent  *bool `json:"block_silent"`
+			Discoverable *bool `json:"discoverable"`
+
+			PushPreviews       *bool   `json:"push_previews"`
+			PresenceVisibility *string `json:"presence_visibility"`
+			Locale             *string `json:"locale"` // "" — снова по Accept-Language
+		}
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.ReadReceipts != nil {
+			updates["read_receipts"] = *req.ReadReceipts
+		}
+		if req.OnlyContacts != nil {
+			updates["only_contacts"] = *req.OnlyContacts
+		}
+		if req.BlockSilent != nil {
+			updates["block_silent"] = *req.BlockSilent
+		}
+		if req.Discoverable != nil {
+			updates["discoverable"] = *req.Discoverable
+		}
+		if req.PushPreviews != nil {
+			updates["push_previews"] = *req.PushPreviews
+		}
+		if req.PresenceVisibility != nil {
+			switch *req.PresenceVisibility {
+			case models.PresenceVisibilityPeers, models.PresenceVisibilityContacts, models.PresenceVisibilityNobody:
+				updates["presence_visibility"] = *req.PresenceVisibility
+			default:
+				abortWithError(c, invalidParam("presence_visibility", "oneof",
+					strings.Join([]string{models.PresenceVisibilityPeers, models.PresenceVisibilityContacts, models.PresenceVisibilityNobody}, " ")))
+				return
+			}
+		}
+		if req.Locale != nil {
+			if *req.Locale != "" && !i18n.Supported(*req.Locale) {
+				abortWithError(c, invalidParam("locale", "oneof", strings.Join(i18n.Languages(), " ")))
+				return
+			}
+			updates["locale"] = *req.Locale
+		}
+		if len(updates) == 0 {
+			abortWithError(c, services.ErrEmptyUpdate)
+			return
+		}
+
+		res := db.Model(&models.User{}).Where("id = ?", userID).Updates(updates)
+		if res.Error != nil {
+			abortWithError(c, res.Error)
+			return
+		}
+		if res.RowsAffected == 0 {
+			abortWithError(c, services.ErrUserNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": systemMessage(c, "settings_updated")})
+	}
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "secure_messenger"
+
+// Операции шифрования для CryptoError
+const (
+	OpEncrypt = "encrypt"
+	OpDecrypt = "decrypt"
+)
+
+// Metrics — метрики сервера в собственном реестре. Методы безопасно вызывать
+// у nil: сервисы, собранные без метрик (тесты, подкоманды), ничего не считают.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	logins       *prometheus.CounterVec
+	refreshes    *prometheus.CounterVec
+	refreshReuse prometheus.Counter
+	messagesSent prometheus.Counter
+	messagesRead prometheus.Counter
+	cryptoErrors *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_logins_total",
+			Help:      "Login attempts by result (success or failure).",
+		}, []string{"result"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_refreshes_total",
+			Help:      "Refresh token exchanges by result (success or failure).",
+		}, []string{"result"}),
+		refreshReuse: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_refresh_reuse_total",
+			Help:      "Refresh tokens presented again after another exchange had already consumed them.",
+		}),
+		messagesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_sent_total",
+			Help:      "Messages delivered to conversations, including scheduled ones.",
+		}),
+		messagesRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_read_total",
+			Help:      "Messages marked as read.",
+		}),
+		cryptoErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "crypto_errors_total",
+			Help:      "Message encryption and decryption failures by operation.",
+		}, []string{"operation"}),
+	}
+	// Нулевые значения видны сразу, а не после первого события
+	m.logins.WithLabelValues("success")
+	m.logins.WithLabelValues("failure")
+	m.refreshes.WithLabelValues("success")
+	m.refreshes.WithLabelValues("failure")
+	m.cryptoErrors.WithLabelValues(OpEncrypt)
+	m.cryptoErrors.WithLabelValues(OpDecrypt)
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration, m.logins, m.refreshes, m.refreshReuse,
+		m.messagesSent, m.messagesRead, m.cryptoErrors,
+	)
+	return m
+}
+
+// Handler отдаёт метрики в формате Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// RegisterDB добавляет статистику пула соединений с базой
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterGauge добавляет показатель, значение которого читается при каждом сборе
+func (m *Metrics) RegisterGauge(name, help string, value func() float64) {
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+func (m *Metrics) ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) Login(success bool) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(result(success)).Inc()
+}
+
+func (m *Metrics) Refresh(success bool) {
+	if m == nil {
+		return
+	}
+	m.refreshes.WithLabelValues(result(success)).Inc()
+}
+
+// RefreshReused учитывает повторное использование refresh token
+func (m *Metrics) RefreshReused() {
+	if m == nil {
+		return
+	}
+	m.refreshReuse.Inc()
+}
+
+func result(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failure"
+}
+
+func (m *Metrics) MessageSent() {
+	if m == nil {
+		return
+	}
+	m.messagesSent.Inc()
+}
+
+func (m *Metrics) MessagesRead(count int64) {
+	if m == nil || count <= 0 {
+		return
+	}
+	m.messagesRead.Add(float64(count))
+}
+
+func (m *Metrics) CryptoError(operation string) {
+	if m == nil {
+		return
+	}
+	m.cryptoErrors.WithLabelValues(operation).Inc()
+}
@@ -0,0 +1,450 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Миграции лежат в sql/ парами NNNN_name.up.sql и NNNN_name.down.sql. Один файл
+// служит и Postgres, и SQLite: различия в типах подставляются через {{.ID}} и {{.Timestamp}}.
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrUnknownMigration = errors.New("database has migrations unknown to this build")
+	ErrIrreversible     = errors.New("migration has no down step")
+	ErrLocked           = errors.New("another migrator holds the lock")
+	ErrPending          = errors.New("database has pending migrations")
+)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string // пусто — откатить нельзя
+	Checksum string // sha256 исходного up-файла
+}
+
+// Status — состояние миграции в базе
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time // nil — ещё не применена
+	Modified  bool       // файл изменился после применения
+	Missing   bool       // применена, но в сборке такой миграции нет
+}
+
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	Checksum  string    `gorm:"size:64;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+type migrationLock struct {
+	ID       int    `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string `gorm:"not null"`
+	LockedAt time.Time
+}
+
+func (migrationLock) TableName() string { return "schema_migrations_lock" }
+
+// Служебные таблицы создаются напрямую: через них применяются все остальные миграции
+const bookkeeping = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    applied_at {{.Timestamp}} NOT NULL
+);
+CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+    id INTEGER PRIMARY KEY,
+    owner TEXT NOT NULL,
+    locked_at {{.Timestamp}} NOT NULL
+);`
+
+type dialect struct {
+	ID        string
+	Timestamp string
+}
+
+var dialects = map[string]dialect{
+	"postgres": {ID: "BIGSERIAL PRIMARY KEY", Timestamp: "TIMESTAMPTZ"},
+	"sqlite":   {ID: "INTEGER PRIMARY KEY AUTOINCREMENT", Timestamp: "DATETIME"},
+}
+
+type Migrator struct {
+	DB             *gorm.DB
+	Migrations     []Migration
+	LockTimeout    time.Duration // сколько ждать, пока другой мигратор освободит блокировку
+	StaleLockAfter time.Duration // блокировка, не продлевавшаяся дольше, считается брошенной упавшим процессом
+	PollInterval   time.Duration
+	Heartbeat      time.Duration // как часто владелец продлевает блокировку; должно быть заметно меньше StaleLockAfter
+}
+
+// New готовит мигратор со встроенными миграциями под драйвер базы
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load(files, db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		DB:             db,
+		Migrations:     migrations,
+		LockTimeout:    30 * time.Second,
+		StaleLockAfter: 15 * time.Minute,
+		PollInterval:   500 * time.Millisecond,
+		Heartbeat:      time.Minute,
+	}, nil
+}
+
+// Load читает миграции из fsys и подставляет типы драйвера
+func Load(fsys fs.FS, driver string) ([]Migration, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("migrations: unsupported driver %q", driver)
+	}
+
+	paths, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, p := range paths {
+		base := path.Base(p)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migrations: %s: expected .up.sql or .down.sql", base)
+		}
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrations: %s: expected NNNN_name prefix", base)
+		}
+
+		raw, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		rendered, err := render(base, raw, d)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrations: version %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			sum := sha256.Sum256(raw)
+			m.Up = rendered
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = rendered
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrations: version %d has no up step", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func render(name string, raw []byte, d dialect) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(raw))
+	if err != nil {
+		return "", fmt.Errorf("migrations: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("migrations: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Up применяет все ещё не применённые миграции по порядку и возвращает их число
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version: mig.Version, Name: mig.Name, Checksum: mig.Checksum, AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down откатывает steps последних применённых миграций и возвращает их число
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.Migrations) - 1; i >= 0 && count < steps; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return count, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, ErrIrreversible)
+		}
+		err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, mig.Version).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status перечисляет миграции сборки и применённые миграции, которых в сборке нет
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	known := make(map[int64]bool)
+	for _, mig := range m.Migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			appliedAt := row.AppliedAt
+			s.AppliedAt = &appliedAt
+			s.Modified = row.Checksum != mig.Checksum
+		}
+		statuses = append(statuses, s)
+	}
+	for version, row := range applied {
+		if !known[version] {
+			appliedAt := row.AppliedAt
+			statuses = append(statuses, Status{Version: version, Name: row.Name, AppliedAt: &appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check убеждается, что схема базы совпадает со сборкой: всё применено и ничего не изменено
+func (m *Migrator) Check(ctx context.Context) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(applied); err != nil {
+		return err
+	}
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			return fmt.Errorf("%w: %04d_%s", ErrPending, mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]schemaMigration, error) {
+	db := m.DB.WithContext(ctx)
+	if err := m.ensureTables(db); err != nil {
+		return nil, err
+	}
+
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *Migrator) ensureTables(db *gorm.DB) error {
+	d, ok := dialects[db.Dialector.Name()]
+	if !ok {
+		return fmt.Errorf("migrations: unsupported driver %q", db.Dialector.Name())
+	}
+	sql, err := render("bookkeeping", []byte(bookkeeping), d)
+	if err != nil {
+		return err
+	}
+	return db.Exec(sql).Error
+}
+
+// verify не даёт работать с базой, если применённые миграции правили задним числом
+// или база уже обновлена более новой сборкой
+func (m *Migrator) verify(applied map[int64]schemaMigration) error {
+	known := make(map[int64]bool, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		known[mig.Version] = true
+		if row, ok := applied[mig.Version]; ok && row.Checksum != mig.Checksum {
+			return fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, mig.Version, mig.Name)
+		}
+	}
+	for version, row := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: %04d_%s", ErrUnknownMigration, version, row.Name)
+		}
+	}
+	return nil
+}
+
+// lock занимает единственную строку таблицы блокировки; работает одинаково на всех драйверах.
+// Пока блокировка занята, её время обновляется каждые Heartbeat, поэтому долгую миграцию
+// не примут за брошенную — брошенной считается только блокировка упавшего процесса.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	db := m.DB.WithContext(ctx)
+	if err := m.ensureTables(db); err != nil {
+		return nil, err
+	}
+
+	owner := lockOwner()
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		if err := db.Where("locked_at < ?", time.Now().Add(-m.StaleLockAfter)).Delete(&migrationLock{}).Error; err != nil {
+			return nil, err
+		}
+		res := db.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&migrationLock{ID: 1, Owner: owner, LockedAt: time.Now()})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			stop := m.heartbeat(owner)
+			return func() {
+				stop()
+				// контекст мог уже завершиться, а блокировку снять нужно в любом случае
+				m.DB.Where("id = ? AND owner = ?", 1, owner).Delete(&migrationLock{})
+			}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			var held migrationLock
+			m.DB.First(&held, 1)
+			return nil, fmt.Errorf("%w (%s since %s)", ErrLocked, held.Owner, held.LockedAt.Format(time.RFC3339))
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(m.PollInterval):
+		}
+	}
+}
+
+// heartbeat продлевает блокировку owner, пока не вызвана возвращённая функция остановки
+func (m *Migrator) heartbeat(owner string) func() {
+	interval := m.Heartbeat
+	if interval <= 0 || interval >= m.StaleLockAfter {
+		interval = m.StaleLockAfter / 3
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				res := m.DB.Model(&migrationLock{}).Where("id = ? AND owner = ?", 1, owner).
+					Update("locked_at", time.Now())
+				if res.Error != nil {
+					slog.Error("migrations: failed to refresh lock", "owner", owner, "error", res.Error)
+				} else if res.RowsAffected == 0 {
+					slog.Error("migrations: lock lost", "owner", owner)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func lockOwner() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
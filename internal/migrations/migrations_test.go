@@ -0,0 +1,254 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"secure-messenger/config"
+	"secure-messenger/internal/models"
+)
+
+// allModels — все модели, схему которых задают миграции
+var allModels = []interface{}{
+	&models.User{},
+	&models.RefreshToken{},
+	&models.Message{},
+	&models.MessageVersion{},
+	&models.MessageHide{},
+	&models.ConversationSetting{},
+	&models.ConversationMute{},
+	&models.Attachment{},
+	&models.Reaction{},
+	&models.SearchToken{},
+	&models.Contact{},
+	&models.Block{},
+	&models.MessageRequest{},
+	&models.Pin{},
+	&models.Star{},
+	&models.ScheduledMessage{},
+	&models.DeviceToken{},
+	&models.PushNotification{},
+}
+
+// openEmptySQLite открывает новую базу-файл без применённых миграций
+func openEmptySQLite(t *testing.T) *gorm.DB {
+	cfg := config.Default().DB
+	cfg.Driver = config.DriverSQLite
+	cfg.Path = filepath.Join(t.TempDir(), "migrations.db")
+	db, err := config.OpenDB(cfg)
+	assert.NoError(t, err)
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// assertSchemaMatchesModels проверяет, что в базе есть все таблицы, колонки и индексы моделей
+func assertSchemaMatchesModels(t *testing.T, db *gorm.DB) {
+	for _, model := range allModels {
+		stmt := &gorm.Statement{DB: db}
+		assert.NoError(t, stmt.Parse(model))
+		table := stmt.Schema.Table
+		if !assert.True(t, db.Migrator().HasTable(model), table) {
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			assert.True(t, db.Migrator().HasColumn(model, field.DBName), table+"."+field.DBName)
+			if field.Unique {
+				name := fmt.Sprintf("uni_%s_%s", table, field.DBName)
+				assert.True(t, db.Migrator().HasConstraint(model, name), name)
+			}
+		}
+		for name := range stmt.Schema.ParseIndexes() {
+			assert.True(t, db.Migrator().HasIndex(model, name), table+": "+name)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openEmptySQLite(t)
+	migrator, err := New(db)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrator.Migrations)
+
+	assert.ErrorIs(t, migrator.Check(ctx), ErrPending)
+	count, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrator.Migrations), count)
+	assertSchemaMatchesModels(t, db)
+	assert.NoError(t, migrator.Check(ctx))
+
+	// Повторный запуск ничего не делает
+	count, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, len(migrator.Migrations))
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt)
+		assert.False(t, s.Modified)
+	}
+
+	// Откат всех шагов удаляет схему, повторное применение восстанавливает её
+	count, err = migrator.Down(ctx, len(migrator.Migrations))
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrator.Migrations), count)
+	assert.False(t, db.Migrator().HasTable(&models.User{}))
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assertSchemaMatchesModels(t, db)
+
+	// Применённую миграцию изменили задним числом
+	assert.NoError(t, db.Table("schema_migrations").Where("version = ?", 1).Update("checksum", "tampered").Error)
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, statuses[0].Modified)
+	assert.NoError(t, db.Table("schema_migrations").Where("version = ?", 1).
+		Update("checksum", migrator.Migrations[0].Checksum).Error)
+
+	// База обновлена более новой сборкой
+	assert.NoError(t, db.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		9999, "from_the_future", "x", time.Now()).Error)
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, ErrUnknownMigration)
+	assert.ErrorIs(t, migrator.Check(ctx), ErrUnknownMigration)
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, statuses[len(statuses)-1].Missing)
+	assert.NoError(t, db.Exec("DELETE FROM schema_migrations WHERE version = ?", 9999).Error)
+}
+
+func TestMigrationLock(t *testing.T) {
+	ctx := context.Background()
+	db := openEmptySQLite(t)
+	migrator, err := New(db)
+	assert.NoError(t, err)
+	migrator.LockTimeout = 50 * time.Millisecond
+	migrator.PollInterval = 10 * time.Millisecond
+
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+
+	// Блокировку держит другой процесс
+	assert.NoError(t, db.Exec("INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (?, ?, ?)",
+		1, "other-host:42", time.Now()).Error)
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, ErrLocked)
+	_, err = migrator.Down(ctx, 1)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	// Брошенная блокировка перехватывается
+	migrator.StaleLockAfter = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+
+	// После работы блокировка снята
+	var locks int64
+	assert.NoError(t, db.Table("schema_migrations_lock").Count(&locks).Error)
+	assert.Zero(t, locks)
+}
+
+func TestMigrationLockHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	db := openEmptySQLite(t)
+
+	holder, err := New(db)
+	assert.NoError(t, err)
+	holder.StaleLockAfter = 100 * time.Millisecond
+	holder.Heartbeat = 10 * time.Millisecond
+	unlock, err := holder.lock(ctx)
+	assert.NoError(t, err)
+
+	// Миграция идёт дольше StaleLockAfter, но блокировку продлевают — перехватить её нельзя
+	time.Sleep(3 * holder.StaleLockAfter)
+	other, err := New(db)
+	assert.NoError(t, err)
+	other.StaleLockAfter = holder.StaleLockAfter
+	other.LockTimeout = 50 * time.Millisecond
+	other.PollInterval = 10 * time.Millisecond
+	_, err = other.Up(ctx)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	unlock()
+	_, err = other.Up(ctx)
+	assert.NoError(t, err)
+}
+
+// Модели в том виде, в каком их создавал AutoMigrate до появления миграций
+type baselineUser struct {
+	ID           uint   `gorm:"primaryKey"`
+	Name         string `gorm:"not null"`
+	Email        string `gorm:"unique;not null"`
+	PasswordHash string `gorm:"not null"`
+	Role         string `gorm:"not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineRefreshToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Token     string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+}
+
+func (baselineRefreshToken) TableName() string { return "refresh_tokens" }
+
+type baselineMessage struct {
+	ID         uint `gorm:"primaryKey"`
+	SenderID   uint
+	ReceiverID uint
+	Content    string
+	Encrypted  bool
+	CreatedAt  time.Time
+}
+
+func (baselineMessage) TableName() string { return "messages" }
+
+func TestMigrationsAdoptAutoMigratedSchema(t *testing.T) {
+	ctx := context.Background()
+	db := openEmptySQLite(t)
+
+	// База, созданная прежним AutoMigrate при старте, с данными
+	assert.NoError(t, db.AutoMigrate(&baselineUser{}, &baselineRefreshToken{}, &baselineMessage{}))
+	user := baselineUser{Name: "legacy", Email: "legacy@example.com", PasswordHash: "x", Role: "user"}
+	assert.NoError(t, db.Create(&user).Error)
+	assert.NoError(t, db.Create(&baselineMessage{SenderID: user.ID, ReceiverID: user.ID, Content: "old", Encrypted: true}).Error)
+
+	migrator, err := New(db)
+	assert.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, migrator.Check(ctx))
+	assertSchemaMatchesModels(t, db)
+
+	// Старые строки получают значения новых колонок по умолчанию
+	var adopted models.User
+	assert.NoError(t, db.First(&adopted, user.ID).Error)
+	assert.Equal(t, "legacy@example.com", adopted.Email)
+	assert.True(t, adopted.ReadReceipts)
+	assert.Equal(t, models.PresenceVisibilityPeers, adopted.PresenceVisibility)
+	var message models.Message
+	assert.NoError(t, db.First(&message).Error)
+	assert.Equal(t, "old", message.Content)
+	assert.False(t, message.Pending)
+	assert.Nil(t, message.DeletedForEveryoneAt)
+}
@@ -0,0 +1,33 @@
+-- Базовая схема в том виде, в каком её создавал прежний AutoMigrate. IF NOT EXISTS
+-- позволяет принять такие базы; всё, что появилось позже, добавляют следующие миграции.
+
+CREATE TABLE IF NOT EXISTS users (
+    id {{.ID}},
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at {{.Timestamp}},
+    updated_at {{.Timestamp}},
+    deleted_at {{.Timestamp}},
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id {{.ID}},
+    user_id BIGINT,
+    token TEXT,
+    expires_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token ON refresh_tokens (token);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id {{.ID}},
+    sender_id BIGINT,
+    receiver_id BIGINT,
+    content TEXT,
+    encrypted BOOLEAN,
+    created_at {{.Timestamp}}
+);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_users_avatar_id;
+ALTER TABLE users DROP COLUMN avatar_id;
+ALTER TABLE users DROP COLUMN status_text;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN display_name;
+ALTER TABLE users DROP COLUMN push_previews;
+ALTER TABLE users DROP COLUMN last_seen_at;
+ALTER TABLE users DROP COLUMN presence_visibility;
+ALTER TABLE users DROP COLUMN discoverable;
+ALTER TABLE users DROP COLUMN block_silent;
+ALTER TABLE users DROP COLUMN only_contacts;
+ALTER TABLE users DROP COLUMN read_receipts;
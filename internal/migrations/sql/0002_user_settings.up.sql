@@ -0,0 +1,13 @@
+-- Настройки приватности, присутствия, уведомлений и профиля пользователя
+ALTER TABLE users ADD COLUMN read_receipts BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE users ADD COLUMN only_contacts BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN block_silent BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE users ADD COLUMN discoverable BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE users ADD COLUMN presence_visibility VARCHAR(16) NOT NULL DEFAULT 'peers';
+ALTER TABLE users ADD COLUMN last_seen_at {{.Timestamp}};
+ALTER TABLE users ADD COLUMN push_previews BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN display_name VARCHAR(64);
+ALTER TABLE users ADD COLUMN bio VARCHAR(500);
+ALTER TABLE users ADD COLUMN status_text VARCHAR(140);
+ALTER TABLE users ADD COLUMN avatar_id VARCHAR(32);
+CREATE INDEX idx_users_avatar_id ON users (avatar_id);
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS idx_client_message;
+DROP INDEX IF EXISTS idx_messages_expires_at;
+DROP INDEX IF EXISTS idx_messages_reply_to_id;
+DROP INDEX IF EXISTS idx_messages_thread_root_id;
+ALTER TABLE messages DROP COLUMN client_message_id;
+ALTER TABLE messages DROP COLUMN suppressed;
+ALTER TABLE messages DROP COLUMN pending;
+ALTER TABLE messages DROP COLUMN thread_root_id;
+ALTER TABLE messages DROP COLUMN reply_to_id;
+ALTER TABLE messages DROP COLUMN expires_at;
+ALTER TABLE messages DROP COLUMN ttl_after_read;
+ALTER TABLE messages DROP COLUMN ttl_seconds;
+ALTER TABLE messages DROP COLUMN deleted_for_everyone_at;
+ALTER TABLE messages DROP COLUMN edited_at;
+ALTER TABLE messages DROP COLUMN read_at;
+ALTER TABLE messages DROP COLUMN delivered_at;
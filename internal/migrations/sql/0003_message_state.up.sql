@@ -0,0 +1,18 @@
+-- Состояние сообщения: доставка и прочтение, правки, удаление, исчезновение,
+-- ответы и треды, запросы на переписку, идемпотентная отправка
+ALTER TABLE messages ADD COLUMN delivered_at {{.Timestamp}};
+ALTER TABLE messages ADD COLUMN read_at {{.Timestamp}};
+ALTER TABLE messages ADD COLUMN edited_at {{.Timestamp}};
+ALTER TABLE messages ADD COLUMN deleted_for_everyone_at {{.Timestamp}};
+ALTER TABLE messages ADD COLUMN ttl_seconds BIGINT;
+ALTER TABLE messages ADD COLUMN ttl_after_read BOOLEAN;
+ALTER TABLE messages ADD COLUMN expires_at {{.Timestamp}};
+ALTER TABLE messages ADD COLUMN reply_to_id BIGINT;
+ALTER TABLE messages ADD COLUMN thread_root_id BIGINT;
+ALTER TABLE messages ADD COLUMN pending BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE messages ADD COLUMN suppressed BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE messages ADD COLUMN client_message_id VARCHAR(64);
+CREATE INDEX idx_messages_thread_root_id ON messages (thread_root_id);
+CREATE INDEX idx_messages_reply_to_id ON messages (reply_to_id);
+CREATE INDEX idx_messages_expires_at ON messages (expires_at);
+CREATE UNIQUE INDEX idx_client_message ON messages (sender_id, client_message_id);
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS push_notifications;
+DROP TABLE IF EXISTS device_tokens;
+DROP TABLE IF EXISTS scheduled_messages;
+DROP TABLE IF EXISTS stars;
+DROP TABLE IF EXISTS pins;
+DROP TABLE IF EXISTS message_requests;
+DROP TABLE IF EXISTS blocks;
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS search_tokens;
+DROP TABLE IF EXISTS reactions;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS conversation_mutes;
+DROP TABLE IF EXISTS conversation_settings;
+DROP TABLE IF EXISTS message_hides;
+DROP TABLE IF EXISTS message_versions;
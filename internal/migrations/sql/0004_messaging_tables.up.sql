@@ -0,0 +1,166 @@
+-- Таблицы функций, появившихся после базовой схемы
+
+CREATE TABLE message_versions (
+    id {{.ID}},
+    message_id BIGINT,
+    content TEXT,
+    encrypted BOOLEAN,
+    created_at {{.Timestamp}}
+);
+CREATE INDEX idx_message_versions_message_id ON message_versions (message_id);
+
+CREATE TABLE message_hides (
+    id {{.ID}},
+    message_id BIGINT,
+    user_id BIGINT,
+    created_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_message_hide ON message_hides (message_id, user_id);
+
+CREATE TABLE conversation_settings (
+    id {{.ID}},
+    user_low_id BIGINT,
+    user_high_id BIGINT,
+    ttl_seconds BIGINT,
+    ttl_after_read BOOLEAN,
+    updated_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_conversation_pair ON conversation_settings (user_low_id, user_high_id);
+
+CREATE TABLE conversation_mutes (
+    id {{.ID}},
+    user_id BIGINT,
+    peer_id BIGINT,
+    muted_until {{.Timestamp}},
+    created_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_conversation_mute ON conversation_mutes (user_id, peer_id);
+
+CREATE TABLE attachments (
+    id VARCHAR(32) PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    message_id BIGINT,
+    file_name TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    chunk_size BIGINT NOT NULL,
+    chunk_count BIGINT NOT NULL,
+    uploaded_chunks BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    key TEXT NOT NULL,
+    created_at {{.Timestamp}},
+    updated_at {{.Timestamp}}
+);
+CREATE INDEX idx_attachments_status ON attachments (status);
+CREATE INDEX idx_attachments_message_id ON attachments (message_id);
+CREATE INDEX idx_attachments_owner_id ON attachments (owner_id);
+
+CREATE TABLE reactions (
+    id {{.ID}},
+    message_id BIGINT,
+    user_id BIGINT,
+    emoji VARCHAR(32),
+    created_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_reaction ON reactions (message_id, user_id, emoji);
+
+CREATE TABLE search_tokens (
+    id {{.ID}},
+    message_id BIGINT NOT NULL,
+    token VARCHAR(32) NOT NULL
+);
+CREATE INDEX idx_search_tokens_token ON search_tokens (token);
+CREATE INDEX idx_search_tokens_message_id ON search_tokens (message_id);
+
+CREATE TABLE contacts (
+    id {{.ID}},
+    owner_id BIGINT,
+    contact_id BIGINT,
+    created_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_contact ON contacts (owner_id, contact_id);
+
+CREATE TABLE blocks (
+    id {{.ID}},
+    blocker_id BIGINT,
+    blocked_id BIGINT,
+    created_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_block ON blocks (blocker_id, blocked_id);
+
+CREATE TABLE message_requests (
+    id {{.ID}},
+    sender_id BIGINT,
+    receiver_id BIGINT,
+    status TEXT NOT NULL,
+    created_at {{.Timestamp}},
+    updated_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_message_request ON message_requests (sender_id, receiver_id);
+
+CREATE TABLE pins (
+    id {{.ID}},
+    message_id BIGINT,
+    user_low_id BIGINT,
+    user_high_id BIGINT,
+    pinned_by BIGINT,
+    created_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_pins_message_id ON pins (message_id);
+CREATE INDEX idx_pin_conversation ON pins (user_low_id, user_high_id);
+
+CREATE TABLE stars (
+    id {{.ID}},
+    message_id BIGINT,
+    user_id BIGINT,
+    created_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_star ON stars (message_id, user_id);
+
+CREATE TABLE scheduled_messages (
+    id {{.ID}},
+    sender_id BIGINT,
+    receiver_id BIGINT,
+    content TEXT,
+    encrypted BOOLEAN,
+    send_at {{.Timestamp}},
+    ttl_seconds BIGINT,
+    ttl_after_read BOOLEAN,
+    reply_to_id BIGINT,
+    thread_root_id BIGINT,
+    status TEXT NOT NULL,
+    failure_reason TEXT,
+    client_message_id VARCHAR(64),
+    version BIGINT NOT NULL DEFAULT 1,
+    attempts BIGINT NOT NULL DEFAULT 0,
+    created_at {{.Timestamp}},
+    updated_at {{.Timestamp}}
+);
+CREATE INDEX idx_scheduled_messages_sender_id ON scheduled_messages (sender_id);
+CREATE INDEX idx_scheduled_messages_send_at ON scheduled_messages (send_at);
+CREATE INDEX idx_scheduled_messages_status ON scheduled_messages (status);
+CREATE UNIQUE INDEX idx_scheduled_client_message ON scheduled_messages (sender_id, client_message_id);
+
+CREATE TABLE device_tokens (
+    id {{.ID}},
+    user_id BIGINT,
+    platform VARCHAR(16) NOT NULL,
+    token VARCHAR(512) NOT NULL,
+    created_at {{.Timestamp}},
+    updated_at {{.Timestamp}}
+);
+CREATE UNIQUE INDEX idx_device_tokens_token ON device_tokens (token);
+CREATE INDEX idx_device_tokens_user_id ON device_tokens (user_id);
+
+CREATE TABLE push_notifications (
+    id {{.ID}},
+    device_token_id BIGINT,
+    payload TEXT,
+    attempts BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at {{.Timestamp}},
+    last_error TEXT,
+    created_at {{.Timestamp}}
+);
+CREATE INDEX idx_push_notifications_device_token_id ON push_notifications (device_token_id);
+CREATE INDEX idx_push_notifications_next_attempt_at ON push_notifications (next_attempt_at);
+
@@ -0,0 +1,2 @@
+-- Язык ответов API из настроек пользователя; пустая строка — по Accept-Language
+ALTER TABLE users ADD COLUMN locale VARCHAR(8) NOT NULL DEFAULT '';
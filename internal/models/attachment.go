@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	AttachmentUploading = "uploading"
+	AttachmentComplete  = "complete"
+	AttachmentDeleted   = "deleted" // сообщение удалено, файл ждёт сборщика мусора
+)
+
+// Attachment — зашифрованный файл, загружаемый по частям и прикрепляемый к сообщению
+type Attachment struct {
+	ID             string    `gorm:"primaryKey;size:32" json:"id"`
+	OwnerID        uint      `gorm:"index;not null" json:"owner_id"`
+	MessageID      *uint     `gorm:"index" json:"message_id,omitempty"`
+	FileName       string    `gorm:"not null" json:"file_name"`
+	MimeType       string    `gorm:"not null" json:"mime_type"`
+	Size           int64     `gorm:"not null" json:"size"`
+	ChunkSize      int       `gorm:"not null" json:"chunk_size"`
+	ChunkCount     int       `gorm:"not null" json:"chunk_count"`
+	UploadedChunks int       `gorm:"not null;default:0" json:"uploaded_chunks"`
+	Status         string    `gorm:"index;not null" json:"status"`
+	Key            string    `gorm:"not null" json:"-"` // ключ файла, зашифрованный серверным AES-ключом
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	MessageRequestPending  = "pending"
+	MessageRequestAccepted = "accepted"
+	MessageRequestDeclined = "declined"
+)
+
+// Contact — пользователь ContactID в списке контактов OwnerID
+type Contact struct {
+	ID        uint `gorm:"primaryKey"`
+	OwnerID   uint `gorm:"uniqueIndex:idx_contact"`
+	ContactID uint `gorm:"uniqueIndex:idx_contact"`
+	CreatedAt time.Time
+}
+
+// Block — BlockerID не принимает сообщения от BlockedID
+type Block struct {
+	ID        uint `gorm:"primaryKey"`
+	BlockerID uint `gorm:"uniqueIndex:idx_block"`
+	BlockedID uint `gorm:"uniqueIndex:idx_block"`
+	CreatedAt time.Time
+}
+
+// MessageRequest — первое обращение незнакомца к пользователю, принимающему сообщения только от контактов
+type MessageRequest struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	SenderID   uint      `gorm:"uniqueIndex:idx_message_request" json:"sender_id"`
+	ReceiverID uint      `gorm:"uniqueIndex:idx_message_request" json:"receiver_id"`
+	Status     string    `gorm:"not null" json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// ConversationSetting — настройки переписки двух пользователей, общие для обоих участников
+type ConversationSetting struct {
+	ID           uint `gorm:"primaryKey"`
+	UserLowID    uint `gorm:"uniqueIndex:idx_conversation_pair"`
+	UserHighID   uint `gorm:"uniqueIndex:idx_conversation_pair"`
+	TTLSeconds   int  // 0 — сообщения не исчезают
+	TTLAfterRead bool // отсчитывать срок жизни от прочтения, а не от отправки
+	UpdatedAt    time.Time
+}
+
+// ConversationMute — пользователь отключил уведомления о сообщениях собеседника
+type ConversationMute struct {
+	ID         uint       `gorm:"primaryKey"`
+	UserID     uint       `gorm:"uniqueIndex:idx_conversation_mute"`
+	PeerID     uint       `gorm:"uniqueIndex:idx_conversation_mute"`
+	MutedUntil *time.Time // nil — до отмены
+	CreatedAt  time.Time
+}
+
+// ConversationPair упорядочивает ID участников, чтобы пара (a, b) и (b, a) была одной перепиской
+func ConversationPair(a, b uint) (low, high uint) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
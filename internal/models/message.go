@@ -5,10 +5,81 @@ import (
 )
 
 type Message struct {
+	ID          uint `gorm:"primaryKey"`
+	SenderID    uint `gorm:"uniqueIndex:idx_client_message"`
+	ReceiverID  uint
+	Content     string
+	Encrypted   bool
+	CreatedAt   time.Time
+	DeliveredAt *time.Time // когда получатель впервые загрузил сообщение
+	ReadAt      *time.Time // когда получатель отметил сообщение прочитанным
+	EditedAt    *time.Time // время последнего редактирования
+	// Удалено отправителем "для всех": содержимое стёрто, остаётся только "надгробие"
+	DeletedForEveryoneAt *time.Time
+	// Исчезающие сообщения: срок жизни отсчитывается от отправки либо от прочтения
+	TTLSeconds   int
+	TTLAfterRead bool
+	ExpiresAt    *time.Time `gorm:"index"`
+	// Ответ на конкретное сообщение и принадлежность к ветке обсуждения
+	ReplyToID    *uint `gorm:"index"`
+	ThreadRootID *uint `gorm:"index"`
+	// Сообщение незнакомца ждёт, пока получатель примет запрос на переписку
+	Pending bool `gorm:"not null;default:false"`
+	// Сообщение от заблокированного отправителя: видно только ему самому и никогда не доставляется.
+	// В JSON не попадает, чтобы отправитель не узнал о блокировке.
+	Suppressed bool `gorm:"not null;default:false" json:"-"`
+	// Идентификатор, выданный клиентом: повторная отправка с тем же ID не создаёт дубль
+	ClientMessageID *string `gorm:"size:64;uniqueIndex:idx_client_message"`
+}
+
+// MessageVersion — предыдущая (зашифрованная) версия отредактированного сообщения
+type MessageVersion struct {
+	ID        uint `gorm:"primaryKey"`
+	MessageID uint `gorm:"index"`
+	Content   string
+	Encrypted bool
+	CreatedAt time.Time // когда была написана эта версия
+}
+
+// MessageHide — сообщение, удалённое пользователем только у себя
+type MessageHide struct {
+	ID        uint `gorm:"primaryKey"`
+	MessageID uint `gorm:"uniqueIndex:idx_message_hide"`
+	UserID    uint `gorm:"uniqueIndex:idx_message_hide"`
+	CreatedAt time.Time
+}
+
+// Reaction — эмодзи-реакция пользователя на сообщение
+type Reaction struct {
+	ID        uint   `gorm:"primaryKey"`
+	MessageID uint   `gorm:"uniqueIndex:idx_reaction"`
+	UserID    uint   `gorm:"uniqueIndex:idx_reaction"`
+	Emoji     string `gorm:"uniqueIndex:idx_reaction;size:32"`
+	CreatedAt time.Time
+}
+
+// Pin — сообщение, закреплённое в переписке; закрепления общие для обоих участников
+type Pin struct {
 	ID         uint `gorm:"primaryKey"`
-	SenderID   uint
-	ReceiverID uint
-	Content    string
-	Encrypted  bool
+	MessageID  uint `gorm:"uniqueIndex"`
+	UserLowID  uint `gorm:"index:idx_pin_conversation"`
+	UserHighID uint `gorm:"index:idx_pin_conversation"`
+	PinnedBy   uint
 	CreatedAt  time.Time
 }
+
+// Star — сообщение, сохранённое пользователем в личное "Избранное"
+type Star struct {
+	ID        uint `gorm:"primaryKey"`
+	MessageID uint `gorm:"uniqueIndex:idx_star"`
+	UserID    uint `gorm:"uniqueIndex:idx_star"`
+	CreatedAt time.Time
+}
+
+// SearchToken — слепой индекс слова сообщения (HMAC от нормализованного слова);
+// хранится отдельно от шифротекста и не раскрывает содержимое
+type SearchToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	MessageID uint   `gorm:"index;not null"`
+	Token     string `gorm:"index;size:32;not null"`
+}
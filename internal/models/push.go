@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWeb     = "web"
+)
+
+// DeviceToken — токен push-уведомлений устройства пользователя
+type DeviceToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Platform  string `gorm:"size:16;not null"`
+	Token     string `gorm:"size:512;not null;uniqueIndex"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PushNotification — уведомление в очереди на отправку одному устройству.
+// Payload зашифрован: в нём может быть текст сообщения.
+type PushNotification struct {
+	ID            uint `gorm:"primaryKey"`
+	DeviceTokenID uint `gorm:"index"`
+	Payload       string
+	Attempts      int       `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string
+	CreatedAt     time.Time
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ScheduledPending = "pending"
+	ScheduledFailed  = "failed" // доставить не удалось (например, получатель заблокировал отправителя)
+)
+
+// ScheduledMessage — сообщение, отложенное до SendAt. Содержимое зашифровано так же,
+// как у обычных сообщений; при доставке запись удаляется в той же транзакции,
+// в которой создаётся сообщение.
+type ScheduledMessage struct {
+	ID            uint `gorm:"primaryKey"`
+	SenderID      uint `gorm:"index;uniqueIndex:idx_scheduled_client_message"`
+	ReceiverID    uint
+	Content       string
+	Encrypted     bool
+	SendAt        time.Time `gorm:"index"`
+	TTLSeconds    *int      // nil — срок жизни из настроек переписки на момент доставки
+	TTLAfterRead  bool
+	ReplyToID     *uint
+	ThreadRootID  *uint
+	Status        string `gorm:"not null;index"`
+	FailureReason string
+	// Передаётся сообщению при доставке; см. Message.ClientMessageID
+	ClientMessageID *string `gorm:"size:64;uniqueIndex:idx_scheduled_client_message"`
+	// Версия меняется при каждом редактировании: доставка отправляет только ту версию, которую прочитала
+	Version int `gorm:"not null;default:1"`
+	// Неудачные попытки доставки из-за временных ошибок; см. MessageScheduler.MaxAttempts
+	Attempts  int `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
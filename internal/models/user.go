@@ -6,15 +6,37 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	PresenceVisibilityPeers    = "peers"
+	PresenceVisibilityContacts = "contacts"
+	PresenceVisibilityNobody   = "nobody"
+)
+
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	Name         string         `gorm:"not null" json:"name"`
-	Email        string         `gorm:"unique;not null" json:"email"`
-	PasswordHash string         `gorm:"not null" json:"-"`
-	Role         string         `gorm:"not null" json:"role"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Name         string `gorm:"not null" json:"name"`
+	Email        string `gorm:"unique;not null" json:"email"`
+	PasswordHash string `gorm:"not null" json:"-"`
+	Role         string `gorm:"not null" json:"role"`
+	ReadReceipts bool   `gorm:"not null;default:true" json:"read_receipts"`  // отправлять ли отчёты о прочтении
+	OnlyContacts bool   `gorm:"not null;default:false" json:"only_contacts"` // незнакомцы пишут через запрос на переписку
+	BlockSilent  bool   `gorm:"not null;default:true" json:"block_silent"`   // не сообщать заблокированным об отказе
+	Discoverable bool   `gorm:"not null;default:true" json:"discoverable"`   // находится ли пользователь в поиске
+	// Кто видит онлайн-статус: собеседники и контакты, только контакты или никто
+	PresenceVisibility string     `gorm:"size:16;not null;default:peers" json:"presence_visibility"`
+	LastSeenAt         *time.Time `json:"-"` // отдаётся только с учётом PresenceVisibility
+	// Показывать ли текст сообщения в push-уведомлениях (по умолчанию — только факт сообщения)
+	PushPreviews bool `gorm:"not null;default:false" json:"push_previews"`
+	// Язык ошибок и системных сообщений (en, ru); пусто — по заголовку Accept-Language
+	Locale string `gorm:"size:8;not null;default:''" json:"locale"`
+	// Публичный профиль
+	DisplayName string         `gorm:"size:64" json:"display_name"`
+	Bio         string         `gorm:"size:500" json:"bio"`
+	StatusText  string         `gorm:"size:140" json:"status_text"`
+	AvatarID    *string        `gorm:"size:32;index" json:"avatar_id"` // загруженное владельцем вложение-изображение
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 type RefreshToken struct {
 	ID        uint   `gorm:"primaryKey"`
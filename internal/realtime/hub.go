@@ -0,0 +1,106 @@
+package realtime
+
+import (
+	"sync"
+)
+
+// subscriberBuffer — сколько событий может накопиться у медленного клиента,
+// прежде чем новые начнут отбрасываться
+const subscriberBuffer = 32
+
+// Event — событие, доставляемое клиенту через открытое соединение
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Hub рассылает события активным соединениям пользователей внутри одного процесса
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[uint]map[chan Event]struct{}
+	closed      bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[uint]map[chan Event]struct{})}
+}
+
+// Subscribe регистрирует соединение пользователя; вызов cancel закрывает канал
+func (h *Hub) Subscribe(userID uint) (events <-chan Event, cancel func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if _, ok := h.subscribers[userID][ch]; !ok {
+				return // канал уже закрыт в Close
+			}
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish отправляет событие во все соединения пользователя, не блокируясь на медленных клиентах
+func (h *Hub) Publish(userID uint, event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Online — есть ли у пользователя хотя бы одно активное соединение
+func (h *Hub) Online(userID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers[userID]) > 0
+}
+
+// ConnectionCount — общее число активных соединений
+func (h *Hub) ConnectionCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	total := 0
+	for _, subs := range h.subscribers {
+		total += len(subs)
+	}
+	return total
+}
+
+// Close закрывает все соединения, чтобы открытые потоки событий завершились
+// и сервер мог остановиться; новые подписки сразу получают закрытый канал
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subs := range h.subscribers {
+		for ch := range subs {
+			close(ch)
+		}
+	}
+	h.subscribers = make(map[uint]map[chan Event]struct{})
+	h.closed = true
+}
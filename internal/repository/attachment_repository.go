@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"secure-messenger/internal/models"
+	"secure-messenger/pkg/apperror"
+)
+
+// ErrAttachmentUnavailable — вложение не найдено, не загружено до конца или уже прикреплено
+var ErrAttachmentUnavailable = apperror.New(apperror.KindNotFound, "attachment_unavailable", "attachment unavailable")
+
+type AttachmentRepository struct {
+	DB *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{DB: db}
+}
+
+// WithContext возвращает репозиторий, запросы которого выполняются в контексте ctx
+func (r *AttachmentRepository) WithContext(ctx context.Context) *AttachmentRepository {
+	return &AttachmentRepository{DB: r.DB.WithContext(ctx)}
+}
+
+func (r *AttachmentRepository) Create(a *models.Attachment) error {
+	return r.DB.Create(a).Error
+}
+
+func (r *AttachmentRepository) GetByID(id string) (*models.Attachment, error) {
+	var a models.Attachment
+	if err := r.DB.Where("id = ?", id).First(&a).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &a, nil
+}
+
+// AdvanceChunks отмечает фрагмент index принятым. Условие на uploaded_chunks
+// защищает от гонки двух параллельных загрузок одного и того же фрагмента.
+func (r *AttachmentRepository) AdvanceChunks(a *models.Attachment, index int) error {
+	updates := map[string]interface{}{"uploaded_chunks": index + 1}
+	if index+1 == a.ChunkCount {
+		updates["status"] = models.AttachmentComplete
+	}
+
+	res := r.DB.Model(&models.Attachment{}).
+		Where("id = ? AND uploaded_chunks = ? AND status = ?", a.ID, index, models.AttachmentUploading).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAttachmentUnavailable
+	}
+	return nil
+}
+
+func (r *AttachmentRepository) GetForMessages(messageIDs []uint) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+	err := r.DB.Where("message_id IN ? AND status = ?", messageIDs, models.AttachmentComplete).
+		Order("created_at").Find(&attachments).Error
+	return attachments, err
+}
+
+// FindGarbage возвращает вложения, которые пора удалить: помеченные удалёнными
+// и так и не прикреплённые к сообщению загрузки старше staleBefore (кроме аватаров)
+func (r *AttachmentRepository) FindGarbage(staleBefore time.Time, limit int) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.DB.Scopes(garbage(staleBefore)).Limit(limit).Find(&attachments).Error
+	return attachments, err
+}
+
+// garbage ограничивает выборку вложениями, которые пора удалить (см. FindGarbage)
+func garbage(staleBefore time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(status = ? OR (message_id IS NULL AND created_at < ? AND NOT EXISTS (?)))",
+			models.AttachmentDeleted, staleBefore, avatarOwners(db))
+	}
+}
+
+// IsAvatar сообщает, стоит ли вложение аватаром у какого-либо пользователя
+func (r *AttachmentRepository) IsAvatar(id string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.User{}).Where("avatar_id = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteGarbage удаляет запись вложения, только если оно всё ещё мусор: его могли
+// прикрепить к сообщению между FindGarbage и удалением. purge вызывается, лишь когда
+// запись действительно удалена, внутри той же транзакции — если он вернёт ошибку,
+// запись останется и удаление повторится при следующем проходе.
+func (r *AttachmentRepository) DeleteGarbage(id string, staleBefore time.Time, purge func() error) (bool, error) {
+	deleted := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Scopes(garbage(staleBefore)).Where("id = ?", id).Delete(&models.Attachment{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		deleted = true
+		return purge()
+	})
+	return deleted && err == nil, err
+}
+
+// attachToMessage привязывает загруженные вложения отправителя к сообщению внутри транзакции
+func attachToMessage(tx *gorm.DB, msg *models.Message, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	res := tx.Model(&models.Attachment{}).
+		Where("id IN ? AND owner_id = ? AND status = ? AND message_id IS NULL", ids, msg.SenderID, models.AttachmentComplete).
+		Where("NOT EXISTS (?)", avatarOwners(tx)).
+		Update("message_id", msg.ID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != int64(len(ids)) {
+		return ErrAttachmentUnavailable
+	}
+	return nil
+}
+
+// markMessageAttachmentsDeleted передаёт вложения удалённых сообщений сборщику мусора
+func markMessageAttachmentsDeleted(tx *gorm.DB, messageIDs []uint) error {
+	return tx.Model(&models.Attachment{}).Where("message_id IN ?", messageIDs).
+		Updates(map[string]interface{}{"status": models.AttachmentDeleted, "message_id": nil}).Error
+}
+
+// avatarOwners — подзапрос: действующие пользователи, у которых вложение стоит аватаром
+func avatarOwners(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.User{}).
+		Select("1").Where("users.avatar_id = attachments.id")
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"secure-messenger/internal/models"
+)
+
+type ContactRepository struct {
+	DB *gorm.DB
+}
+
+func NewContactRepository(db *gorm.DB) *ContactRepository {
+	return &ContactRepository{DB: db}
+}
+
+// WithContext возвращает репозиторий, запросы которого выполняются в контексте ctx
+func (r *ContactRepository) WithContext(ctx context.Context) *ContactRepository {
+	return &ContactRepository{DB: r.DB.WithContext(ctx)}
+}
+
+func (r *ContactRepository) AddContact(ownerID, contactID uint) error {
+	contact := &models.Contact{OwnerID: ownerID, ContactID: contactID}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(contact).Error
+}
+
+func (r *ContactRepository) RemoveContact(ownerID, contactID uint) (bool, error) {
+	res := r.DB.Where("owner_id = ? AND contact_id = ?", ownerID, contactID).Delete(&models.Contact{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListContacts возвращает контакты пользователя (удалённые аккаунты пропускаются)
+func (r *ContactRepository) ListContacts(ownerID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.DB.Joins("JOIN contacts ON contacts.contact_id = users.id").
+		Where("contacts.owner_id = ?", ownerID).
+		Order("users.name, users.id").Find(&users).Error
+	return users, err
+}
+
+func (r *ContactRepository) IsContact(ownerID, contactID uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Contact{}).
+		Where("owner_id = ? AND contact_id = ?", ownerID, contactID).Count(&count).Error
+	return count > 0, err
+}
+
+// Block блокирует пользователя и убирает его из контактов блокирующего
+func (r *ContactRepository) Block(blockerID, blockedID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		block := &models.Block{BlockerID: blockerID, BlockedID: blockedID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(block).Error; err != nil {
+			return err
+		}
+		return tx.Where("owner_id = ? AND contact_id = ?", blockerID, blockedID).Delete(&models.Contact{}).Error
+	})
+}
+
+func (r *ContactRepository) Unblock(blockerID, blockedID uint) (bool, error) {
+	res := r.DB.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.Block{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *ContactRepository) ListBlocked(blockerID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.DB.Joins("JOIN blocks ON blocks.blocked_id = users.id").
+		Where("blocks.blocker_id = ?", blockerID).
+		Order("users.name, users.id").Find(&users).Error
+	return users, err
+}
+
+func (r *ContactRepository) IsBlocked(blockerID, blockedID uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Block{}).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetRequest возвращает запрос на переписку от senderID к receiverID; nil — запроса не было
+func (r *ContactRepository) GetRequest(senderID, receiverID uint) (*models.MessageRequest, error) {
+	var req models.MessageRequest
+	err := r.DB.Where("sender_id = ? AND receiver_id = ?", senderID, receiverID).First(&req).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *ContactRepository) GetRequestByID(id uint) (*models.MessageRequest, error) {
+	var req models.MessageRequest
+	if err := r.DB.First(&req, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &req, nil
+}
+
+// createRequest создаёт запрос внутри транзакции; если он уже есть (параллельная отправка), ничего не меняет
+func createRequest(tx *gorm.DB, senderID, receiverID uint) error {
+	req := &models.MessageRequest{SenderID: senderID, ReceiverID: receiverID, Status: models.MessageRequestPending}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(req).Error
+}
+
+func (r *ContactRepository) ListIncomingRequests(receiverID uint) ([]models.MessageRequest, error) {
+	var reqs []models.MessageRequest
+	err := r.DB.Where("receiver_id = ? AND status = ?", receiverID, models.MessageRequestPending).
+		Order("id").Find(&reqs).Error
+	return reqs, err
+}
+
+// AcceptRequest принимает запрос: отправитель попадает в контакты получателя,
+// а его ожидавшие сообщения становятся обычными
+func (r *ContactRepository) AcceptRequest(req *models.MessageRequest) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(req).Update("status", models.MessageRequestAccepted).Error; err != nil {
+			return err
+		}
+		contact := &models.Contact{OwnerID: req.ReceiverID, ContactID: req.SenderID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(contact).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Message{}).
+			Where("sender_id = ? AND receiver_id = ? AND pending = ?", req.SenderID, req.ReceiverID, true).
+			Update("pending", false).Error
+	})
+}
+
+// DeclineRequest отклоняет запрос и безвозвратно удаляет ожидавшие сообщения
+func (r *ContactRepository) DeclineRequest(req *models.MessageRequest) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(req).Update("status", models.MessageRequestDeclined).Error; err != nil {
+			return err
+		}
+		var ids []uint
+		if err := tx.Model(&models.Message{}).
+			Where("sender_id = ? AND receiver_id = ? AND pending = ?", req.SenderID, req.ReceiverID, true).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		_, err := purgeMessages(tx, ids)
+		return err
+	})
+}
+
+// ContactIDs возвращает ID контактов пользователя
+func (r *ContactRepository) ContactIDs(ownerID uint) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Model(&models.Contact{}).Where("owner_id = ?", ownerID).Pluck("contact_id", &ids).Error
+	return ids, err
+}
+
+func (r *ContactRepository) BlockedIDs(blockerID uint) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Model(&models.Block{}).Where("blocker_id = ?", blockerID).Pluck("blocked_id", &ids).Error
+	return ids, err
+}
+
+// IsPeer — переписывались ли пользователи (недоставленные сообщения не в счёт)
+func (r *ContactRepository) IsPeer(a, b uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Message{}).
+		Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND pending = ? AND suppressed = ?", a, b, b, a, false, false).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// PeerIDs возвращает всех, с кем пользователь переписывался
+func (r *ContactRepository) PeerIDs(userID uint) ([]uint, error) {
+	var received, sent []uint
+	if err := r.DB.Model(&models.Message{}).Distinct("sender_id").
+		Where("receiver_id = ? AND pending = ? AND suppressed = ?", userID, false, false).Pluck("sender_id", &received).Error; err != nil {
+		return nil, err
+	}
+	if err := r.DB.Model(&models.Message{}).Distinct("receiver_id").
+		Where("sender_id = ? AND pending = ? AND suppressed = ?", userID, false, false).Pluck("receiver_id", &sent).Error; err != nil {
+		return nil, err
+	}
+	return append(received, sent...), nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"secure-messenger/internal/models"
+)
+
+type ConversationRepository struct {
+	DB *gorm.DB
+}
+
+func NewConversationRepository(db *gorm.DB) *ConversationRepository {
+	return &ConversationRepository{DB: db}
+}
+
+// WithContext возвращает репозиторий, запросы которого выполняются в контексте ctx
+func (r *ConversationRepository) WithContext(ctx context.Context) *ConversationRepository {
+	return &ConversationRepository{DB: r.DB.WithContext(ctx)}
+}
+
+// GetSetting возвращает настройки переписки; если их ещё нет — значения по умолчанию
+func (r *ConversationRepository) GetSetting(a, b uint) (*models.ConversationSetting, error) {
+	low, high := models.ConversationPair(a, b)
+
+	var setting models.ConversationSetting
+	err := r.DB.Where("user_low_id = ? AND user_high_id = ?", low, high).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.ConversationSetting{UserLowID: low, UserHighID: high}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+func (r *ConversationRepository) SaveSetting(setting *models.ConversationSetting) error {
+	setting.UserLowID, setting.UserHighID = models.ConversationPair(setting.UserLowID, setting.UserHighID)
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_low_id"}, {Name: "user_high_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ttl_seconds", "ttl_after_read", "updated_at"}),
+	}).Create(setting).Error
+}
+
+// GetMute возвращает действующее отключение уведомлений (nil — уведомления включены)
+func (r *ConversationRepository) GetMute(userID, peerID uint, now time.Time) (*models.ConversationMute, error) {
+	var mute models.ConversationMute
+	err := r.DB.Where("user_id = ? AND peer_id = ?", userID, peerID).
+		Where("muted_until IS NULL OR muted_until > ?", now).
+		First(&mute).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+func (r *ConversationRepository) SaveMute(mute *models.ConversationMute) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "peer_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"muted_until"}),
+	}).Create(mute).Error
+}
+
+func (r *ConversationRepository) DeleteMute(userID, peerID uint) error {
+	return r.DB.Where("user_id = ? AND peer_id = ?", userID, peerID).Delete(&models.ConversationMute{}).Error
+}
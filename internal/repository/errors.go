@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"secure-messenger/pkg/apperror"
+)
+
+// ErrNotFound — запись не найдена. Возвращается обёрткой над gorm.ErrRecordNotFound,
+// так что errors.Is срабатывает для обоих.
+var ErrNotFound = apperror.New(apperror.KindNotFound, "not_found", "record not found")
+
+// notFound переводит gorm.ErrRecordNotFound в ErrNotFound, остальные ошибки — как есть
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound.Wrap(err)
+	}
+	return err
+}
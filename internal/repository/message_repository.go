@@ -1,10 +1,29 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"secure-messenger/internal/models"
+	"secure-messenger/pkg/apperror"
 )
 
+// ErrPinLimit — в переписке уже закреплено максимальное число сообщений
+var ErrPinLimit = apperror.New(apperror.KindConflict, "pin_limit_reached", "pin limit reached")
+
+// ErrReactionLimit — на сообщении уже максимальное число разных реакций
+var ErrReactionLimit = apperror.New(apperror.KindConflict, "reaction_limit_reached", "reaction limit reached")
+
+// ErrStaleMessage — сообщение изменилось после того, как его прочитали
+var ErrStaleMessage = apperror.New(apperror.KindConflict, "stale_message", "message was modified concurrently")
+
+// ErrDeletedMessage — сообщение удалено у всех, пока его редактировали
+var ErrDeletedMessage = apperror.New(apperror.KindGone, "message_deleted", "message deleted")
+
 type MessageRepository struct {
 	DB *gorm.DB
 }
@@ -13,16 +32,519 @@ func NewMessageRepository(db *gorm.DB) *MessageRepository {
 	return &MessageRepository{DB: db}
 }
 
-func (r *MessageRepository) CreateMessage(msg *models.Message) error {
-	return r.DB.Create(msg).Error
+// WithContext возвращает репозиторий, запросы которого выполняются в контексте ctx
+func (r *MessageRepository) WithContext(ctx context.Context) *MessageRepository {
+	return &MessageRepository{DB: r.DB.WithContext(ctx)}
+}
+
+// CreateMessage сохраняет сообщение, его поисковые токены и привязывает уже загруженные вложения
+func (r *MessageRepository) CreateMessage(msg *models.Message, attachmentIDs []string, tokens []string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return createMessage(tx, msg, attachmentIDs, tokens)
+	})
+}
+
+// createMessage сохраняет сообщение вместе с поисковыми токенами и вложениями внутри транзакции.
+// Для ожидающего сообщения там же создаётся запрос на переписку, чтобы не оставить запрос без сообщения.
+func createMessage(tx *gorm.DB, msg *models.Message, attachmentIDs []string, tokens []string) error {
+	if msg.Pending {
+		if err := createRequest(tx, msg.SenderID, msg.ReceiverID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Create(msg).Error; err != nil {
+		return err
+	}
+	if err := saveSearchTokens(tx, msg.ID, tokens); err != nil {
+		return err
+	}
+	return attachToMessage(tx, msg, attachmentIDs)
+}
+
+// GetByClientID ищет сообщение отправителя по идентификатору, выданному клиентом,
+// без учёта видимости: повтор запроса должен найти его, даже если оно уже скрыто
+func (r *MessageRepository) GetByClientID(senderID uint, clientID string) (*models.Message, error) {
+	var msg models.Message
+	if err := r.DB.Where("sender_id = ? AND client_message_id = ?", senderID, clientID).First(&msg).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &msg, nil
+}
+
+// visibleTo ограничивает выборку сообщениями, которые видит пользователь:
+// он участник переписки, не скрыл сообщение у себя, срок жизни сообщения не истёк
+// и это не входящее сообщение от незнакомца, ожидающее принятия запроса на переписку,
+// и не сообщение от заблокированного отправителя
+func visibleTo(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(messages.sender_id = ? OR messages.receiver_id = ?)", userID, userID).
+			Where("NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = messages.id AND h.user_id = ?)", userID).
+			Where("NOT ((messages.pending = ? OR messages.suppressed = ?) AND messages.receiver_id = ?)", true, true, userID).
+			Where("(messages.expires_at IS NULL OR messages.expires_at > ?)", time.Now())
+	}
 }
 
+// GetMessagesForUser возвращает основную ленту пользователя — без сообщений из веток
 func (r *MessageRepository) GetMessagesForUser(userID uint) ([]models.Message, error) {
 	var messages []models.Message
-	err := r.DB.Where("receiver_id = ?", userID).Or("sender_id = ?", userID).Find(&messages).Error
+	err := r.DB.Scopes(visibleTo(userID)).Where("messages.thread_root_id IS NULL").
+		Order("messages.id").Find(&messages).Error
+	return messages, err
+}
+
+// GetThread возвращает до limit сообщений ветки с ID меньше beforeID (0 — с конца), по возрастанию ID
+func (r *MessageRepository) GetThread(rootID, userID, beforeID uint, limit int) ([]models.Message, error) {
+	query := r.DB.Scopes(visibleTo(userID)).Where("messages.thread_root_id = ?", rootID)
+	if beforeID > 0 {
+		query = query.Where("messages.id < ?", beforeID)
+	}
+
+	var messages []models.Message
+	if err := query.Order("messages.id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// CountThreadReplies считает видимые пользователю ответы в ветках с указанными корнями
+func (r *MessageRepository) CountThreadReplies(rootIDs []uint, userID uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64)
+	if len(rootIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ThreadRootID uint
+		Count        int64
+	}
+	err := r.DB.Model(&models.Message{}).Scopes(visibleTo(userID)).
+		Select("messages.thread_root_id, COUNT(*) AS count").
+		Where("messages.thread_root_id IN ?", rootIDs).
+		Group("messages.thread_root_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.ThreadRootID] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *MessageRepository) GetVisibleMessages(ids []uint, userID uint) ([]models.Message, error) {
+	var messages []models.Message
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	err := r.DB.Scopes(visibleTo(userID)).Where("messages.id IN ?", ids).Find(&messages).Error
+	return messages, err
+}
+
+// GetVisibleMessage возвращает сообщение, если пользователь участник переписки и не скрыл его
+func (r *MessageRepository) GetVisibleMessage(id, userID uint) (*models.Message, error) {
+	var msg models.Message
+	if err := r.DB.Scopes(visibleTo(userID)).Where("messages.id = ?", id).First(&msg).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &msg, nil
+}
+
+// HideMessage скрывает сообщение только для указанного пользователя
+func (r *MessageRepository) HideMessage(id, userID uint) error {
+	hide := &models.MessageHide{MessageID: id, UserID: userID}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(hide).Error
+}
+
+// TombstoneMessage стирает содержимое и историю версий, оставляя отметку об удалении
+func (r *MessageRepository) TombstoneMessage(id uint, at time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Message{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"content":                 "",
+			"encrypted":               false,
+			"deleted_for_everyone_at": at,
+		}).Error; err != nil {
+			return err
+		}
+		if err := markMessageAttachmentsDeleted(tx, []uint{id}); err != nil {
+			return err
+		}
+		for _, related := range []interface{}{
+			&models.Reaction{}, &models.SearchToken{}, &models.Pin{}, &models.Star{},
+		} {
+			if err := tx.Where("message_id = ?", id).Delete(related).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("message_id = ?", id).Delete(&models.MessageVersion{}).Error
+	})
+}
+
+// MarkDelivered отмечает доставленными все входящие сообщения пользователя
+func (r *MessageRepository) MarkDelivered(receiverID uint, at time.Time) error {
+	return r.DB.Model(&models.Message{}).
+		Where("receiver_id = ? AND delivered_at IS NULL AND pending = ? AND suppressed = ?", receiverID, false, false).
+		Update("delivered_at", at).Error
+}
+
+// MarkRead отмечает прочитанными сообщения от peerID вплоть до upToID включительно.
+// Для исчезающих "после прочтения" сообщений здесь же начинается отсчёт срока жизни.
+func (r *MessageRepository) MarkRead(receiverID, peerID, upToID uint, at time.Time) (int64, error) {
+	var updated int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		unread := tx.Model(&models.Message{}).
+			Where("receiver_id = ? AND sender_id = ? AND id <= ? AND read_at IS NULL AND pending = ? AND suppressed = ?", receiverID, peerID, upToID, false, false).
+			Session(&gorm.Session{})
+
+		var timed []models.Message
+		if err := unread.Where("ttl_after_read = ? AND ttl_seconds > 0", true).
+			Select("id", "ttl_seconds").Find(&timed).Error; err != nil {
+			return err
+		}
+
+		res := unread.Updates(map[string]interface{}{
+			"read_at":      at,
+			"delivered_at": gorm.Expr("COALESCE(delivered_at, ?)", at),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		updated = res.RowsAffected
+
+		for _, msg := range timed {
+			expiresAt := at.Add(time.Duration(msg.TTLSeconds) * time.Second)
+			if err := tx.Model(&models.Message{}).Where("id = ?", msg.ID).
+				Update("expires_at", expiresAt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// UpdateContent сохраняет текущее содержимое в историю версий и заменяет его новым.
+// msg — версия, прочитанная вызывающим; если с тех пор сообщение успели отредактировать,
+// ничего не меняется и возвращается ErrStaleMessage, а если его успели удалить у всех —
+// ErrDeletedMessage: правка не должна вернуть текст в затёртое сообщение.
+func (r *MessageRepository) UpdateContent(msg *models.Message, content string, tokens []string, editedAt time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Message{}).
+			Where("id = ? AND edited_at IS NOT DISTINCT FROM ? AND deleted_for_everyone_at IS NULL", msg.ID, msg.EditedAt).
+			Updates(map[string]interface{}{
+				"content":   content,
+				"encrypted": true,
+				"edited_at": editedAt,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			var current models.Message
+			err := tx.Select("id", "deleted_for_everyone_at").Take(&current, msg.ID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && current.DeletedForEveryoneAt != nil) {
+				return ErrDeletedMessage
+			}
+			if err != nil {
+				return err
+			}
+			return ErrStaleMessage
+		}
+
+		versionCreatedAt := msg.CreatedAt
+		if msg.EditedAt != nil {
+			versionCreatedAt = *msg.EditedAt
+		}
+		version := &models.MessageVersion{
+			MessageID: msg.ID,
+			Content:   msg.Content,
+			Encrypted: msg.Encrypted,
+			CreatedAt: versionCreatedAt,
+		}
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		return replaceSearchTokens(tx, msg.ID, tokens)
+	})
+}
+
+func (r *MessageRepository) GetVersions(messageID uint) ([]models.MessageVersion, error) {
+	var versions []models.MessageVersion
+	err := r.DB.Where("message_id = ?", messageID).Order("created_at, id").Find(&versions).Error
+	return versions, err
+}
+
+// DeleteExpired безвозвратно удаляет до limit сообщений с истёкшим сроком жизни
+func (r *MessageRepository) DeleteExpired(now time.Time, limit int) (int64, error) {
+	var ids []uint
+	if err := r.DB.Model(&models.Message{}).
+		Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Order("expires_at").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var deleted int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		deleted, err = purgeMessages(tx, ids)
+		return err
+	})
+	return deleted, err
+}
+
+// purgeMessages удаляет сообщения вместе со всем, что к ним относится.
+// Перед удалением содержимое затирается.
+func purgeMessages(tx *gorm.DB, ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := tx.Model(&models.Message{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"content": "", "encrypted": false}).Error; err != nil {
+		return 0, err
+	}
+	for _, related := range []interface{}{
+		&models.MessageVersion{}, &models.MessageHide{}, &models.Reaction{}, &models.SearchToken{},
+		&models.Pin{}, &models.Star{},
+	} {
+		if err := tx.Where("message_id IN ?", ids).Delete(related).Error; err != nil {
+			return 0, err
+		}
+	}
+	if err := markMessageAttachmentsDeleted(tx, ids); err != nil {
+		return 0, err
+	}
+	res := tx.Where("id IN ?", ids).Delete(&models.Message{})
+	return res.RowsAffected, res.Error
+}
+
+// AddReaction добавляет реакцию; повторная такая же реакция ничего не меняет
+// AddReaction ставит реакцию, если новый вид эмодзи не превысит limit разных реакций
+// на сообщение (limit <= 0 — без ограничения). Проверка и вставка идут под блокировкой
+// сообщения, чтобы параллельные реакции не обошли лимит.
+// Возвращает false, если такая реакция уже есть; ErrReactionLimit — если лимит исчерпан.
+func (r *MessageRepository) AddReaction(reaction *models.Reaction, limit int) (bool, error) {
+	added := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if limit > 0 {
+			if err := lockMessage(tx, reaction.MessageID); err != nil {
+				return err
+			}
+			var emojis []string
+			if err := tx.Model(&models.Reaction{}).Where("message_id = ?", reaction.MessageID).
+				Distinct("emoji").Pluck("emoji", &emojis).Error; err != nil {
+				return err
+			}
+			if !slices.Contains(emojis, reaction.Emoji) && len(emojis) >= limit {
+				return ErrReactionLimit
+			}
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+		added = res.RowsAffected > 0
+		return res.Error
+	})
+	return added, err
+}
+
+func (r *MessageRepository) RemoveReaction(messageID, userID uint, emoji string) (bool, error) {
+	res := r.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.Reaction{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ReactionSummary — сколько раз поставлена реакция и есть ли среди них реакция пользователя
+type ReactionSummary struct {
+	MessageID   uint `json:"-"`
+	Emoji       string
+	Count       int64
+	ReactedByMe bool
+}
+
+func (r *MessageRepository) SummarizeReactions(messageIDs []uint, userID uint) ([]ReactionSummary, error) {
+	var summaries []ReactionSummary
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+	err := r.DB.Model(&models.Reaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, "+
+			"MAX(CASE WHEN user_id = ? THEN 1 ELSE 0 END) = 1 AS reacted_by_me", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("message_id, MIN(id)").
+		Scan(&summaries).Error
+	return summaries, err
+}
+
+// AddPin закрепляет сообщение, если в переписке меньше limit закреплений (limit <= 0 — без ограничения).
+// Возвращает false, если сообщение уже закреплено; ErrPinLimit — если лимит исчерпан.
+func (r *MessageRepository) AddPin(pin *models.Pin, limit int) (bool, error) {
+	pin.UserLowID, pin.UserHighID = models.ConversationPair(pin.UserLowID, pin.UserHighID)
+	added := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if limit > 0 {
+			if err := lockConversation(tx, pin.UserLowID, pin.UserHighID); err != nil {
+				return err
+			}
+		}
+		var existing int64
+		if err := tx.Model(&models.Pin{}).Where("message_id = ?", pin.MessageID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return nil
+		}
+		if limit > 0 {
+			var count int64
+			if err := tx.Model(&models.Pin{}).
+				Where("user_low_id = ? AND user_high_id = ?", pin.UserLowID, pin.UserHighID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= int64(limit) {
+				return ErrPinLimit
+			}
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(pin)
+		added = res.RowsAffected > 0
+		return res.Error
+	})
+	return added, err
+}
+
+// lockConversation блокирует строку настроек переписки до конца транзакции (при необходимости
+// создавая её), чтобы проверка лимита и вставка в этой переписке выполнялись по очереди
+func lockConversation(tx *gorm.DB, low, high uint) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.ConversationSetting{UserLowID: low, UserHighID: high}).Error; err != nil {
+		return err
+	}
+	var setting models.ConversationSetting
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_low_id = ? AND user_high_id = ?", low, high).First(&setting).Error
+}
+
+// lockMessage блокирует строку сообщения до конца транзакции
+func lockMessage(tx *gorm.DB, id uint) error {
+	var msg models.Message
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Take(&msg, id).Error
+}
+
+func (r *MessageRepository) RemovePin(messageID uint) (bool, error) {
+	res := r.DB.Where("message_id = ?", messageID).Delete(&models.Pin{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListPins возвращает закрепления переписки, новые первыми
+func (r *MessageRepository) ListPins(a, b uint) ([]models.Pin, error) {
+	low, high := models.ConversationPair(a, b)
+	var pins []models.Pin
+	err := r.DB.Where("user_low_id = ? AND user_high_id = ?", low, high).
+		Order("created_at DESC, id DESC").Find(&pins).Error
+	return pins, err
+}
+
+// PinnedIDs возвращает те из messageIDs, что закреплены
+func (r *MessageRepository) PinnedIDs(messageIDs []uint) (map[uint]bool, error) {
+	return r.messageIDSet(r.DB.Model(&models.Pin{}), messageIDs)
+}
+
+func (r *MessageRepository) AddStar(star *models.Star) (bool, error) {
+	res := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(star)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *MessageRepository) RemoveStar(messageID, userID uint) (bool, error) {
+	res := r.DB.Where("message_id = ? AND user_id = ?", messageID, userID).Delete(&models.Star{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// StarredIDs возвращает те из messageIDs, что пользователь сохранил в избранное
+func (r *MessageRepository) StarredIDs(messageIDs []uint, userID uint) (map[uint]bool, error) {
+	return r.messageIDSet(r.DB.Model(&models.Star{}).Where("user_id = ?", userID), messageIDs)
+}
+
+// ListStarred возвращает видимые пользователю сообщения из его избранного с ID меньше
+// beforeID (0 — с конца), от новых к старым
+func (r *MessageRepository) ListStarred(userID, beforeID uint, limit int) ([]models.Message, error) {
+	query := r.DB.Scopes(visibleTo(userID)).
+		Where("EXISTS (SELECT 1 FROM stars s WHERE s.message_id = messages.id AND s.user_id = ?)", userID)
+	if beforeID > 0 {
+		query = query.Where("messages.id < ?", beforeID)
+	}
+
+	var messages []models.Message
+	err := query.Order("messages.id DESC").Limit(limit).Find(&messages).Error
 	return messages, err
 }
 
-func (r *MessageRepository) DeleteMessage(id uint, userID uint) error {
-	return r.DB.Where("id = ? AND sender_id = ?", id, userID).Delete(&models.Message{}).Error
+func (r *MessageRepository) messageIDSet(query *gorm.DB, messageIDs []uint) (map[uint]bool, error) {
+	set := make(map[uint]bool)
+	if len(messageIDs) == 0 {
+		return set, nil
+	}
+	var ids []uint
+	if err := query.Where("message_id IN ?", messageIDs).Pluck("message_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set, nil
+}
+
+// SearchMessages ищет видимые пользователю сообщения, содержащие все токены запроса.
+// peerID > 0 ограничивает поиск перепиской с этим собеседником.
+func (r *MessageRepository) SearchMessages(userID uint, tokens []string, peerID, beforeID uint, limit int) ([]models.Message, error) {
+	matching := r.DB.Model(&models.SearchToken{}).
+		Select("message_id").
+		Where("token IN ?", tokens).
+		Group("message_id").
+		Having("COUNT(DISTINCT token) = ?", len(tokens))
+
+	query := r.DB.Scopes(visibleTo(userID)).Where("messages.id IN (?)", matching)
+	if peerID > 0 {
+		query = query.Where("(messages.sender_id = ? OR messages.receiver_id = ?)", peerID, peerID)
+	}
+	if beforeID > 0 {
+		query = query.Where("messages.id < ?", beforeID)
+	}
+
+	var messages []models.Message
+	err := query.Order("messages.id DESC").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+// ListForReindex возвращает очередную пачку неудалённых сообщений с ID больше afterID
+func (r *MessageRepository) ListForReindex(afterID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.DB.Where("id > ? AND deleted_for_everyone_at IS NULL", afterID).
+		Order("id").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+func (r *MessageRepository) ReplaceSearchTokens(messageID uint, tokens []string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceSearchTokens(tx, messageID, tokens)
+	})
+}
+
+func replaceSearchTokens(tx *gorm.DB, messageID uint, tokens []string) error {
+	if err := tx.Where("message_id = ?", messageID).Delete(&models.SearchToken{}).Error; err != nil {
+		return err
+	}
+	return saveSearchTokens(tx, messageID, tokens)
+}
+
+func saveSearchTokens(tx *gorm.DB, messageID uint, tokens []string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	rows := make([]models.SearchToken, len(tokens))
+	for i, token := range tokens {
+		rows[i] = models.SearchToken{MessageID: messageID, Token: token}
+	}
+	return tx.CreateInBatches(rows, 100).Error
 }
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"secure-messenger/internal/models"
+)
+
+type PushRepository struct {
+	DB *gorm.DB
+}
+
+func NewPushRepository(db *gorm.DB) *PushRepository {
+	return &PushRepository{DB: db}
+}
+
+// RegisterDevice сохраняет токен устройства. Токен, ранее принадлежавший другому
+// пользователю (на устройстве сменился аккаунт), переходит к новому владельцу.
+func (r *PushRepository) RegisterDevice(device *models.DeviceToken) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var previous models.DeviceToken
+		err := tx.Where("token = ?", device.Token).Limit(1).Find(&previous).Error
+		if err != nil {
+			return err
+		}
+		// Уведомления прежнему владельцу на это устройство больше не отправляются
+		if previous.ID != 0 && previous.UserID != device.UserID {
+			if err := tx.Where("device_token_id = ?", previous.ID).Delete(&models.PushNotification{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "updated_at"}),
+		}).Create(device).Error
+	})
+}
+
+func (r *PushRepository) ListDevices(userID uint) ([]models.DeviceToken, error) {
+	var devices []models.DeviceToken
+	err := r.DB.Where("user_id = ?", userID).Order("id").Find(&devices).Error
+	return devices, err
+}
+
+// DeleteDevice удаляет устройство вместе с его очередью; userID == 0 — без проверки владельца
+func (r *PushRepository) DeleteDevice(id, userID uint) (bool, error) {
+	deleted := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		q := tx.Where("id = ?", id)
+		if userID != 0 {
+			q = q.Where("user_id = ?", userID)
+		}
+		res := q.Delete(&models.DeviceToken{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		deleted = true
+		return tx.Where("device_token_id = ?", id).Delete(&models.PushNotification{}).Error
+	})
+	return deleted, err
+}
+
+// DevicesByID загружает устройства для отправки очереди
+func (r *PushRepository) DevicesByID(ids []uint) (map[uint]models.DeviceToken, error) {
+	var devices []models.DeviceToken
+	if err := r.DB.Where("id IN ?", ids).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]models.DeviceToken, len(devices))
+	for _, d := range devices {
+		result[d.ID] = d
+	}
+	return result, nil
+}
+
+func (r *PushRepository) Enqueue(notifications []models.PushNotification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return r.DB.Create(&notifications).Error
+}
+
+// FindDue возвращает уведомления, время очередной попытки которых наступило
+func (r *PushRepository) FindDue(now time.Time, limit int) ([]models.PushNotification, error) {
+	var notifications []models.PushNotification
+	err := r.DB.Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+// Retry откладывает уведомление до следующей попытки
+func (r *PushRepository) Retry(n *models.PushNotification, next time.Time, lastError string) error {
+	return r.DB.Model(&models.PushNotification{}).Where("id = ?", n.ID).Updates(map[string]interface{}{
+		"attempts":        n.Attempts + 1,
+		"next_attempt_at": next,
+		"last_error":      lastError,
+	}).Error
+}
+
+func (r *PushRepository) Dequeue(id uint) error {
+	return r.DB.Delete(&models.PushNotification{}, id).Error
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"secure-messenger/internal/models"
+)
+
+type ScheduledMessageRepository struct {
+	DB *gorm.DB
+}
+
+func NewScheduledMessageRepository(db *gorm.DB) *ScheduledMessageRepository {
+	return &ScheduledMessageRepository{DB: db}
+}
+
+// WithContext возвращает репозиторий, запросы которого выполняются в контексте ctx
+func (r *ScheduledMessageRepository) WithContext(ctx context.Context) *ScheduledMessageRepository {
+	return &ScheduledMessageRepository{DB: r.DB.WithContext(ctx)}
+}
+
+func (r *ScheduledMessageRepository) Create(sm *models.ScheduledMessage) error {
+	return r.DB.Create(sm).Error
+}
+
+// ListForSender возвращает ещё не доставленные сообщения отправителя в порядке отправки
+func (r *ScheduledMessageRepository) ListForSender(senderID uint) ([]models.ScheduledMessage, error) {
+	var list []models.ScheduledMessage
+	err := r.DB.Where("sender_id = ?", senderID).Order("send_at, id").Find(&list).Error
+	return list, err
+}
+
+func (r *ScheduledMessageRepository) GetForSender(id, senderID uint) (*models.ScheduledMessage, error) {
+	var sm models.ScheduledMessage
+	if err := r.DB.Where("id = ? AND sender_id = ?", id, senderID).First(&sm).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &sm, nil
+}
+
+// Update меняет запись, только если её не успели доставить или изменить с момента чтения
+func (r *ScheduledMessageRepository) Update(sm *models.ScheduledMessage, updates map[string]interface{}) (bool, error) {
+	updates["version"] = gorm.Expr("version + 1")
+	res := r.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND version = ?", sm.ID, sm.Version).Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *ScheduledMessageRepository) GetByClientID(senderID uint, clientID string) (*models.ScheduledMessage, error) {
+	var sm models.ScheduledMessage
+	if err := r.DB.Where("sender_id = ? AND client_message_id = ?", senderID, clientID).First(&sm).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &sm, nil
+}
+
+func (r *ScheduledMessageRepository) Delete(id, senderID uint) (bool, error) {
+	res := r.DB.Where("id = ? AND sender_id = ?", id, senderID).Delete(&models.ScheduledMessage{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// FindDue возвращает до limit сообщений, время отправки которых наступило, в порядке
+// отправки; after — последняя запись предыдущей пачки (nil — с начала)
+func (r *ScheduledMessageRepository) FindDue(now time.Time, after *models.ScheduledMessage, limit int) ([]models.ScheduledMessage, error) {
+	query := r.DB.Where("status = ? AND send_at <= ?", models.ScheduledPending, now)
+	if after != nil {
+		query = query.Where("send_at > ? OR (send_at = ? AND id > ?)", after.SendAt, after.SendAt, after.ID)
+	}
+	var list []models.ScheduledMessage
+	err := query.Order("send_at, id").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// RecordFailure учитывает неудачную попытку доставки; final — попытки исчерпаны,
+// и запись помечается ScheduledFailed с причиной reason. Запись, изменённую
+// после чтения, не трогает: отредактированное сообщение доставляется заново.
+func (r *ScheduledMessageRepository) RecordFailure(sm *models.ScheduledMessage, final bool, reason string) error {
+	updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+	if final {
+		updates["status"] = models.ScheduledFailed
+		updates["failure_reason"] = reason
+	}
+	return r.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND version = ? AND status = ?", sm.ID, sm.Version, models.ScheduledPending).
+		Updates(updates).Error
+}
+
+// Deliver атомарно удаляет отложенную запись и создаёт из неё сообщение. Удаление с проверкой версии гарантирует, что сообщение будет
+// создано ровно один раз, даже если доставку выполняют несколько процессов или
+// процесс упал посреди доставки. false — запись уже доставлена, отменена или изменена.
+func (r *ScheduledMessageRepository) Deliver(sm *models.ScheduledMessage, msg *models.Message, tokens []string) (bool, error) {
+	delivered := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND version = ? AND status = ?", sm.ID, sm.Version, models.ScheduledPending).
+			Delete(&models.ScheduledMessage{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		delivered = true
+		return createMessage(tx, msg, nil, tokens)
+	})
+	return delivered && err == nil, err
+}
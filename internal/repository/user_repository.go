@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"secure-messenger/internal/models"
+)
+
+type UserRepository struct {
+	DB *gorm.DB
+}
+
+func NewUserRepository(db *gorm.DB) *UserRepository {
+	return &UserRepository{DB: db}
+}
+
+// WithContext возвращает репозиторий, запросы которого выполняются в контексте ctx
+func (r *UserRepository) WithContext(ctx context.Context) *UserRepository {
+	return &UserRepository{DB: r.DB.WithContext(ctx)}
+}
+
+func (r *UserRepository) GetByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.DB.First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) GetByIDs(ids []uint) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.DB.Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+// SearchOptions — параметры поиска по каталогу пользователей
+type SearchOptions struct {
+	ViewerID   uint   // кто ищет: он сам и заблокировавшие его в выдачу не попадают
+	NamePrefix string // начало имени или отображаемого имени
+	Email      string // точный email; если задан, NamePrefix не используется
+	BeforeID   uint
+	Limit      int
+}
+
+// Search ищет пользователей, разрешивших находить себя в поиске, от новых к старым
+func (r *UserRepository) Search(opts SearchOptions) ([]models.User, error) {
+	q := r.DB.Where("discoverable = ? AND id <> ?", true, opts.ViewerID).
+		Where("NOT EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = users.id AND b.blocked_id = ?)", opts.ViewerID)
+	if opts.Email != "" {
+		q = q.Where("LOWER(email) = ?", strings.ToLower(opts.Email))
+	} else {
+		pattern := escapeLike(strings.ToLower(opts.NamePrefix)) + "%"
+		q = q.Where(`LOWER(name) LIKE ? ESCAPE '\' OR LOWER(display_name) LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+	if opts.BeforeID > 0 {
+		q = q.Where("id < ?", opts.BeforeID)
+	}
+
+	var users []models.User
+	err := q.Order("id DESC").Limit(opts.Limit).Find(&users).Error
+	return users, err
+}
+
+func (r *UserRepository) UpdateProfile(id uint, updates map[string]interface{}) error {
+	return r.DB.Model(&models.User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// TouchLastSeen сдвигает время последней активности вперёд (но не назад)
+func (r *UserRepository) TouchLastSeen(id uint, at time.Time) error {
+	return r.DB.Model(&models.User{}).
+		Where("id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", id, at).
+		UpdateColumn("last_seen_at", at).Error
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/storage"
+)
+
+// AttachmentGC удаляет загрузки, так и не прикреплённые к сообщению,
+// и вложения удалённых или исчезнувших сообщений
+type AttachmentGC struct {
+	periodic
+
+	Repo      *repository.AttachmentRepository
+	Storage   storage.Storage
+	Interval  time.Duration
+	UploadTTL time.Duration // сколько ждать, пока загрузку прикрепят к сообщению
+	BatchSize int
+}
+
+func NewAttachmentGC(repo *repository.AttachmentRepository, store storage.Storage, interval, uploadTTL time.Duration, batchSize int) *AttachmentGC {
+	return &AttachmentGC{
+		Repo:      repo,
+		Storage:   store,
+		Interval:  interval,
+		UploadTTL: uploadTTL,
+		BatchSize: batchSize,
+	}
+}
+
+func (g *AttachmentGC) Start(ctx context.Context) {
+	g.start(ctx, "attachment gc", g.Interval, func(ctx context.Context) error {
+		_, err := g.CollectOnce(ctx, time.Now())
+		return err
+	})
+}
+
+// CollectOnce удаляет весь накопившийся мусор пачками по BatchSize
+func (g *AttachmentGC) CollectOnce(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		staleBefore := now.Add(-g.UploadTTL)
+		garbage, err := g.Repo.FindGarbage(staleBefore, g.BatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		for i := range garbage {
+			// Вложение могли успеть прикрепить к сообщению — тогда его файлы не трогаем
+			deleted, err := g.Repo.DeleteGarbage(garbage[i].ID, staleBefore, func() error {
+				return DeleteChunks(g.Storage, &garbage[i])
+			})
+			if err != nil {
+				return total, err
+			}
+			if deleted {
+				total++
+			}
+		}
+
+		if len(garbage) < g.BatchSize {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+	"secure-messenger/pkg/encryption"
+	"secure-messenger/pkg/storage"
+)
+
+// AttachmentChunkSize — размер фрагмента при загрузке (последний может быть меньше)
+const AttachmentChunkSize = 1 << 20
+
+var (
+	ErrAttachmentNotFound = apperror.New(apperror.KindNotFound, "attachment_not_found", "attachment not found")
+	ErrAttachmentTooLarge = apperror.New(apperror.KindTooLarge, "attachment_too_large", "attachment too large")
+	ErrAttachmentType     = apperror.New(apperror.KindUnsupported, "attachment_type_not_allowed", "attachment type not allowed")
+	ErrInvalidChunk       = apperror.New(apperror.KindConflict, "invalid_chunk", "invalid chunk")
+	ErrInvalidAttachment  = apperror.New(apperror.KindInvalid, "invalid_attachment", "invalid attachment")
+)
+
+var DefaultAttachmentTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp",
+	"application/pdf", "text/plain", "application/zip",
+	"audio/mpeg", "audio/ogg", "video/mp4",
+}
+
+type AttachmentService struct {
+	Repo         *repository.AttachmentRepository
+	Messages     *repository.MessageRepository
+	Storage      storage.Storage
+	AESSecretKey []byte
+	MaxSize      int64
+	AllowedTypes []string
+}
+
+func NewAttachmentService(
+	r *repository.AttachmentRepository,
+	messages *repository.MessageRepository,
+	store storage.Storage,
+	key []byte,
+) *AttachmentService {
+	return &AttachmentService{
+		Repo:         r,
+		Messages:     messages,
+		Storage:      store,
+		AESSecretKey: key,
+		MaxSize:      25 << 20,
+		AllowedTypes: DefaultAttachmentTypes,
+	}
+}
+
+// CreateUpload начинает загрузку файла: проверяет ограничения и выдаёт ключ для шифрования
+func (s *AttachmentService) CreateUpload(ownerID uint, fileName, mimeType string, size int64) (*models.Attachment, error) {
+	if size <= 0 || size > s.MaxSize {
+		return nil, ErrAttachmentTooLarge
+	}
+	mediaType, err := s.checkType(mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := encryption.NewFileKey()
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := encryption.EncryptAES(s.AESSecretKey, hex.EncodeToString(fileKey))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &models.Attachment{
+		ID:         id,
+		OwnerID:    ownerID,
+		FileName:   sanitizeFileName(fileName),
+		MimeType:   mediaType,
+		Size:       size,
+		ChunkSize:  AttachmentChunkSize,
+		ChunkCount: int((size + AttachmentChunkSize - 1) / AttachmentChunkSize),
+		Status:     models.AttachmentUploading,
+		Key:        wrappedKey,
+	}
+	if err := s.Repo.Create(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// UploadChunk принимает очередной фрагмент. Фрагменты загружаются по порядку;
+// после обрыва клиент узнаёт uploaded_chunks и продолжает с него.
+// Повторная отправка уже принятого фрагмента ничего не меняет.
+func (s *AttachmentService) UploadChunk(id string, ownerID uint, index int, body io.Reader) (*models.Attachment, error) {
+	a, err := s.getOwned(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= a.ChunkCount {
+		return nil, ErrInvalidChunk
+	}
+	if index < a.UploadedChunks {
+		return a, nil
+	}
+	if index != a.UploadedChunks || a.Status != models.AttachmentUploading {
+		return nil, ErrInvalidChunk
+	}
+
+	expected := chunkLength(a, index)
+	data, err := io.ReadAll(io.LimitReader(body, expected+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != expected {
+		return nil, ErrInvalidChunk
+	}
+
+	fileKey, err := s.fileKey(a)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encryption.SealChunk(fileKey, uint32(index), index == a.ChunkCount-1, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Storage.Put(chunkKey(a.ID, index), bytes.NewReader(sealed)); err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.AdvanceChunks(a, index); err != nil {
+		if errors.Is(err, repository.ErrAttachmentUnavailable) {
+			return nil, ErrInvalidChunk
+		}
+		return nil, err
+	}
+	a.UploadedChunks = index + 1
+	if a.UploadedChunks == a.ChunkCount {
+		a.Status = models.AttachmentComplete
+	}
+	return a, nil
+}
+
+// GetAttachment возвращает вложение владельцу или участнику переписки, в которой оно отправлено.
+// Аватары доступны любому авторизованному пользователю.
+func (s *AttachmentService) GetAttachment(id string, userID uint) (*models.Attachment, error) {
+	a, err := s.Repo.GetByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.Status == models.AttachmentDeleted {
+		return nil, ErrAttachmentNotFound
+	}
+	if a.OwnerID == userID {
+		return a, nil
+	}
+	if a.MessageID == nil {
+		isAvatar, err := s.Repo.IsAvatar(a.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !isAvatar {
+			return nil, ErrAttachmentNotFound
+		}
+		return a, nil
+	}
+
+	_, err = s.Messages.GetVisibleMessage(*a.MessageID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Open возвращает поток расшифрованного содержимого полностью загруженного вложения
+func (s *AttachmentService) Open(id string, userID uint) (*models.Attachment, io.ReadCloser, error) {
+	a, err := s.GetAttachment(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a.Status != models.AttachmentComplete {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	fileKey, err := s.fileKey(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, &chunkReader{storage: s.Storage, attachment: a, key: fileKey}, nil
+}
+
+// DeleteChunks удаляет из хранилища все фрагменты вложения
+func DeleteChunks(store storage.Storage, a *models.Attachment) error {
+	for i := 0; i < a.ChunkCount; i++ {
+		if err := store.Delete(chunkKey(a.ID, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AttachmentService) getOwned(id string, ownerID uint) (*models.Attachment, error) {
+	a, err := s.Repo.GetByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.OwnerID != ownerID || a.Status == models.AttachmentDeleted {
+		return nil, ErrAttachmentNotFound
+	}
+	return a, nil
+}
+
+func (s *AttachmentService) checkType(mimeType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return "", ErrAttachmentType
+	}
+	for _, allowed := range s.AllowedTypes {
+		if mediaType == allowed {
+			return mediaType, nil
+		}
+	}
+	return "", ErrAttachmentType
+}
+
+func (s *AttachmentService) fileKey(a *models.Attachment) ([]byte, error) {
+	hexKey, err := encryption.DecryptAES(s.AESSecretKey, a.Key)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(hexKey)
+}
+
+// chunkReader расшифровывает вложение по одному фрагменту, не загружая файл в память целиком
+type chunkReader struct {
+	storage    storage.Storage
+	attachment *models.Attachment
+	key        []byte
+	next       int
+	buf        []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next >= r.attachment.ChunkCount {
+			return 0, io.EOF
+		}
+		if err := r.load(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+func (r *chunkReader) load() error {
+	f, err := r.storage.Open(chunkKey(r.attachment.ID, r.next))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sealed, err := io.ReadAll(io.LimitReader(f, int64(r.attachment.ChunkSize)+64))
+	if err != nil {
+		return err
+	}
+	last := r.next == r.attachment.ChunkCount-1
+	r.buf, err = encryption.OpenChunk(r.key, uint32(r.next), last, sealed)
+	if err != nil {
+		return err
+	}
+	r.next++
+	return nil
+}
+
+func chunkKey(id string, index int) string {
+	return fmt.Sprintf("%s/%06d", id, index)
+}
+
+func chunkLength(a *models.Attachment, index int) int64 {
+	if index == a.ChunkCount-1 {
+		return a.Size - int64(index)*int64(a.ChunkSize)
+	}
+	return int64(a.ChunkSize)
+}
+
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,20 +1,58 @@
 package services
 
 import (
-	"secure-messenger/config"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"secure-messenger/internal/metrics"
+	"secure-messenger/pkg/apperror"
+)
+
+var (
+	ErrInvalidAccessToken = apperror.New(apperror.KindUnauthorized, "invalid_access_token", "invalid access token")
+	ErrInvalidCredentials = apperror.New(apperror.KindUnauthorized, "invalid_credentials", "invalid email or password")
+	ErrEmailTaken         = apperror.New(apperror.KindConflict, "email_taken", "email already registered")
+	ErrInsufficientRole   = apperror.New(apperror.KindForbidden, "insufficient_permissions", "insufficient permissions")
 )
 
-func GenerateJWT(userID uint, role string) (string, error) {
+// TokenService выпускает и проверяет токены доступа и обновления
+type TokenService struct {
+	Secret     []byte
+	AccessTTL  time.Duration // сколько живёт access token
+	RefreshTTL time.Duration // сколько живёт refresh token
+
+	Metrics *metrics.Metrics // nil — метрики не собираются
+}
+
+func NewTokenService(secret string, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{Secret: []byte(secret), AccessTTL: accessTTL, RefreshTTL: refreshTTL}
+}
+
+func (s *TokenService) GenerateJWT(userID uint, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
-		"exp":     time.Now().Add(time.Hour).Unix(), // Токен живет 1 час
+		"exp":     time.Now().Add(s.AccessTTL).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.JWTSecret))
+	return token.SignedString(s.Secret)
+}
+
+// ParseJWT проверяет подпись и срок действия access token
+func (s *TokenService) ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidAccessToken
+	}
+	return claims, nil
+}
 
+func (s *TokenService) GenerateRefreshToken(db *gorm.DB, userID uint) (string, error) {
+	return generateRefreshToken(db, userID, s.RefreshTTL)
 }
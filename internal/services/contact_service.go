@@ -0,0 +1,229 @@
+package services
+
+import (
+	"errors"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+)
+
+var (
+	ErrSelfMessage            = apperror.New(apperror.KindInvalid, "self_message", "cannot message yourself")
+	ErrSelfContact            = apperror.New(apperror.KindInvalid, "self_contact", "cannot add yourself")
+	ErrBlocked                = apperror.New(apperror.KindForbidden, "blocked", "blocked")
+	ErrMessageRequestDeclined = apperror.New(apperror.KindForbidden, "message_request_declined", "message request declined")
+	ErrRequestNotFound        = apperror.New(apperror.KindNotFound, "message_request_not_found", "message request not found")
+	ErrContactNotFound        = apperror.New(apperror.KindNotFound, "contact_not_found", "contact not found")
+)
+
+// Admission — как поступить с сообщением от отправителя к получателю
+type Admission int
+
+const (
+	AdmitDeliver Admission = iota // доставить как обычно
+	AdmitPending                  // сохранить до принятия запроса на переписку; запрос создаётся вместе с сообщением
+	AdmitDrop                     // не доставлять, не сообщая отправителю (он заблокирован)
+)
+
+type ContactService struct {
+	Repo  *repository.ContactRepository
+	Users *repository.UserRepository
+}
+
+func NewContactService(r *repository.ContactRepository, users *repository.UserRepository) *ContactService {
+	return &ContactService{Repo: r, Users: users}
+}
+
+func (s *ContactService) ListContacts(userID uint) ([]models.User, error) {
+	return s.Repo.ListContacts(userID)
+}
+
+func (s *ContactService) AddContact(userID, contactID uint) error {
+	if userID == contactID {
+		return ErrSelfContact
+	}
+	if _, err := s.getUser(contactID); err != nil {
+		return err
+	}
+	return s.Repo.AddContact(userID, contactID)
+}
+
+func (s *ContactService) RemoveContact(userID, contactID uint) error {
+	removed, err := s.Repo.RemoveContact(userID, contactID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrContactNotFound
+	}
+	return nil
+}
+
+func (s *ContactService) ListBlocked(userID uint) ([]models.User, error) {
+	return s.Repo.ListBlocked(userID)
+}
+
+func (s *ContactService) Block(userID, blockedID uint) error {
+	if userID == blockedID {
+		return ErrSelfContact
+	}
+	if _, err := s.getUser(blockedID); err != nil {
+		return err
+	}
+	return s.Repo.Block(userID, blockedID)
+}
+
+func (s *ContactService) Unblock(userID, blockedID uint) error {
+	removed, err := s.Repo.Unblock(userID, blockedID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrContactNotFound
+	}
+	return nil
+}
+
+// ListRequests возвращает входящие запросы на переписку, ожидающие решения
+func (s *ContactService) ListRequests(userID uint) ([]models.MessageRequest, error) {
+	return s.Repo.ListIncomingRequests(userID)
+}
+
+func (s *ContactService) AcceptRequest(userID, requestID uint) (*models.MessageRequest, error) {
+	req, err := s.pendingRequest(userID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.AcceptRequest(req); err != nil {
+		return nil, err
+	}
+	req.Status = models.MessageRequestAccepted
+	return req, nil
+}
+
+func (s *ContactService) DeclineRequest(userID, requestID uint) (*models.MessageRequest, error) {
+	req, err := s.pendingRequest(userID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.DeclineRequest(req); err != nil {
+		return nil, err
+	}
+	req.Status = models.MessageRequestDeclined
+	return req, nil
+}
+
+// Admit решает, может ли senderID написать receiverID, с учётом блокировок
+// и настройки получателя "писать могут только контакты". Сам ничего не записывает:
+// запрос на переписку сохраняется в одной транзакции с ожидающим сообщением.
+func (s *ContactService) Admit(senderID, receiverID uint) (Admission, error) {
+	if senderID == receiverID {
+		return 0, ErrSelfMessage
+	}
+	receiver, err := s.getUser(receiverID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Писать тому, кого сам заблокировал, нельзя — сначала нужно разблокировать
+	blocked, err := s.Repo.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return 0, err
+	}
+	if blocked {
+		return 0, ErrBlocked
+	}
+
+	blocked, err = s.Repo.IsBlocked(receiverID, senderID)
+	if err != nil {
+		return 0, err
+	}
+	if blocked {
+		if receiver.BlockSilent {
+			return AdmitDrop, nil
+		}
+		return 0, ErrBlocked
+	}
+
+	if !receiver.OnlyContacts {
+		return AdmitDeliver, nil
+	}
+	isContact, err := s.Repo.IsContact(receiverID, senderID)
+	if err != nil {
+		return 0, err
+	}
+	if isContact {
+		return AdmitDeliver, nil
+	}
+
+	req, err := s.Repo.GetRequest(senderID, receiverID)
+	if err != nil {
+		return 0, err
+	}
+	if req == nil {
+		return AdmitPending, nil
+	}
+	switch req.Status {
+	case models.MessageRequestAccepted:
+		return AdmitDeliver, nil
+	case models.MessageRequestDeclined:
+		return 0, ErrMessageRequestDeclined
+	default:
+		return AdmitPending, nil
+	}
+}
+
+// CanReach — дойдёт ли до receiverID сообщение от senderID без запроса на переписку.
+// Используется для эфемерных событий, которые нельзя отложить до принятия запроса.
+func (s *ContactService) CanReach(senderID, receiverID uint) (bool, error) {
+	if senderID == receiverID {
+		return false, nil
+	}
+	receiver, err := s.getUser(receiverID)
+	if err != nil {
+		return false, err
+	}
+	for _, pair := range [][2]uint{{senderID, receiverID}, {receiverID, senderID}} {
+		blocked, err := s.Repo.IsBlocked(pair[0], pair[1])
+		if err != nil || blocked {
+			return false, err
+		}
+	}
+	if !receiver.OnlyContacts {
+		return true, nil
+	}
+
+	isContact, err := s.Repo.IsContact(receiverID, senderID)
+	if err != nil || isContact {
+		return isContact, err
+	}
+	req, err := s.Repo.GetRequest(senderID, receiverID)
+	if err != nil {
+		return false, err
+	}
+	return req != nil && req.Status == models.MessageRequestAccepted, nil
+}
+
+func (s *ContactService) pendingRequest(userID, requestID uint) (*models.MessageRequest, error) {
+	req, err := s.Repo.GetRequestByID(requestID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.ReceiverID != userID || req.Status != models.MessageRequestPending {
+		return nil, ErrRequestNotFound
+	}
+	return req, nil
+}
+
+// getUser находит пользователя; удалённые аккаунты считаются несуществующими
+func (s *ContactService) getUser(id uint) (*models.User, error) {
+	user, err := s.Users.GetByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+)
+
+// MaxTTLSeconds — максимальный срок жизни исчезающего сообщения (неделя)
+const MaxTTLSeconds = 7 * 24 * 60 * 60
+
+var (
+	ErrInvalidTTL   = apperror.New(apperror.KindInvalid, "invalid_ttl", "invalid ttl")
+	ErrUserNotFound = apperror.New(apperror.KindNotFound, "user_not_found", "user not found")
+	ErrInvalidMute  = apperror.New(apperror.KindInvalid, "invalid_mute", "invalid mute period")
+)
+
+type ConversationService struct {
+	Repo  *repository.ConversationRepository
+	Users *repository.UserRepository
+}
+
+func NewConversationService(r *repository.ConversationRepository, users *repository.UserRepository) *ConversationService {
+	return &ConversationService{Repo: r, Users: users}
+}
+
+func (s *ConversationService) GetSettings(userID, peerID uint) (*models.ConversationSetting, error) {
+	if err := s.checkPeer(peerID); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetSetting(userID, peerID)
+}
+
+// SetTTL включает (ttlSeconds > 0) или выключает исчезающие сообщения в переписке
+func (s *ConversationService) SetTTL(userID, peerID uint, ttlSeconds int, afterRead bool) (*models.ConversationSetting, error) {
+	if err := ValidateTTL(ttlSeconds); err != nil {
+		return nil, err
+	}
+	if err := s.checkPeer(peerID); err != nil {
+		return nil, err
+	}
+
+	setting := &models.ConversationSetting{
+		UserLowID:    userID,
+		UserHighID:   peerID,
+		TTLSeconds:   ttlSeconds,
+		TTLAfterRead: afterRead && ttlSeconds > 0,
+	}
+	if err := s.Repo.SaveSetting(setting); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+// GetMute возвращает действующее отключение уведомлений о сообщениях peerID (nil — не отключены)
+func (s *ConversationService) GetMute(userID, peerID uint) (*models.ConversationMute, error) {
+	if err := s.checkPeer(peerID); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetMute(userID, peerID, time.Now())
+}
+
+// Mute отключает push-уведомления о сообщениях peerID до until (nil — до отмены).
+// Настройка личная: собеседник о ней не знает.
+func (s *ConversationService) Mute(userID, peerID uint, until *time.Time) (*models.ConversationMute, error) {
+	if until != nil && !until.After(time.Now()) {
+		return nil, ErrInvalidMute
+	}
+	if err := s.checkPeer(peerID); err != nil {
+		return nil, err
+	}
+
+	mute := &models.ConversationMute{UserID: userID, PeerID: peerID, MutedUntil: until}
+	if err := s.Repo.SaveMute(mute); err != nil {
+		return nil, err
+	}
+	return mute, nil
+}
+
+func (s *ConversationService) Unmute(userID, peerID uint) error {
+	if err := s.checkPeer(peerID); err != nil {
+		return err
+	}
+	return s.Repo.DeleteMute(userID, peerID)
+}
+
+func (s *ConversationService) checkPeer(peerID uint) error {
+	_, err := s.Users.GetByID(peerID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func ValidateTTL(ttlSeconds int) error {
+	if ttlSeconds < 0 || ttlSeconds > MaxTTLSeconds {
+		return ErrInvalidTTL
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"secure-messenger/internal/repository"
+)
+
+// Значения по умолчанию для неположительных параметров очистки
+const (
+	DefaultReaperInterval  = time.Minute
+	DefaultReaperBatchSize = 500
+)
+
+// ExpiryReaper периодически удаляет исчезающие сообщения с истёкшим сроком жизни
+type ExpiryReaper struct {
+	periodic
+
+	Repo      *repository.MessageRepository
+	Interval  time.Duration
+	BatchSize int
+}
+
+// NewExpiryReaper создаёт очистку; неположительные interval и batchSize заменяются значениями по умолчанию
+func NewExpiryReaper(repo *repository.MessageRepository, interval time.Duration, batchSize int) *ExpiryReaper {
+	if interval <= 0 {
+		interval = DefaultReaperInterval
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultReaperBatchSize
+	}
+	return &ExpiryReaper{
+		Repo:      repo,
+		Interval:  interval,
+		BatchSize: batchSize,
+	}
+}
+
+// Start запускает фоновую очистку; она работает, пока не отменён ctx
+func (r *ExpiryReaper) Start(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReaperInterval
+	}
+	r.start(ctx, "expiry reaper", interval, func(ctx context.Context) error {
+		_, err := r.ReapOnce(ctx, time.Now())
+		return err
+	})
+}
+
+// ReapOnce удаляет все истёкшие сообщения пачками по BatchSize
+func (r *ExpiryReaper) ReapOnce(ctx context.Context, now time.Time) (int64, error) {
+	if r.BatchSize <= 0 {
+		return 0, fmt.Errorf("expiry reaper: batch size must be positive, got %d", r.BatchSize)
+	}
+	repo := r.Repo.WithContext(ctx)
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := repo.DeleteExpired(now, r.BatchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted < int64(r.BatchSize) {
+			break
+		}
+	}
+	return total, nil
+}
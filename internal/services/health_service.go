@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"secure-messenger/pkg/apperror"
+)
+
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+var ErrShuttingDown = apperror.New(apperror.KindUnavailable, "shutting_down", "server is shutting down")
+
+// HealthCheck — одна проверка готовности; ошибка означает, что трафик принимать рано
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type Readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// HealthService собирает проверки готовности; во время остановки сервер всегда не готов
+type HealthService struct {
+	Timeout time.Duration // на каждую проверку
+
+	checks   []HealthCheck
+	draining atomic.Bool
+}
+
+func NewHealthService(timeout time.Duration) *HealthService {
+	return &HealthService{Timeout: timeout}
+}
+
+func (s *HealthService) Add(name string, check func(ctx context.Context) error) {
+	s.checks = append(s.checks, HealthCheck{Name: name, Check: check})
+}
+
+// SetDraining переводит сервер в неготовность перед остановкой, чтобы балансировщик
+// перестал присылать новые запросы
+func (s *HealthService) SetDraining() {
+	s.draining.Store(true)
+}
+
+// Ready выполняет все проверки параллельно
+func (s *HealthService) Ready(ctx context.Context) Readiness {
+	report := Readiness{Status: HealthOK, Checks: make(map[string]CheckResult, len(s.checks)+1)}
+	if s.draining.Load() {
+		report.Status = HealthFail
+		report.Checks["shutdown"] = CheckResult{Status: HealthFail, Error: ErrShuttingDown.Error()}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range s.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := s.run(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status != HealthOK {
+				report.Status = HealthFail
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+func (s *HealthService) run(ctx context.Context, check HealthCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err() // проверка не уложилась в срок — не ждём её дальше
+	}
+
+	result := CheckResult{Status: HealthOK, DurationMS: time.Since(started).Milliseconds()}
+	if err != nil {
+		result.Status = HealthFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func DatabaseCheck(db *sql.DB) func(ctx context.Context) error {
+	return db.PingContext
+}
+
+// KeysCheck убеждается, что ключи шифрования и подписи токенов загружены и пригодны
+func KeysCheck(aesKey []byte, tokens *TokenService) func(ctx context.Context) error {
+	return func(context.Context) error {
+		if _, err := aes.NewCipher(aesKey); err != nil {
+			return fmt.Errorf("aes key: %w", err)
+		}
+		if len(tokens.Secret) == 0 {
+			return errors.New("jwt secret is empty")
+		}
+		return nil
+	}
+}
+
+// Runner — фоновая задача, о которой можно спросить, работает ли она
+type Runner interface {
+	Running() bool
+}
+
+func WorkersCheck(workers map[string]Runner) func(ctx context.Context) error {
+	return func(context.Context) error {
+		var stopped []string
+		for name, w := range workers {
+			if !w.Running() {
+				stopped = append(stopped, name)
+			}
+		}
+		if len(stopped) > 0 {
+			sort.Strings(stopped)
+			return fmt.Errorf("not running: %s", strings.Join(stopped, ", "))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+)
+
+// DefaultSchedulerMaxAttempts — сколько раз повторять доставку при временных ошибках
+const DefaultSchedulerMaxAttempts = 5
+
+// MessageScheduler периодически доставляет отложенные сообщения, время которых наступило
+type MessageScheduler struct {
+	periodic
+
+	Messages  *MessageService
+	Repo      *repository.ScheduledMessageRepository
+	Interval  time.Duration
+	BatchSize int
+	// После стольких неудачных попыток сообщение помечается ошибочным и больше не доставляется
+	MaxAttempts int
+}
+
+func NewMessageScheduler(messages *MessageService, interval time.Duration, batchSize int) *MessageScheduler {
+	return &MessageScheduler{
+		Messages:    messages,
+		Repo:        messages.Scheduled,
+		Interval:    interval,
+		BatchSize:   batchSize,
+		MaxAttempts: DefaultSchedulerMaxAttempts,
+	}
+}
+
+// Start запускает доставку; она работает, пока не отменён ctx
+func (m *MessageScheduler) Start(ctx context.Context) {
+	m.start(ctx, "message scheduler", m.Interval, func(ctx context.Context) error {
+		_, err := m.DeliverDue(ctx, time.Now())
+		return err
+	})
+}
+
+// DeliverDue доставляет все сообщения со временем отправки не позже now. Ошибка одной
+// записи не останавливает доставку остальных: попытка учитывается, и запись
+// повторяется на следующих запусках, пока не кончатся MaxAttempts.
+func (m *MessageScheduler) DeliverDue(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	var after *models.ScheduledMessage
+	for ctx.Err() == nil {
+		due, err := m.Repo.WithContext(ctx).FindDue(now, after, m.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		for i := range due {
+			delivered, err := m.Messages.WithContext(ctx).DeliverScheduled(&due[i])
+			if err != nil {
+				if ctx.Err() != nil {
+					return total, err
+				}
+				if err := m.recordFailure(ctx, &due[i], err); err != nil {
+					return total, err
+				}
+				continue
+			}
+			if delivered {
+				total++
+			}
+		}
+		if len(due) < m.BatchSize {
+			break
+		}
+		after = &due[len(due)-1]
+	}
+	return total, nil
+}
+
+func (m *MessageScheduler) recordFailure(ctx context.Context, sm *models.ScheduledMessage, cause error) error {
+	maxAttempts := m.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultSchedulerMaxAttempts
+	}
+	final := sm.Attempts+1 >= maxAttempts
+	slog.ErrorContext(ctx, "scheduler: failed to deliver scheduled message",
+		"scheduled_id", sm.ID, "attempt", sm.Attempts+1, "final", final, "error", cause)
+	// Автор видит только итог: текст внутренней ошибки ему ни к чему
+	return m.Repo.WithContext(ctx).RecordFailure(sm, final, "delivery failed")
+}
@@ -1,27 +1,251 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"secure-messenger/internal/metrics"
 	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
 	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
 	"secure-messenger/pkg/encryption"
 )
 
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
+var (
+	ErrMessageNotFound   = apperror.New(apperror.KindNotFound, "message_not_found", "message not found")
+	ErrForbidden         = apperror.New(apperror.KindForbidden, "forbidden", "forbidden")
+	ErrEditWindowExpired = apperror.New(apperror.KindForbidden, "edit_window_expired", "edit window expired")
+	ErrEditConflict      = apperror.New(apperror.KindConflict, "edit_conflict", "message was edited concurrently")
+
+	ErrMessageDeleted      = apperror.New(apperror.KindGone, "message_deleted", "message deleted")
+	ErrDeleteWindowExpired = apperror.New(apperror.KindForbidden, "delete_window_expired", "delete window expired")
+	ErrInvalidReference    = apperror.New(apperror.KindInvalid, "invalid_reference", "invalid message reference")
+
+	ErrInvalidClientMessageID = apperror.New(apperror.KindInvalid, "invalid_client_message_id", "invalid client message id")
+	ErrIdempotencyConflict    = apperror.New(apperror.KindConflict, "idempotency_conflict", "client message id already used")
+)
+
+// MaxClientMessageIDLength — максимальная длина идентификатора, выданного клиентом
+const MaxClientMessageIDLength = 64
+
+// quoteLength — сколько символов исходного сообщения показывать в цитате ответа
+const quoteLength = 100
+
+// MessageView — сообщение в том виде, в котором его видит конкретный пользователь
+type MessageView struct {
+	models.Message
+	Status  string
+	Edited  bool
+	Deleted bool
+
+	Attachments []models.Attachment
+
+	ReplyTo          *MessageQuote
+	ThreadReplyCount int64
+
+	Reactions []repository.ReactionSummary
+
+	Pinned  bool // закреплено в переписке
+	Starred bool // в избранном у пользователя
+}
+
+// MessageQuote — краткая цитата сообщения, на которое отвечают
+type MessageQuote struct {
+	ID       uint
+	SenderID uint
+	Content  string
+	Deleted  bool
+}
+
+// SendOptions — необязательные параметры отправки сообщения
+type SendOptions struct {
+	TTLSeconds   *int // срок жизни сообщения; nil — взять из настроек переписки
+	TTLAfterRead bool // отсчитывать срок жизни от прочтения
+
+	AttachmentIDs []string // ранее загруженные вложения отправителя
+
+	ReplyToID    *uint // ответ на сообщение
+	ThreadRootID *uint // отправить в ветку, открытую на этом сообщении
+
+	SendAt *time.Time // отложенная отправка (см. ScheduleMessage)
+
+	// Ключ идемпотентности: повтор с тем же ключом не создаёт второе сообщение
+	ClientMessageID string
+}
+
 type MessageService struct {
-	Repo         *repository.MessageRepository
-	AESSecretKey []byte
+	Repo          *repository.MessageRepository
+	Users         *repository.UserRepository
+	Conversations *repository.ConversationRepository
+	Attachments   *repository.AttachmentRepository
+	Contacts      *ContactService
+	Scheduled     *repository.ScheduledMessageRepository
+	AESSecretKey  []byte
+	Hub           *realtime.Hub // nil — события в реальном времени не рассылаются
+	Index         *encryption.BlindIndex
+	Push          *PushService     // nil — push-уведомления не отправляются
+	Metrics       *metrics.Metrics // nil — метрики не собираются
+
+	ctx context.Context // см. WithContext; nil — context.Background()
+
+	EditWindow   time.Duration // 0 — редактирование без ограничения по времени
+	DeleteWindow time.Duration // сколько времени после отправки можно удалить сообщение "для всех"
+
+	MaxDistinctReactions int // сколько разных эмодзи можно поставить на одно сообщение
+	MaxPins              int // сколько сообщений можно закрепить в одной переписке; 0 — без ограничения
 }
 
-func NewMessageService(r *repository.MessageRepository, key []byte) *MessageService {
+func NewMessageService(
+	r *repository.MessageRepository,
+	users *repository.UserRepository,
+	conversations *repository.ConversationRepository,
+	attachments *repository.AttachmentRepository,
+	contacts *ContactService,
+	scheduled *repository.ScheduledMessageRepository,
+	key []byte,
+) *MessageService {
 	return &MessageService{
-		Repo:         r,
-		AESSecretKey: key,
+		Repo:          r,
+		Users:         users,
+		Conversations: conversations,
+		Attachments:   attachments,
+		Contacts:      contacts,
+		Scheduled:     scheduled,
+		AESSecretKey:  key,
+		Index:         encryption.NewBlindIndex(encryption.DeriveKey(key, "secure-messenger/blind-index")),
+		EditWindow:    15 * time.Minute,
+		DeleteWindow:  48 * time.Hour,
+
+		MaxDistinctReactions: 20,
+		MaxPins:              10,
 	}
 }
 
-func (s *MessageService) SendMessage(senderID, receiverID uint, plainText string) error {
-	encrypted, err := encryption.EncryptAES(s.AESSecretKey, plainText)
+// SendMessage отправляет сообщение и возвращает его глазами отправителя.
+// Если opts.ClientMessageID уже встречался у отправителя, возвращается ранее
+// созданное сообщение, а created == false.
+func (s *MessageService) SendMessage(senderID, receiverID uint, plainText string, opts SendOptions) (view *MessageView, created bool, err error) {
+	s, span := s.trace("SendMessage")
+	defer span.End()
+
+	if opts.ClientMessageID != "" {
+		if !ValidClientMessageID(opts.ClientMessageID) {
+			return nil, false, ErrInvalidClientMessageID
+		}
+		view, err := s.replay(senderID, receiverID, plainText, opts.ClientMessageID)
+		if err != nil || view != nil {
+			return view, false, err
+		}
+	}
+
+	message, err := s.newMessage(senderID, receiverID, plainText, opts)
 	if err != nil {
-		return err
+		return nil, false, err
+	}
+
+	err = s.Repo.CreateMessage(message, uniqueStrings(opts.AttachmentIDs), s.Index.Tokens(plainText))
+	if errors.Is(err, repository.ErrAttachmentUnavailable) {
+		return nil, false, ErrInvalidAttachment
+	}
+	if err != nil && opts.ClientMessageID != "" {
+		// Параллельный запрос с тем же ключом успел создать сообщение раньше
+		view, replayErr := s.replay(senderID, receiverID, plainText, opts.ClientMessageID)
+		if replayErr == nil && view != nil {
+			return view, false, nil
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.Metrics.MessageSent()
+	s.notify(message, plainText)
+	view, err = s.senderView(message)
+	return view, true, err
+}
+
+// notify ставит в очередь push-уведомление; сбой не отменяет уже отправленное сообщение
+func (s *MessageService) notify(msg *models.Message, plainText string) {
+	if s.Push == nil {
+		return
+	}
+	if err := s.Push.NotifyMessage(msg, plainText); err != nil {
+		slog.ErrorContext(s.context(), "push: failed to enqueue notification", "message_id", msg.ID, "error", err)
+	}
+}
+
+// replay находит сообщение, уже отправленное с этим ключом (nil — не найдено).
+// Ключ, использованный для другого получателя или текста, — ошибка клиента.
+func (s *MessageService) replay(senderID, receiverID uint, plainText, clientID string) (*MessageView, error) {
+	msg, err := s.Repo.GetByClientID(senderID, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		_, err := s.Scheduled.GetByClientID(senderID, clientID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Ключ занят отложенным сообщением
+		return nil, ErrIdempotencyConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.ReceiverID != receiverID {
+		return nil, ErrIdempotencyConflict
+	}
+	// После редактирования или удаления текст уже не сравнить с исходным
+	if msg.EditedAt == nil && msg.DeletedForEveryoneAt == nil && s.decrypt(msg.Content, msg.Encrypted) != plainText {
+		return nil, ErrIdempotencyConflict
+	}
+	return s.senderView(msg)
+}
+
+func (s *MessageService) senderView(msg *models.Message) (*MessageView, error) {
+	views, err := s.buildViews(msg.SenderID, []models.Message{*msg})
+	if err != nil {
+		return nil, err
+	}
+	return &views[0], nil
+}
+
+// ValidClientMessageID — непустая строка из печатных ASCII-символов без пробелов
+func ValidClientMessageID(id string) bool {
+	if id == "" || len(id) > MaxClientMessageIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newMessage проверяет получателя, шифрует текст и заполняет ссылки и срок жизни
+func (s *MessageService) newMessage(senderID, receiverID uint, plainText string, opts SendOptions) (*models.Message, error) {
+	admission, err := s.Contacts.Admit(senderID, receiverID)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := s.encrypt(plainText)
+	if err != nil {
+		return nil, err
 	}
 
 	message := &models.Message{
@@ -29,27 +253,461 @@ func (s *MessageService) SendMessage(senderID, receiverID uint, plainText string
 		ReceiverID: receiverID,
 		Content:    encrypted,
 		Encrypted:  true,
+		CreatedAt:  time.Now(),
+		Pending:    admission == AdmitPending,
+		// Заблокировавший пользователь не хочет, чтобы отправитель узнал о блокировке:
+		// сообщение сохраняется, но видно только отправителю
+		Suppressed: admission == AdmitDrop,
 	}
-	return s.Repo.CreateMessage(message)
+	if opts.ClientMessageID != "" {
+		clientID := opts.ClientMessageID
+		message.ClientMessageID = &clientID
+	}
+	if err := s.applyReferences(message, opts); err != nil {
+		return nil, err
+	}
+	if err := s.applyTTL(message, opts); err != nil {
+		return nil, err
+	}
+	return message, nil
 }
 
-func (s *MessageService) GetMessages(userID uint) ([]models.Message, error) {
+func (s *MessageService) GetMessages(userID uint) ([]MessageView, error) {
+	s, span := s.trace("GetMessages")
+	defer span.End()
+
+	// Получатель забирает сообщения — значит, они доставлены
+	if err := s.Repo.MarkDelivered(userID, time.Now()); err != nil {
+		return nil, err
+	}
+
 	messages, err := s.Repo.GetMessagesForUser(userID)
 	if err != nil {
 		return nil, err
 	}
+	return s.buildViews(userID, messages)
+}
+
+// GetThread возвращает страницу ветки, открытой на сообщении rootID
+func (s *MessageService) GetThread(rootID, userID, beforeID uint, limit int) ([]MessageView, error) {
+	s, span := s.trace("GetThread")
+	defer span.End()
+
+	root, err := s.getVisibleMessage(rootID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if root.ThreadRootID != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	messages, err := s.Repo.GetThread(rootID, userID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildViews(userID, messages)
+}
+
+// EditMessage заменяет текст сообщения, сохраняя прежнюю версию в истории
+func (s *MessageService) EditMessage(messageID, userID uint, plainText string) (*MessageView, error) {
+	s, span := s.trace("EditMessage")
+	defer span.End()
+
+	msg, err := s.getVisibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != userID {
+		return nil, ErrForbidden
+	}
+	if msg.DeletedForEveryoneAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	now := time.Now()
+	if s.EditWindow > 0 && now.Sub(msg.CreatedAt) > s.EditWindow {
+		return nil, ErrEditWindowExpired
+	}
+
+	encrypted, err := s.encrypt(plainText)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Repo.UpdateContent(msg, encrypted, s.Index.Tokens(plainText), now)
+	if errors.Is(err, repository.ErrStaleMessage) {
+		return nil, ErrEditConflict
+	}
+	if errors.Is(err, repository.ErrDeletedMessage) {
+		return nil, ErrMessageDeleted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Content = encrypted
+	msg.Encrypted = true
+	msg.EditedAt = &now
+
+	views, err := s.buildViews(userID, []models.Message{*msg})
+	if err != nil {
+		return nil, err
+	}
+	return &views[0], nil
+}
+
+// GetHistory возвращает предыдущие версии сообщения, от старых к новым
+func (s *MessageService) GetHistory(messageID, userID uint) ([]models.MessageVersion, error) {
+	s, span := s.trace("GetHistory")
+	defer span.End()
+
+	if _, err := s.getVisibleMessage(messageID, userID); err != nil {
+		return nil, err
+	}
+
+	versions, err := s.Repo.GetVersions(messageID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		versions[i].Content = s.decrypt(versions[i].Content, versions[i].Encrypted)
+	}
+	return versions, nil
+}
+
+// MarkRead отмечает прочитанными сообщения собеседника вплоть до upToID
+func (s *MessageService) MarkRead(userID, peerID, upToID uint) (int64, error) {
+	s, span := s.trace("MarkRead")
+	defer span.End()
+
+	count, err := s.Repo.MarkRead(userID, peerID, upToID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	s.Metrics.MessagesRead(count)
+	return count, nil
+}
+
+// DeleteMessage скрывает сообщение у пользователя либо, если forEveryone, стирает его у всех участников
+func (s *MessageService) DeleteMessage(messageID uint, userID uint, forEveryone bool) error {
+	s, span := s.trace("DeleteMessage")
+	defer span.End()
+
+	msg, err := s.getVisibleMessage(messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !forEveryone {
+		return s.Repo.HideMessage(messageID, userID)
+	}
+
+	if msg.SenderID != userID {
+		return ErrForbidden
+	}
+	if msg.DeletedForEveryoneAt != nil {
+		return nil
+	}
+	now := time.Now()
+	if s.DeleteWindow > 0 && now.Sub(msg.CreatedAt) > s.DeleteWindow {
+		return ErrDeleteWindowExpired
+	}
+	return s.Repo.TombstoneMessage(messageID, now)
+}
+
+// applyReferences проверяет ответ и ветку: исходное сообщение должно быть из той же
+// переписки, видно отправителю и не удалено
+func (s *MessageService) applyReferences(msg *models.Message, opts SendOptions) error {
+	if opts.ThreadRootID != nil {
+		root, err := s.referencedMessage(*opts.ThreadRootID, msg)
+		if err != nil {
+			return err
+		}
+		// Ветки не вкладываются: ветка на сообщении из ветки — это та же ветка
+		rootID := root.ID
+		if root.ThreadRootID != nil {
+			rootID = *root.ThreadRootID
+		}
+		msg.ThreadRootID = &rootID
+	}
+
+	if opts.ReplyToID != nil {
+		target, err := s.referencedMessage(*opts.ReplyToID, msg)
+		if err != nil {
+			return err
+		}
+		if !sameThread(target, msg.ThreadRootID) {
+			return ErrInvalidReference
+		}
+		msg.ReplyToID = &target.ID
+	}
+	return nil
+}
+
+func (s *MessageService) referencedMessage(id uint, msg *models.Message) (*models.Message, error) {
+	ref, err := s.Repo.GetVisibleMessage(id, msg.SenderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidReference
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refLow, refHigh := models.ConversationPair(ref.SenderID, ref.ReceiverID)
+	low, high := models.ConversationPair(msg.SenderID, msg.ReceiverID)
+	if refLow != low || refHigh != high || ref.DeletedForEveryoneAt != nil {
+		return nil, ErrInvalidReference
+	}
+	return ref, nil
+}
 
+// sameThread — находится ли target в ветке rootID (nil — основная лента)
+func sameThread(target *models.Message, rootID *uint) bool {
+	if rootID == nil {
+		return target.ThreadRootID == nil
+	}
+	return target.ID == *rootID || (target.ThreadRootID != nil && *target.ThreadRootID == *rootID)
+}
+
+// applyTTL задаёт срок жизни сообщения: явно переданный либо из настроек переписки
+func (s *MessageService) applyTTL(msg *models.Message, opts SendOptions) error {
+	if opts.TTLSeconds != nil {
+		if err := ValidateTTL(*opts.TTLSeconds); err != nil {
+			return err
+		}
+		msg.TTLSeconds = *opts.TTLSeconds
+		msg.TTLAfterRead = opts.TTLAfterRead
+	} else {
+		setting, err := s.Conversations.GetSetting(msg.SenderID, msg.ReceiverID)
+		if err != nil {
+			return err
+		}
+		msg.TTLSeconds = setting.TTLSeconds
+		msg.TTLAfterRead = setting.TTLAfterRead
+	}
+
+	if msg.TTLSeconds > 0 && !msg.TTLAfterRead {
+		expiresAt := msg.CreatedAt.Add(time.Duration(msg.TTLSeconds) * time.Second)
+		msg.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// buildViews расшифровывает сообщения и дополняет их данными, зависящими от пользователя
+func (s *MessageService) buildViews(userID uint, messages []models.Message) ([]MessageView, error) {
+	s, span := s.trace("buildViews")
+	defer span.End()
+	span.SetAttributes(attribute.Int("messages", len(messages)))
+
+	hidden, err := s.receiptsHiddenFrom(userID, messages)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := s.attachmentsFor(messages)
+	if err != nil {
+		return nil, err
+	}
+	quotes, err := s.quotesFor(userID, messages)
+	if err != nil {
+		return nil, err
+	}
+	replyCounts, err := s.Repo.CountThreadReplies(messageIDs(messages), userID)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := s.reactionsFor(userID, messages)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := s.Repo.PinnedIDs(messageIDs(messages))
+	if err != nil {
+		return nil, err
+	}
+	starred, err := s.Repo.StarredIDs(messageIDs(messages), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]MessageView, len(messages))
 	for i, msg := range messages {
-		if msg.Encrypted {
-			decrypted, err := encryption.DecryptAES(s.AESSecretKey, msg.Content)
-			if err == nil {
-				messages[i].Content = decrypted
-			}
+		msg.Content = s.decrypt(msg.Content, msg.Encrypted)
+		// Получатель отключил отчёты о прочтении — отправитель их не видит
+		if msg.SenderID == userID && hidden[msg.ReceiverID] {
+			msg.ReadAt = nil
 		}
+		views[i] = MessageView{
+			Message: msg,
+			Status:  messageStatus(msg),
+			Edited:  msg.EditedAt != nil,
+			Deleted: msg.DeletedForEveryoneAt != nil,
+
+			Attachments: attachments[msg.ID],
+
+			ThreadReplyCount: replyCounts[msg.ID],
+			Reactions:        reactions[msg.ID],
+
+			Pinned:  pinned[msg.ID],
+			Starred: starred[msg.ID],
+		}
+		if msg.ReplyToID != nil {
+			views[i].ReplyTo = quotes[*msg.ReplyToID]
+		}
+	}
+	return views, nil
+}
+
+func (s *MessageService) getVisibleMessage(messageID, userID uint) (*models.Message, error) {
+	msg, err := s.Repo.GetVisibleMessage(messageID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	return msg, err
+}
+
+func (s *MessageService) decrypt(content string, encrypted bool) string {
+	if !encrypted {
+		return content
+	}
+	span := startChild(s.context(), "encryption.DecryptAES")
+	defer span.End()
+
+	decrypted, err := encryption.DecryptAES(s.AESSecretKey, content)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "decrypt failed")
+		// Повреждённая запись или чужой ключ: отдаём как есть, но не молча
+		slog.ErrorContext(s.context(), "crypto: failed to decrypt message content", "error", err)
+		s.Metrics.CryptoError(metrics.OpDecrypt)
+		return content
+	}
+	return decrypted
+}
+
+func (s *MessageService) encrypt(plainText string) (string, error) {
+	span := startChild(s.context(), "encryption.EncryptAES")
+	defer span.End()
+
+	encrypted, err := encryption.EncryptAES(s.AESSecretKey, plainText)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "encrypt failed")
+		s.Metrics.CryptoError(metrics.OpEncrypt)
+	}
+	return encrypted, err
+}
+
+// receiptsHiddenFrom возвращает получателей исходящих сообщений, отключивших отчёты о прочтении
+func (s *MessageService) receiptsHiddenFrom(userID uint, messages []models.Message) (map[uint]bool, error) {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, msg := range messages {
+		if msg.SenderID == userID && msg.ReadAt != nil && !seen[msg.ReceiverID] {
+			seen[msg.ReceiverID] = true
+			ids = append(ids, msg.ReceiverID)
+		}
+	}
+
+	users, err := s.Users.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := make(map[uint]bool)
+	for _, u := range users {
+		if !u.ReadReceipts {
+			hidden[u.ID] = true
+		}
+	}
+	return hidden, nil
+}
+
+func (s *MessageService) attachmentsFor(messages []models.Message) (map[uint][]models.Attachment, error) {
+	list, err := s.Attachments.GetForMessages(messageIDs(messages))
+	if err != nil {
+		return nil, err
+	}
+
+	byMessage := make(map[uint][]models.Attachment)
+	for _, a := range list {
+		byMessage[*a.MessageID] = append(byMessage[*a.MessageID], a)
 	}
-	return messages, nil
+	return byMessage, nil
 }
 
-func (s *MessageService) DeleteMessage(messageID uint, userID uint) error {
-	return s.Repo.DeleteMessage(messageID, userID)
+// quotesFor собирает цитаты сообщений, на которые отвечают; невидимые пользователю не цитируются
+func (s *MessageService) quotesFor(userID uint, messages []models.Message) (map[uint]*MessageQuote, error) {
+	var ids []uint
+	for _, msg := range messages {
+		if msg.ReplyToID != nil {
+			ids = append(ids, *msg.ReplyToID)
+		}
+	}
+
+	quoted, err := s.Repo.GetVisibleMessages(ids, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[uint]*MessageQuote, len(quoted))
+	for _, q := range quoted {
+		quotes[q.ID] = &MessageQuote{
+			ID:       q.ID,
+			SenderID: q.SenderID,
+			Content:  truncateRunes(s.decrypt(q.Content, q.Encrypted), quoteLength),
+			Deleted:  q.DeletedForEveryoneAt != nil,
+		}
+	}
+	return quotes, nil
+}
+
+func (s *MessageService) reactionsFor(userID uint, messages []models.Message) (map[uint][]repository.ReactionSummary, error) {
+	summaries, err := s.Repo.SummarizeReactions(messageIDs(messages), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byMessage := make(map[uint][]repository.ReactionSummary)
+	for _, summary := range summaries {
+		byMessage[summary.MessageID] = append(byMessage[summary.MessageID], summary)
+	}
+	return byMessage, nil
+}
+
+func messageIDs(messages []models.Message) []uint {
+	ids := make([]uint, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// truncateRunes обрезает текст до n символов, отмечая обрезку многоточием
+func truncateRunes(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(append(runes[:n], '…'))
+}
+
+func messageStatus(msg models.Message) string {
+	switch {
+	case msg.ReadAt != nil:
+		return MessageStatusRead
+	case msg.DeliveredAt != nil:
+		return MessageStatusDelivered
+	default:
+		return MessageStatusSent
+	}
 }
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+)
+
+const (
+	EventPinAdded   = "pin.added"
+	EventPinRemoved = "pin.removed"
+)
+
+var (
+	ErrTooManyPins = apperror.New(apperror.KindConflict, "too_many_pins", "too many pinned messages")
+	ErrPinNotFound = apperror.New(apperror.KindNotFound, "pin_not_found", "message is not pinned")
+	ErrNotStarred  = apperror.New(apperror.KindNotFound, "star_not_found", "message is not starred")
+)
+
+// PinEvent — содержимое событий о закреплении
+type PinEvent struct {
+	MessageID uint `json:"message_id"`
+	UserID    uint `json:"user_id"`
+}
+
+// PinnedMessage — закреплённое сообщение глазами участника переписки
+type PinnedMessage struct {
+	Message  MessageView `json:"message"`
+	PinnedBy uint        `json:"pinned_by"`
+	PinnedAt time.Time   `json:"pinned_at"`
+}
+
+// PinMessage закрепляет сообщение в переписке; закрепить можно не больше MaxPins сообщений
+func (s *MessageService) PinMessage(messageID, userID uint) error {
+	s, span := s.trace("PinMessage")
+	defer span.End()
+
+	msg, err := s.reactableMessage(messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	added, err := s.Repo.AddPin(&models.Pin{
+		MessageID:  messageID,
+		UserLowID:  msg.SenderID,
+		UserHighID: msg.ReceiverID,
+		PinnedBy:   userID,
+	}, s.MaxPins)
+	if errors.Is(err, repository.ErrPinLimit) {
+		return ErrTooManyPins
+	}
+	if err != nil {
+		return err
+	}
+	if added {
+		s.notifyParticipants(msg, EventPinAdded, PinEvent{MessageID: messageID, UserID: userID})
+	}
+	return nil
+}
+
+// UnpinMessage снимает закрепление; это может сделать любой участник переписки
+func (s *MessageService) UnpinMessage(messageID, userID uint) error {
+	s, span := s.trace("UnpinMessage")
+	defer span.End()
+
+	msg, err := s.getVisibleMessage(messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.Repo.RemovePin(messageID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrPinNotFound
+	}
+	s.notifyParticipants(msg, EventPinRemoved, PinEvent{MessageID: messageID, UserID: userID})
+	return nil
+}
+
+// ListPins возвращает закреплённые сообщения переписки с peerID, которые видит пользователь
+func (s *MessageService) ListPins(userID, peerID uint) ([]PinnedMessage, error) {
+	s, span := s.trace("ListPins")
+	defer span.End()
+
+	pins, err := s.Repo.ListPins(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(pins))
+	for i, pin := range pins {
+		ids[i] = pin.MessageID
+	}
+	messages, err := s.Repo.GetVisibleMessages(ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	views, err := s.buildViews(userID, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]MessageView, len(views))
+	for _, v := range views {
+		byID[v.ID] = v
+	}
+	// Скрытые у себя и истёкшие сообщения не показываются, но закрепление остаётся у собеседника
+	result := make([]PinnedMessage, 0, len(pins))
+	for _, pin := range pins {
+		if view, ok := byID[pin.MessageID]; ok {
+			result = append(result, PinnedMessage{Message: view, PinnedBy: pin.PinnedBy, PinnedAt: pin.CreatedAt})
+		}
+	}
+	return result, nil
+}
+
+// StarMessage сохраняет сообщение в личное избранное пользователя
+func (s *MessageService) StarMessage(messageID, userID uint) error {
+	s, span := s.trace("StarMessage")
+	defer span.End()
+
+	if _, err := s.reactableMessage(messageID, userID); err != nil {
+		return err
+	}
+	_, err := s.Repo.AddStar(&models.Star{MessageID: messageID, UserID: userID})
+	return err
+}
+
+func (s *MessageService) UnstarMessage(messageID, userID uint) error {
+	s, span := s.trace("UnstarMessage")
+	defer span.End()
+
+	removed, err := s.Repo.RemoveStar(messageID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotStarred
+	}
+	return nil
+}
+
+// ListStarred возвращает избранное пользователя из всех переписок, от новых сообщений к старым
+func (s *MessageService) ListStarred(userID, beforeID uint, limit int) ([]MessageView, error) {
+	s, span := s.trace("ListStarred")
+	defer span.End()
+
+	messages, err := s.Repo.ListStarred(userID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildViews(userID, messages)
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+)
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+
+	EventPresenceChanged = "presence.changed"
+	EventTyping          = "typing"
+)
+
+var ErrPresenceHidden = apperror.New(apperror.KindForbidden, "presence_hidden", "presence hidden")
+
+// Presence — онлайн-статус пользователя глазами другого пользователя
+type Presence struct {
+	UserID     uint       `json:"user_id"`
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// TypingEvent — собеседник печатает (или перестал); клиент гасит индикатор сам после ExpiresAt
+type TypingEvent struct {
+	UserID    uint       `json:"user_id"`
+	Typing    bool       `json:"typing"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type typingKey struct{ from, to uint }
+
+// typingTimer — таймер индикатора; по указателю сработавший таймер отличает себя от продлённого
+type typingTimer struct{ timer *time.Timer }
+
+// PresenceService отслеживает активность пользователей (открытые соединения и запросы к API)
+// и рассылает события присутствия и набора текста. Состояние хранится в памяти процесса;
+// в базу время последней активности пишется не чаще PersistInterval.
+type PresenceService struct {
+	Users    *repository.UserRepository
+	Contacts *ContactService
+	Hub      *realtime.Hub
+
+	AwayAfter       time.Duration // с открытым соединением, но без активности дольше — "отошёл"
+	ActivityWindow  time.Duration // без соединения "в сети" столько времени после последнего запроса
+	PersistInterval time.Duration
+	TypingTimeout   time.Duration // через сколько индикатор набора гаснет сам
+
+	mu        sync.Mutex
+	active    map[uint]time.Time
+	persisted map[uint]time.Time
+	typing    map[typingKey]*typingTimer
+}
+
+func NewPresenceService(users *repository.UserRepository, contacts *ContactService, hub *realtime.Hub) *PresenceService {
+	return &PresenceService{
+		Users:           users,
+		Contacts:        contacts,
+		Hub:             hub,
+		AwayAfter:       5 * time.Minute,
+		ActivityWindow:  time.Minute,
+		PersistInterval: time.Minute,
+		TypingTimeout:   5 * time.Second,
+		active:          make(map[uint]time.Time),
+		persisted:       make(map[uint]time.Time),
+		typing:          make(map[typingKey]*typingTimer),
+	}
+}
+
+// Touch отмечает активность пользователя (любой запрос к API)
+func (s *PresenceService) Touch(ctx context.Context, userID uint) {
+	now := time.Now()
+
+	s.mu.Lock()
+	s.active[userID] = now
+	persist := now.Sub(s.persisted[userID]) >= s.PersistInterval
+	if persist {
+		s.persisted[userID] = now
+	}
+	s.mu.Unlock()
+
+	if persist {
+		if err := s.Users.TouchLastSeen(userID, now); err != nil {
+			slog.ErrorContext(ctx, "presence: failed to save last seen", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// Subscribe открывает поток событий пользователя, как Hub.Subscribe, и сообщает
+// его собеседникам о появлении в сети и об уходе после закрытия последнего соединения
+func (s *PresenceService) Subscribe(ctx context.Context, userID uint) (<-chan realtime.Event, func()) {
+	wasOnline := s.Hub.Online(userID)
+	events, cancel := s.Hub.Subscribe(userID)
+	s.Touch(ctx, userID)
+	if !wasOnline {
+		s.broadcast(ctx, userID)
+	}
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			cancel()
+			if !s.Hub.Online(userID) {
+				s.forcePersist(ctx, userID)
+				s.broadcast(ctx, userID)
+			}
+		})
+	}
+}
+
+// GetPresence возвращает статус userID, если viewerID разрешено его видеть
+func (s *PresenceService) GetPresence(viewerID, userID uint) (*Presence, error) {
+	user, err := s.Users.GetByID(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	visible, err := s.visibleTo(user, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrPresenceHidden
+	}
+	return s.presenceOf(user), nil
+}
+
+// SetTyping сообщает собеседнику, что пользователь печатает (typing=false — перестал).
+// Повторные вызовы продлевают индикатор; без них он гаснет через TypingTimeout.
+func (s *PresenceService) SetTyping(ctx context.Context, userID, peerID uint, typing bool) error {
+	reachable, err := s.Contacts.CanReach(userID, peerID)
+	if err != nil {
+		return err
+	}
+	if !reachable {
+		// Как и при молчаливой блокировке, не раскрываем, что событие никто не увидит
+		return nil
+	}
+	s.Touch(ctx, userID)
+
+	key := typingKey{from: userID, to: peerID}
+	s.mu.Lock()
+	current, wasTyping := s.typing[key]
+	if wasTyping {
+		current.timer.Stop()
+		delete(s.typing, key)
+	}
+	if typing {
+		t := &typingTimer{}
+		t.timer = time.AfterFunc(s.TypingTimeout, func() { s.stopTyping(key, t) })
+		s.typing[key] = t
+	}
+	s.mu.Unlock()
+
+	if typing {
+		expiresAt := time.Now().Add(s.TypingTimeout)
+		s.Hub.Publish(peerID, realtime.Event{Type: EventTyping, Data: TypingEvent{UserID: userID, Typing: true, ExpiresAt: &expiresAt}})
+	} else if wasTyping {
+		s.Hub.Publish(peerID, realtime.Event{Type: EventTyping, Data: TypingEvent{UserID: userID}})
+	}
+	return nil
+}
+
+// stopTyping гасит индикатор, если его не продлили. Таймер мог сработать, пока
+// SetTyping ставил новый, — тогда запись уже принадлежит новому таймеру и не трогается.
+func (s *PresenceService) stopTyping(key typingKey, t *typingTimer) {
+	s.mu.Lock()
+	ok := s.typing[key] == t
+	if ok {
+		delete(s.typing, key)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		s.Hub.Publish(key.to, realtime.Event{Type: EventTyping, Data: TypingEvent{UserID: key.from}})
+	}
+}
+
+func (s *PresenceService) presenceOf(user *models.User) *Presence {
+	lastSeen := user.LastSeenAt
+	s.mu.Lock()
+	if at, ok := s.active[user.ID]; ok && (lastSeen == nil || at.After(*lastSeen)) {
+		lastSeen = &at
+	}
+	s.mu.Unlock()
+
+	idle := time.Duration(math.MaxInt64)
+	if lastSeen != nil {
+		idle = time.Since(*lastSeen)
+	}
+	connected := s.Hub.Online(user.ID)
+
+	p := &Presence{UserID: user.ID, Status: PresenceOffline, LastSeenAt: lastSeen}
+	switch {
+	case connected && idle < s.AwayAfter, !connected && idle < s.ActivityWindow:
+		p.Status = PresenceOnline
+		p.LastSeenAt = nil
+	case connected:
+		p.Status = PresenceAway
+	}
+	return p
+}
+
+// visibleTo — может ли viewerID видеть статус user: сам пользователь, его контакты
+// и (если он не ограничил видимость контактами) собеседники; заблокированные — никогда
+func (s *PresenceService) visibleTo(user *models.User, viewerID uint) (bool, error) {
+	if user.ID == viewerID {
+		return true, nil
+	}
+	if user.PresenceVisibility == models.PresenceVisibilityNobody {
+		return false, nil
+	}
+	blocked, err := s.Contacts.Repo.IsBlocked(user.ID, viewerID)
+	if err != nil || blocked {
+		return false, err
+	}
+	isContact, err := s.Contacts.Repo.IsContact(user.ID, viewerID)
+	if err != nil || isContact {
+		return isContact, err
+	}
+	if user.PresenceVisibility != models.PresenceVisibilityPeers {
+		return false, nil
+	}
+	return s.Contacts.Repo.IsPeer(user.ID, viewerID)
+}
+
+// audience — кому разрешено видеть статус пользователя
+func (s *PresenceService) audience(user *models.User) ([]uint, error) {
+	if user.PresenceVisibility == models.PresenceVisibilityNobody {
+		return nil, nil
+	}
+	ids, err := s.Contacts.Repo.ContactIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if user.PresenceVisibility == models.PresenceVisibilityPeers {
+		peers, err := s.Contacts.Repo.PeerIDs(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, peers...)
+	}
+	blocked, err := s.Contacts.Repo.BlockedIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[uint]bool{user.ID: true}
+	for _, id := range blocked {
+		skip[id] = true
+	}
+	var result []uint
+	for _, id := range ids {
+		if !skip[id] {
+			skip[id] = true
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// broadcast рассылает текущий статус пользователя всем, кому он виден
+func (s *PresenceService) broadcast(ctx context.Context, userID uint) {
+	user, err := s.Users.GetByID(userID)
+	if err != nil {
+		return
+	}
+	ids, err := s.audience(user)
+	if err != nil {
+		slog.ErrorContext(ctx, "presence: failed to resolve audience", "user_id", userID, "error", err)
+		return
+	}
+
+	p := s.presenceOf(user)
+	if !s.Hub.Online(userID) {
+		// Последнее соединение закрыто — для собеседников пользователь ушёл из сети
+		p.Status = PresenceOffline
+		p.LastSeenAt = user.LastSeenAt
+		if at := s.lastActive(userID); at != nil {
+			p.LastSeenAt = at
+		}
+	}
+	event := realtime.Event{Type: EventPresenceChanged, Data: p}
+	for _, id := range ids {
+		s.Hub.Publish(id, event)
+	}
+}
+
+func (s *PresenceService) lastActive(userID uint) *time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if at, ok := s.active[userID]; ok {
+		return &at
+	}
+	return nil
+}
+
+// forcePersist сохраняет время последней активности и забывает пользователя без
+// соединений: дальше его статус читается из базы. Если он успел проявить активность
+// или запись не удалась, состояние в памяти остаётся. Возвращает true, если забыт.
+func (s *PresenceService) forcePersist(ctx context.Context, userID uint) bool {
+	s.mu.Lock()
+	at, ok := s.active[userID]
+	previous := s.persisted[userID]
+	if ok {
+		s.persisted[userID] = at
+	}
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if !previous.Equal(at) {
+		if err := s.Users.TouchLastSeen(userID, at); err != nil {
+			slog.ErrorContext(ctx, "presence: failed to save last seen", "user_id", userID, "error", err)
+			s.mu.Lock()
+			if s.persisted[userID].Equal(at) {
+				s.persisted[userID] = previous
+			}
+			s.mu.Unlock()
+			return false
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[userID].Equal(at) && !s.Hub.Online(userID) {
+		delete(s.active, userID)
+		delete(s.persisted, userID)
+		return true
+	}
+	return false
+}
+
+// Sweep забывает пользователей без соединений, не проявлявших активности дольше
+// max(AwayAfter, ActivityWindow), предварительно сохранив время их активности.
+// Без этого память росла бы с каждым, кто обращался только к REST API.
+// Возвращает число забытых пользователей.
+func (s *PresenceService) Sweep(ctx context.Context, now time.Time) int {
+	idleAfter := max(s.AwayAfter, s.ActivityWindow)
+	var idle []uint
+	s.mu.Lock()
+	for userID, at := range s.active {
+		if now.Sub(at) >= idleAfter {
+			idle = append(idle, userID)
+		}
+	}
+	s.mu.Unlock()
+
+	evicted := 0
+	for _, userID := range idle {
+		if ctx.Err() != nil {
+			break
+		}
+		if !s.Hub.Online(userID) && s.forcePersist(ctx, userID) {
+			evicted++
+		}
+	}
+	return evicted
+}
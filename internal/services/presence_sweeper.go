@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSweepInterval — как часто забывать неактивных пользователей, если интервал не задан
+const DefaultSweepInterval = time.Minute
+
+// PresenceSweeper периодически убирает из памяти PresenceService пользователей,
+// которые давно не проявляли активности (см. PresenceService.Sweep)
+type PresenceSweeper struct {
+	periodic
+
+	Presence *PresenceService
+	Interval time.Duration
+}
+
+// NewPresenceSweeper создаёт очистку; неположительный interval заменяется DefaultSweepInterval
+func NewPresenceSweeper(presence *PresenceService, interval time.Duration) *PresenceSweeper {
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	return &PresenceSweeper{Presence: presence, Interval: interval}
+}
+
+// Start запускает очистку; она работает, пока не отменён ctx
+func (p *PresenceSweeper) Start(ctx context.Context) {
+	p.start(ctx, "presence sweeper", p.Interval, func(ctx context.Context) error {
+		p.Presence.Sweep(ctx, time.Now())
+		return nil
+	})
+}
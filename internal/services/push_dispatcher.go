@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"secure-messenger/internal/models"
+)
+
+// PushDispatcher периодически отправляет уведомления из очереди, повторяя неудачные попытки
+type PushDispatcher struct {
+	periodic
+
+	Push      *PushService
+	Interval  time.Duration
+	BatchSize int
+}
+
+func NewPushDispatcher(push *PushService, interval time.Duration, batchSize int) *PushDispatcher {
+	return &PushDispatcher{
+		Push:      push,
+		Interval:  interval,
+		BatchSize: batchSize,
+	}
+}
+
+// Start запускает отправку; она работает, пока не отменён ctx
+func (d *PushDispatcher) Start(ctx context.Context) {
+	d.start(ctx, "push dispatcher", d.Interval, func(ctx context.Context) error {
+		_, err := d.DispatchDue(ctx, time.Now())
+		return err
+	})
+}
+
+// DispatchDue отправляет уведомления, время попытки которых не позже now,
+// и возвращает число доставленных
+func (d *PushDispatcher) DispatchDue(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		due, err := d.Push.Repo.FindDue(now, d.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		ids := make([]uint, len(due))
+		for i, n := range due {
+			ids[i] = n.DeviceTokenID
+		}
+		devices, err := d.Push.Repo.DevicesByID(ids)
+		if err != nil {
+			return total, err
+		}
+
+		for i := range due {
+			var device *models.DeviceToken
+			if found, ok := devices[due[i].DeviceTokenID]; ok {
+				device = &found
+			}
+			sent, err := d.Push.deliver(ctx, &due[i], device, now)
+			if err != nil {
+				return total, err
+			}
+			if sent {
+				total++
+			}
+		}
+		if len(due) < d.BatchSize {
+			break
+		}
+	}
+	return total, nil
+}
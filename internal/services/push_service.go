@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+	"secure-messenger/pkg/encryption"
+	"secure-messenger/pkg/push"
+)
+
+const (
+	// MaxDeviceTokenLength — максимальная длина токена устройства
+	MaxDeviceTokenLength = 512
+	// pushPreviewLength — сколько символов текста показывать в уведомлении
+	pushPreviewLength = 200
+)
+
+var (
+	ErrInvalidDevice  = apperror.New(apperror.KindInvalid, "invalid_device_token", "invalid device token")
+	ErrDeviceNotFound = apperror.New(apperror.KindNotFound, "device_not_found", "device not found")
+)
+
+// PushProvider доставляет уведомление на устройство (см. push.WebhookProvider).
+// push.ErrInvalidToken и push.ErrRejected — окончательный отказ, прочие ошибки повторяются.
+type PushProvider interface {
+	Send(ctx context.Context, n push.Notification) error
+}
+
+// pushPayload — то, что хранится (в зашифрованном виде) в очереди уведомлений
+type pushPayload struct {
+	Title string            `json:"title,omitempty"`
+	Body  string            `json:"body,omitempty"`
+	Data  map[string]string `json:"data"`
+}
+
+// PushService регистрирует устройства и ставит уведомления о новых сообщениях в очередь,
+// которую разбирает PushDispatcher
+type PushService struct {
+	Repo          *repository.PushRepository
+	Users         *repository.UserRepository
+	Conversations *repository.ConversationRepository
+	Hub           *realtime.Hub // у кого есть открытое соединение, тот уведомлений не получает
+	Provider      PushProvider  // nil — уведомления не отправляются
+	AESSecretKey  []byte
+
+	MaxAttempts  int
+	RetryBackoff time.Duration // задержка перед второй попыткой; дальше удваивается
+	MaxBackoff   time.Duration
+}
+
+func NewPushService(
+	r *repository.PushRepository,
+	users *repository.UserRepository,
+	conversations *repository.ConversationRepository,
+	hub *realtime.Hub,
+	provider PushProvider,
+	key []byte,
+) *PushService {
+	return &PushService{
+		Repo:          r,
+		Users:         users,
+		Conversations: conversations,
+		Hub:           hub,
+		Provider:      provider,
+		AESSecretKey:  key,
+		MaxAttempts:   5,
+		RetryBackoff:  30 * time.Second,
+		MaxBackoff:    time.Hour,
+	}
+}
+
+func (s *PushService) RegisterDevice(userID uint, platform, token string) (*models.DeviceToken, error) {
+	switch platform {
+	case models.PlatformIOS, models.PlatformAndroid, models.PlatformWeb:
+	default:
+		return nil, ErrInvalidDevice
+	}
+	if token == "" || len(token) > MaxDeviceTokenLength {
+		return nil, ErrInvalidDevice
+	}
+
+	device := &models.DeviceToken{UserID: userID, Platform: platform, Token: token}
+	if err := s.Repo.RegisterDevice(device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func (s *PushService) ListDevices(userID uint) ([]models.DeviceToken, error) {
+	return s.Repo.ListDevices(userID)
+}
+
+func (s *PushService) UnregisterDevice(userID, deviceID uint) error {
+	deleted, err := s.Repo.DeleteDevice(deviceID, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// NotifyMessage ставит в очередь уведомления о сообщении на устройства получателя,
+// если он сейчас не в сети и не отключил уведомления от этого собеседника.
+// Текст попадает в уведомление, только если получатель включил PushPreviews.
+func (s *PushService) NotifyMessage(msg *models.Message, plainText string) error {
+	if s.Provider == nil || msg.Pending || msg.Suppressed {
+		return nil
+	}
+	if s.Hub != nil && s.Hub.Online(msg.ReceiverID) {
+		return nil
+	}
+
+	mute, err := s.Conversations.GetMute(msg.ReceiverID, msg.SenderID, time.Now())
+	if err != nil || mute != nil {
+		return err
+	}
+	devices, err := s.Repo.ListDevices(msg.ReceiverID)
+	if err != nil || len(devices) == 0 {
+		return err
+	}
+	receiver, err := s.Users.GetByID(msg.ReceiverID)
+	if err != nil {
+		return err
+	}
+
+	payload := pushPayload{Data: map[string]string{
+		"type":       "message",
+		"message_id": strconv.FormatUint(uint64(msg.ID), 10),
+		"sender_id":  strconv.FormatUint(uint64(msg.SenderID), 10),
+	}}
+	if receiver.PushPreviews {
+		sender, err := s.Users.GetByID(msg.SenderID)
+		if err != nil {
+			return err
+		}
+		payload.Title = sender.DisplayName
+		if payload.Title == "" {
+			payload.Title = sender.Name
+		}
+		payload.Body = truncateRunes(plainText, pushPreviewLength)
+	}
+	encoded, err := s.encodePayload(payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	queue := make([]models.PushNotification, len(devices))
+	for i, device := range devices {
+		queue[i] = models.PushNotification{DeviceTokenID: device.ID, Payload: encoded, NextAttemptAt: now}
+	}
+	return s.Repo.Enqueue(queue)
+}
+
+// deliver отправляет одно уведомление из очереди. Успешно отправленные и окончательно
+// отклонённые уведомления удаляются из очереди, остальные откладываются с нарастающей задержкой.
+func (s *PushService) deliver(ctx context.Context, n *models.PushNotification, device *models.DeviceToken, now time.Time) (bool, error) {
+	if device == nil {
+		// Устройство удалено, пока уведомление ждало в очереди
+		return false, s.Repo.Dequeue(n.ID)
+	}
+	payload, err := s.decodePayload(n.Payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "push: dropping unreadable notification", "notification_id", n.ID, "error", err)
+		return false, s.Repo.Dequeue(n.ID)
+	}
+
+	err = s.Provider.Send(ctx, push.Notification{
+		Platform: device.Platform,
+		Token:    device.Token,
+		Title:    payload.Title,
+		Body:     payload.Body,
+		Data:     payload.Data,
+	})
+	switch {
+	case err == nil:
+		return true, s.Repo.Dequeue(n.ID)
+	case errors.Is(err, push.ErrInvalidToken):
+		_, err := s.Repo.DeleteDevice(device.ID, 0)
+		return false, err
+	case errors.Is(err, push.ErrRejected), n.Attempts+1 >= s.MaxAttempts:
+		slog.WarnContext(ctx, "push: dropping notification", "notification_id", n.ID, "attempts", n.Attempts+1, "error", err)
+		return false, s.Repo.Dequeue(n.ID)
+	default:
+		return false, s.Repo.Retry(n, now.Add(s.backoff(n.Attempts)), err.Error())
+	}
+}
+
+// backoff — задержка перед следующей попыткой после attempts неудачных
+func (s *PushService) backoff(attempts int) time.Duration {
+	d := s.RetryBackoff
+	for i := 0; i < attempts && d < s.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.MaxBackoff {
+		d = s.MaxBackoff
+	}
+	return d
+}
+
+func (s *PushService) encodePayload(p pushPayload) (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return encryption.EncryptAES(s.AESSecretKey, string(data))
+}
+
+func (s *PushService) decodePayload(encoded string) (*pushPayload, error) {
+	data, err := encryption.DecryptAES(s.AESSecretKey, encoded)
+	if err != nil {
+		return nil, err
+	}
+	var p pushPayload
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/realtime"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+)
+
+const (
+	EventReactionAdded   = "reaction.added"
+	EventReactionRemoved = "reaction.removed"
+
+	maxEmojiBytes = 32
+)
+
+var (
+	ErrInvalidEmoji     = apperror.New(apperror.KindInvalid, "invalid_emoji", "invalid emoji")
+	ErrTooManyReactions = apperror.New(apperror.KindConflict, "too_many_reactions", "too many distinct reactions")
+	ErrReactionNotFound = apperror.New(apperror.KindNotFound, "reaction_not_found", "reaction not found")
+)
+
+// ReactionEvent — содержимое событий о реакциях
+type ReactionEvent struct {
+	MessageID uint   `json:"message_id"`
+	UserID    uint   `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// AddReaction ставит реакцию на сообщение, видимое пользователю
+func (s *MessageService) AddReaction(messageID, userID uint, emoji string) error {
+	s, span := s.trace("AddReaction")
+	defer span.End()
+
+	if !validEmoji(emoji) {
+		return ErrInvalidEmoji
+	}
+	msg, err := s.reactableMessage(messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Новый вид реакции не должен превысить лимит разных реакций на сообщение
+	added, err := s.Repo.AddReaction(&models.Reaction{MessageID: messageID, UserID: userID, Emoji: emoji}, s.MaxDistinctReactions)
+	if errors.Is(err, repository.ErrReactionLimit) {
+		return ErrTooManyReactions
+	}
+	if err != nil {
+		return err
+	}
+	if added {
+		s.notifyParticipants(msg, EventReactionAdded, ReactionEvent{MessageID: messageID, UserID: userID, Emoji: emoji})
+	}
+	return nil
+}
+
+func (s *MessageService) RemoveReaction(messageID, userID uint, emoji string) error {
+	s, span := s.trace("RemoveReaction")
+	defer span.End()
+
+	msg, err := s.reactableMessage(messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.Repo.RemoveReaction(messageID, userID, emoji)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrReactionNotFound
+	}
+	s.notifyParticipants(msg, EventReactionRemoved, ReactionEvent{MessageID: messageID, UserID: userID, Emoji: emoji})
+	return nil
+}
+
+// reactableMessage — реагировать можно на видимые и не удалённые сообщения
+func (s *MessageService) reactableMessage(messageID, userID uint) (*models.Message, error) {
+	msg, err := s.getVisibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedForEveryoneAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	return msg, nil
+}
+
+// notifyParticipants отправляет событие обоим участникам переписки (и другим сессиям автора).
+// Получатель недоставленного сообщения (запрос на переписку, блокировка) событий не получает.
+func (s *MessageService) notifyParticipants(msg *models.Message, eventType string, data interface{}) {
+	if s.Hub == nil {
+		return
+	}
+	event := realtime.Event{Type: eventType, Data: data}
+	s.Hub.Publish(msg.SenderID, event)
+	if msg.ReceiverID != msg.SenderID && !msg.Pending && !msg.Suppressed {
+		s.Hub.Publish(msg.ReceiverID, event)
+	}
+}
+
+// validEmoji пропускает короткие последовательности из символов-пиктограмм
+// и служебных кодов эмодзи (модификаторы, ZWJ, вариационные селекторы)
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiBytes || !utf8.ValidString(emoji) {
+		return false
+	}
+	hasSymbol := false
+	for _, r := range emoji {
+		switch {
+		case unicode.Is(unicode.So, r) || unicode.Is(unicode.Sk, r):
+			hasSymbol = true
+		case r == '\u200d' || unicode.Is(unicode.Variation_Selector, r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+		case unicode.Is(unicode.Regional_Indicator, r):
+			hasSymbol = true
+		default:
+			return false
+		}
+	}
+	return hasSymbol
+}
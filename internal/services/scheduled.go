@@ -0,0 +1,312 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+)
+
+// MaxScheduleAhead — насколько далеко вперёд можно отложить сообщение
+const MaxScheduleAhead = 365 * 24 * time.Hour
+
+var (
+	ErrScheduledNotFound   = apperror.New(apperror.KindNotFound, "scheduled_message_not_found", "scheduled message not found")
+	ErrInvalidSendAt       = apperror.New(apperror.KindInvalid, "invalid_send_at", "invalid send_at")
+	ErrScheduleAttachments = apperror.New(apperror.KindInvalid, "scheduled_attachments", "attachments cannot be scheduled")
+	ErrEmptyUpdate         = apperror.New(apperror.KindInvalid, "empty_update", "nothing to update")
+)
+
+// ScheduledMessageView — отложенное сообщение глазами его автора
+type ScheduledMessageView struct {
+	ID              uint      `json:"id"`
+	ClientMessageID *string   `json:"client_message_id,omitempty"`
+	ReceiverID      uint      `json:"receiver_id"`
+	Content         string    `json:"content"`
+	SendAt          time.Time `json:"send_at"`
+	TTLSeconds      *int      `json:"ttl_seconds"`
+	TTLAfterRead    bool      `json:"ttl_after_read"`
+	ReplyToID       *uint     `json:"reply_to_id"`
+	ThreadRootID    *uint     `json:"thread_root_id"`
+	Status          string    `json:"status"`
+	FailureReason   string    `json:"failure_reason,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ScheduledUpdate — изменения отложенного сообщения; nil — не менять
+type ScheduledUpdate struct {
+	Content *string
+	SendAt  *time.Time
+}
+
+// ScheduleMessage сохраняет сообщение для отправки в opts.SendAt. Получатель и ссылки
+// проверяются сейчас и ещё раз при доставке — к тому времени всё может измениться.
+// Повтор с тем же opts.ClientMessageID возвращает ранее запланированное сообщение
+// (created == false).
+func (s *MessageService) ScheduleMessage(senderID, receiverID uint, plainText string, opts SendOptions) (view *ScheduledMessageView, created bool, err error) {
+	s, span := s.trace("ScheduleMessage")
+	defer span.End()
+
+	if opts.ClientMessageID != "" {
+		if !ValidClientMessageID(opts.ClientMessageID) {
+			return nil, false, ErrInvalidClientMessageID
+		}
+		view, err := s.replayScheduled(senderID, receiverID, plainText, opts.ClientMessageID)
+		if err != nil || view != nil {
+			return view, false, err
+		}
+	}
+	if opts.SendAt == nil || !validSendAt(*opts.SendAt) {
+		return nil, false, ErrInvalidSendAt
+	}
+	if len(opts.AttachmentIDs) > 0 {
+		return nil, false, ErrScheduleAttachments
+	}
+	if err := s.checkScheduleReceiver(senderID, receiverID); err != nil {
+		return nil, false, err
+	}
+	if opts.TTLSeconds != nil {
+		if err := ValidateTTL(*opts.TTLSeconds); err != nil {
+			return nil, false, err
+		}
+	}
+	probe := &models.Message{SenderID: senderID, ReceiverID: receiverID}
+	if err := s.applyReferences(probe, opts); err != nil {
+		return nil, false, err
+	}
+
+	encrypted, err := s.encrypt(plainText)
+	if err != nil {
+		return nil, false, err
+	}
+	sm := &models.ScheduledMessage{
+		SenderID:     senderID,
+		ReceiverID:   receiverID,
+		Content:      encrypted,
+		Encrypted:    true,
+		SendAt:       *opts.SendAt,
+		TTLSeconds:   opts.TTLSeconds,
+		TTLAfterRead: opts.TTLAfterRead,
+		ReplyToID:    opts.ReplyToID,
+		ThreadRootID: opts.ThreadRootID,
+		Status:       models.ScheduledPending,
+		Version:      1,
+	}
+	if opts.ClientMessageID != "" {
+		clientID := opts.ClientMessageID
+		sm.ClientMessageID = &clientID
+	}
+	if err := s.Scheduled.Create(sm); err != nil {
+		if opts.ClientMessageID != "" {
+			// Параллельный запрос с тем же ключом успел раньше
+			view, replayErr := s.replayScheduled(senderID, receiverID, plainText, opts.ClientMessageID)
+			if replayErr == nil && view != nil {
+				return view, false, nil
+			}
+		}
+		return nil, false, err
+	}
+	return s.scheduledView(sm), true, nil
+}
+
+// replayScheduled — как replay, но для отложенных сообщений. Ключ, под которым
+// уже отправлено обычное сообщение, для планирования не годится.
+func (s *MessageService) replayScheduled(senderID, receiverID uint, plainText, clientID string) (*ScheduledMessageView, error) {
+	sm, err := s.Scheduled.GetByClientID(senderID, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		_, err := s.Repo.GetByClientID(senderID, clientID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrIdempotencyConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Текст мог измениться через UpdateScheduled — тогда сравнивать не с чем
+	if sm.ReceiverID != receiverID || (sm.Version == 1 && s.decrypt(sm.Content, sm.Encrypted) != plainText) {
+		return nil, ErrIdempotencyConflict
+	}
+	return s.scheduledView(sm), nil
+}
+
+// ListScheduled возвращает ожидающие и не доставленные из-за ошибки сообщения пользователя
+func (s *MessageService) ListScheduled(senderID uint) ([]ScheduledMessageView, error) {
+	s, span := s.trace("ListScheduled")
+	defer span.End()
+
+	list, err := s.Scheduled.ListForSender(senderID)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]ScheduledMessageView, 0, len(list))
+	for i := range list {
+		views = append(views, *s.scheduledView(&list[i]))
+	}
+	return views, nil
+}
+
+// UpdateScheduled меняет текст и/или время отправки. Сообщение, которое не удалось
+// доставить, после редактирования снова ставится в очередь.
+func (s *MessageService) UpdateScheduled(id, senderID uint, upd ScheduledUpdate) (*ScheduledMessageView, error) {
+	s, span := s.trace("UpdateScheduled")
+	defer span.End()
+
+	if upd.Content == nil && upd.SendAt == nil {
+		return nil, ErrEmptyUpdate
+	}
+	if upd.SendAt != nil && !validSendAt(*upd.SendAt) {
+		return nil, ErrInvalidSendAt
+	}
+
+	sm, err := s.Scheduled.GetForSender(id, senderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrScheduledNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"status": models.ScheduledPending, "failure_reason": "", "attempts": 0}
+	if upd.Content != nil {
+		encrypted, err := s.encrypt(*upd.Content)
+		if err != nil {
+			return nil, err
+		}
+		updates["content"] = encrypted
+		updates["encrypted"] = true
+		sm.Content, sm.Encrypted = encrypted, true
+	}
+	if upd.SendAt != nil {
+		updates["send_at"] = *upd.SendAt
+		sm.SendAt = *upd.SendAt
+	}
+
+	updated, err := s.Scheduled.Update(sm, updates)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		// Сообщение только что доставлено или отменено
+		return nil, ErrScheduledNotFound
+	}
+	sm.Status, sm.FailureReason, sm.Attempts = models.ScheduledPending, "", 0
+	sm.Version++
+	sm.UpdatedAt = time.Now()
+	return s.scheduledView(sm), nil
+}
+
+// CancelScheduled отменяет отправку; зашифрованный текст удаляется вместе с записью
+func (s *MessageService) CancelScheduled(id, senderID uint) error {
+	s, span := s.trace("CancelScheduled")
+	defer span.End()
+
+	deleted, err := s.Scheduled.Delete(id, senderID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrScheduledNotFound
+	}
+	return nil
+}
+
+// DeliverScheduled превращает отложенное сообщение в обычное. Если доставка
+// невозможна по вине получателя или ссылок, запись помечается ошибочной;
+// прочие ошибки возвращаются, и доставка будет повторена.
+func (s *MessageService) DeliverScheduled(sm *models.ScheduledMessage) (bool, error) {
+	s, span := s.trace("DeliverScheduled")
+	defer span.End()
+
+	plainText := s.decrypt(sm.Content, sm.Encrypted)
+	msg, err := s.newMessage(sm.SenderID, sm.ReceiverID, plainText, SendOptions{
+		TTLSeconds:   sm.TTLSeconds,
+		TTLAfterRead: sm.TTLAfterRead,
+		ReplyToID:    sm.ReplyToID,
+		ThreadRootID: sm.ThreadRootID,
+
+		ClientMessageID: stringValue(sm.ClientMessageID),
+	})
+	if isPermanentSendError(err) {
+		_, updateErr := s.Scheduled.Update(sm, map[string]interface{}{
+			"status":         models.ScheduledFailed,
+			"failure_reason": err.Error(),
+		})
+		return false, updateErr
+	}
+	if err != nil {
+		return false, err
+	}
+	delivered, err := s.Scheduled.Deliver(sm, msg, s.Index.Tokens(plainText))
+	if delivered {
+		s.Metrics.MessageSent()
+		s.notify(msg, plainText)
+	}
+	return delivered, err
+}
+
+func (s *MessageService) checkScheduleReceiver(senderID, receiverID uint) error {
+	if senderID == receiverID {
+		return ErrSelfMessage
+	}
+	if _, err := s.Contacts.getUser(receiverID); err != nil {
+		return err
+	}
+	blocked, err := s.Contacts.Repo.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+
+func (s *MessageService) scheduledView(sm *models.ScheduledMessage) *ScheduledMessageView {
+	return &ScheduledMessageView{
+		ID:              sm.ID,
+		ClientMessageID: sm.ClientMessageID,
+		ReceiverID:      sm.ReceiverID,
+		Content:         s.decrypt(sm.Content, sm.Encrypted),
+		SendAt:          sm.SendAt,
+		TTLSeconds:      sm.TTLSeconds,
+		TTLAfterRead:    sm.TTLAfterRead,
+		ReplyToID:       sm.ReplyToID,
+		ThreadRootID:    sm.ThreadRootID,
+		Status:          sm.Status,
+		FailureReason:   sm.FailureReason,
+		CreatedAt:       sm.CreatedAt,
+		UpdatedAt:       sm.UpdatedAt,
+	}
+}
+
+func stringValue(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+func validSendAt(t time.Time) bool {
+	now := time.Now()
+	return t.After(now) && t.Before(now.Add(MaxScheduleAhead))
+}
+
+// isPermanentSendError — ошибки, которые не исчезнут при повторной попытке доставки
+func isPermanentSendError(err error) bool {
+	for _, target := range []error{
+		ErrSelfMessage, ErrUserNotFound, ErrBlocked, ErrMessageRequestDeclined,
+		ErrInvalidReference, ErrInvalidTTL,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
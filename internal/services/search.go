@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+
+	"secure-messenger/pkg/apperror"
+)
+
+var ErrEmptyQuery = apperror.New(apperror.KindInvalid, "empty_query", "empty search query")
+
+// SearchMessages ищет сообщения, содержащие все слова запроса, по слепому индексу
+func (s *MessageService) SearchMessages(userID uint, query string, peerID, beforeID uint, limit int) ([]MessageView, error) {
+	s, span := s.trace("SearchMessages")
+	defer span.End()
+
+	tokens := s.Index.Tokens(query)
+	if len(tokens) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	messages, err := s.Repo.SearchMessages(userID, tokens, peerID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildViews(userID, messages)
+}
+
+// RebuildSearchIndex пересчитывает токены всех сообщений, например после смены ключа индекса
+func (s *MessageService) RebuildSearchIndex(ctx context.Context, batchSize int) (int, error) {
+	var afterID uint
+	total := 0
+	for ctx.Err() == nil {
+		messages, err := s.Repo.ListForReindex(afterID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		for _, msg := range messages {
+			plainText := s.decrypt(msg.Content, msg.Encrypted)
+			if err := s.Repo.ReplaceSearchTokens(msg.ID, s.Index.Tokens(plainText)); err != nil {
+				return total, err
+			}
+			total++
+		}
+		afterID = messages[len(messages)-1].ID
+	}
+	return total, ctx.Err()
+}
@@ -7,16 +7,22 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 	"secure-messenger/internal/models"
+	"secure-messenger/pkg/apperror"
 	"time"
 )
 
+var ErrInvalidRefreshToken = apperror.New(apperror.KindUnauthorized, "invalid_refresh_token", "invalid or expired refresh token")
+
+// ErrRefreshTokenReused — токен уже обменял другой запрос
+var ErrRefreshTokenReused = apperror.New(apperror.KindUnauthorized, "refresh_token_reused", "refresh token already used")
+
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func GenerateRefreshToken(db *gorm.DB, userID uint) (string, error) {
+func generateRefreshToken(db *gorm.DB, userID uint, ttl time.Duration) (string, error) {
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
 		return "", err
@@ -26,7 +32,7 @@ func GenerateRefreshToken(db *gorm.DB, userID uint) (string, error) {
 	rt := models.RefreshToken{
 		UserID:    userID,
 		Token:     refreshToken,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		ExpiresAt: time.Now().Add(ttl),
 	}
 	if err := db.Create(&rt).Error; err != nil {
 		return "", err
@@ -36,11 +42,28 @@ func GenerateRefreshToken(db *gorm.DB, userID uint) (string, error) {
 
 func ValidateRefreshToken(db *gorm.DB, token string) (*models.RefreshToken, error) {
 	var rt models.RefreshToken
-	if err := db.Where("token = ?", token).First(&rt).Error; err != nil {
+	err := db.Where("token = ?", token).First(&rt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
 		return nil, err
 	}
 	if rt.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("refresh token expired")
+		return nil, ErrInvalidRefreshToken
 	}
 	return &rt, nil
 }
+
+// ConsumeRefreshToken удаляет обмениваемый refresh token. Если строку уже удалил
+// параллельный обмен тем же токеном, возвращает ErrRefreshTokenReused.
+func ConsumeRefreshToken(db *gorm.DB, rt *models.RefreshToken) error {
+	res := db.Where("id = ?", rt.ID).Delete(&models.RefreshToken{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("secure-messenger/internal/services")
+
+// WithContext возвращает копию сервиса, привязанную к ctx: спаны методов становятся
+// дочерними для спана запроса, а запросы к базе выполняются в этом контексте
+func (s *MessageService) WithContext(ctx context.Context) *MessageService {
+	c := *s
+	c.ctx = ctx
+	c.Repo = s.Repo.WithContext(ctx)
+	c.Users = s.Users.WithContext(ctx)
+	c.Conversations = s.Conversations.WithContext(ctx)
+	c.Attachments = s.Attachments.WithContext(ctx)
+	c.Contacts = s.Contacts.WithContext(ctx)
+	c.Scheduled = s.Scheduled.WithContext(ctx)
+	return &c
+}
+
+func (s *MessageService) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// trace открывает спан метода и возвращает копию сервиса, привязанную к нему
+func (s *MessageService) trace(method string) (*MessageService, trace.Span) {
+	ctx, span := tracer.Start(s.context(), "MessageService."+method)
+	return s.WithContext(ctx), span
+}
+
+// startChild открывает вложенный спан. Вне трассы возвращается пустой спан,
+// чтобы мелкие операции фоновых задач не становились отдельными трассами.
+func startChild(ctx context.Context, name string) trace.Span {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return trace.SpanFromContext(ctx)
+	}
+	_, span := tracer.Start(ctx, name)
+	return span
+}
+
+func (s *ContactService) WithContext(ctx context.Context) *ContactService {
+	return &ContactService{Repo: s.Repo.WithContext(ctx), Users: s.Users.WithContext(ctx)}
+}
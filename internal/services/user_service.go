@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"secure-messenger/internal/models"
+	"secure-messenger/internal/repository"
+	"secure-messenger/pkg/apperror"
+)
+
+// Ограничения полей публичного профиля (в символах)
+const (
+	MaxDisplayNameLength = 64
+	MaxBioLength         = 500
+	MaxStatusTextLength  = 140
+
+	minSearchPrefix = 2
+)
+
+var (
+	ErrInvalidProfile   = apperror.New(apperror.KindInvalid, "invalid_profile", "invalid profile")
+	ErrInvalidUserQuery = apperror.New(apperror.KindInvalid, "invalid_user_query", "invalid user search query")
+)
+
+// PublicProfile — то, что о пользователе видят остальные (без email и настроек)
+type PublicProfile struct {
+	ID          uint    `json:"id"`
+	Name        string  `json:"name"`
+	DisplayName string  `json:"display_name"`
+	Bio         string  `json:"bio"`
+	StatusText  string  `json:"status_text"`
+	AvatarID    *string `json:"avatar_id"`
+}
+
+// ProfileUpdate — изменяемые поля профиля; nil — не менять, пустой AvatarID — убрать аватар
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	StatusText  *string
+	AvatarID    *string
+}
+
+type UserService struct {
+	Users       *repository.UserRepository
+	Contacts    *repository.ContactRepository
+	Attachments *repository.AttachmentRepository
+}
+
+func NewUserService(
+	users *repository.UserRepository,
+	contacts *repository.ContactRepository,
+	attachments *repository.AttachmentRepository,
+) *UserService {
+	return &UserService{Users: users, Contacts: contacts, Attachments: attachments}
+}
+
+// Search ищет пользователей по точному email (если запрос похож на адрес)
+// или по началу имени
+func (s *UserService) Search(viewerID uint, query string, beforeID uint, limit int) ([]PublicProfile, error) {
+	query = strings.TrimSpace(query)
+	opts := repository.SearchOptions{ViewerID: viewerID, BeforeID: beforeID, Limit: limit}
+	if strings.Contains(query, "@") {
+		addr, err := mail.ParseAddress(query)
+		if err != nil || addr.Address != query {
+			return nil, ErrInvalidUserQuery
+		}
+		opts.Email = query
+	} else {
+		if utf8.RuneCountInString(query) < minSearchPrefix {
+			return nil, ErrInvalidUserQuery
+		}
+		opts.NamePrefix = query
+	}
+
+	users, err := s.Users.Search(opts)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]PublicProfile, 0, len(users))
+	for i := range users {
+		profiles = append(profiles, publicProfile(&users[i]))
+	}
+	return profiles, nil
+}
+
+// GetProfile возвращает публичный профиль; заблокировавший просматривающего выглядит несуществующим
+func (s *UserService) GetProfile(viewerID, userID uint) (*PublicProfile, error) {
+	user, err := s.Users.GetByID(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if viewerID != userID {
+		blocked, err := s.Contacts.IsBlocked(userID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, ErrUserNotFound
+		}
+	}
+
+	profile := publicProfile(user)
+	return &profile, nil
+}
+
+func (s *UserService) UpdateProfile(userID uint, upd ProfileUpdate) (*PublicProfile, error) {
+	updates := map[string]interface{}{}
+	for _, f := range []struct {
+		column string
+		value  *string
+		max    int
+	}{
+		{"display_name", upd.DisplayName, MaxDisplayNameLength},
+		{"bio", upd.Bio, MaxBioLength},
+		{"status_text", upd.StatusText, MaxStatusTextLength},
+	} {
+		if f.value == nil {
+			continue
+		}
+		v := strings.TrimSpace(*f.value)
+		if !utf8.ValidString(v) || utf8.RuneCountInString(v) > f.max {
+			return nil, ErrInvalidProfile
+		}
+		updates[f.column] = v
+	}
+
+	if upd.AvatarID != nil {
+		if *upd.AvatarID == "" {
+			updates["avatar_id"] = nil
+		} else {
+			if err := s.checkAvatar(userID, *upd.AvatarID); err != nil {
+				return nil, err
+			}
+			updates["avatar_id"] = *upd.AvatarID
+		}
+	}
+	if len(updates) == 0 {
+		return nil, ErrInvalidProfile
+	}
+
+	if err := s.Users.UpdateProfile(userID, updates); err != nil {
+		return nil, err
+	}
+	return s.GetProfile(userID, userID)
+}
+
+// checkAvatar — аватаром может быть только полностью загруженное владельцем
+// изображение, не отправленное в сообщении
+func (s *UserService) checkAvatar(userID uint, attachmentID string) error {
+	a, err := s.Attachments.GetByID(attachmentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidAttachment
+	}
+	if err != nil {
+		return err
+	}
+	if a.OwnerID != userID || a.Status != models.AttachmentComplete || a.MessageID != nil ||
+		!strings.HasPrefix(a.MimeType, "image/") {
+		return ErrInvalidAttachment
+	}
+	return nil
+}
+
+func publicProfile(u *models.User) PublicProfile {
+	return PublicProfile{
+		ID:          u.ID,
+		Name:        u.Name,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		StatusText:  u.StatusText,
+		AvatarID:    u.AvatarID,
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// periodic выполняет задачу сразу после запуска и затем с заданным интервалом,
+// пока не будет отменён контекст
+type periodic struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (p *periodic) start(ctx context.Context, name string, interval time.Duration, task func(context.Context) error) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := task(ctx); err != nil {
+				slog.ErrorContext(ctx, "worker task failed", "worker", name, "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Running — запущена ли задача и не завершилась ли она
+func (p *periodic) Running() bool {
+	if p.done == nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stop отменяет фоновую задачу и ждёт её завершения, но не дольше ctx
+func (p *periodic) Stop(ctx context.Context) error {
+	if p.done == nil {
+		return nil
+	}
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
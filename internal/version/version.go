@@ -0,0 +1,49 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Задаются при сборке:
+//
+//	go build -ldflags "-X secure-messenger/internal/version.Version=v1.2.0 -X secure-messenger/internal/version.Commit=$(git rev-parse HEAD)"
+//
+// Если Commit не задан, берётся ревизия, которую go build встраивает сам.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // собрано из рабочей копии с незакоммиченными изменениями
+	GoVersion string `json:"go_version"`
+}
+
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
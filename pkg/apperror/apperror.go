@@ -0,0 +1,155 @@
+package apperror
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// Kind — класс ошибки, по нему выбирается HTTP-статус ответа
+type Kind uint8
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindGone
+	KindTooLarge
+	KindUnsupported
+	KindUnavailable
+)
+
+var kindStatus = map[Kind]int{
+	KindInternal:     http.StatusInternalServerError,
+	KindInvalid:      http.StatusBadRequest,
+	KindUnauthorized: http.StatusUnauthorized,
+	KindForbidden:    http.StatusForbidden,
+	KindNotFound:     http.StatusNotFound,
+	KindConflict:     http.StatusConflict,
+	KindGone:         http.StatusGone,
+	KindTooLarge:     http.StatusRequestEntityTooLarge,
+	KindUnsupported:  http.StatusUnsupportedMediaType,
+	KindUnavailable:  http.StatusServiceUnavailable,
+}
+
+func (k Kind) Status() int {
+	if status, ok := kindStatus[k]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// FieldError — ошибка проверки одного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`            // правило проверки: required, email, min_length, type...
+	Param   string `json:"param,omitempty"` // параметр правила: минимальная длина, допустимые значения...
+	Message string `json:"message"`
+}
+
+// Error — ошибка с кодом, на который клиенты могут опираться. Code стабилен
+// между версиями, Message — только для человека.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+
+	cause error
+	class bool
+}
+
+// codes — все объявленные коды; по ним проверяется полнота каталогов переводов
+var codes = map[string]bool{}
+
+// New объявляет ошибку с кодом. Вызывается при инициализации пакета (var ErrX = apperror.New(...)).
+func New(kind Kind, code, message string) *Error {
+	codes[code] = true
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func newClass(kind Kind, code, message string) *Error {
+	e := New(kind, code, message)
+	e.class = true
+	return e
+}
+
+// Codes возвращает отсортированный список объявленных кодов
+func Codes() []string {
+	list := make([]string, 0, len(codes))
+	for code := range codes {
+		list = append(list, code)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Общие ошибки. Сравнение с классом (ErrNotFound, ErrForbidden...) через errors.Is
+// срабатывает для любой ошибки того же Kind, например services.ErrMessageNotFound.
+var (
+	ErrInternal     = newClass(KindInternal, "internal_error", "internal server error")
+	ErrInvalid      = newClass(KindInvalid, "invalid_request", "invalid request")
+	ErrUnauthorized = newClass(KindUnauthorized, "unauthorized", "unauthorized")
+	ErrForbidden    = newClass(KindForbidden, "forbidden", "forbidden")
+	ErrNotFound     = newClass(KindNotFound, "not_found", "not found")
+	ErrConflict     = newClass(KindConflict, "conflict", "conflict")
+	ErrUnavailable  = newClass(KindUnavailable, "unavailable", "service unavailable")
+
+	// ErrValidation — тело или параметры запроса не прошли проверку; подробности в Fields
+	ErrValidation = New(KindInvalid, "validation_failed", "request validation failed")
+)
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is сравнивает по коду, поэтому копии из Wrap и WithFields остаются равны исходной ошибке
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.class {
+		return t.Kind == e.Kind
+	}
+	return t.Code == e.Code
+}
+
+func (e *Error) Status() int {
+	return e.Kind.Status()
+}
+
+// Wrap возвращает копию ошибки с причиной. Причина попадает в логи, но не в ответ клиенту.
+func (e *Error) Wrap(cause error) *Error {
+	c := *e
+	c.cause = cause
+	c.class = false
+	return &c
+}
+
+// WithFields возвращает копию ошибки с подробностями по полям
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	c := *e
+	c.Fields = append(append([]FieldError(nil), e.Fields...), fields...)
+	c.class = false
+	return &c
+}
+
+// From достаёт *Error из цепочки err. Остальные ошибки считаются внутренними.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrInternal.Wrap(err)
+}
@@ -0,0 +1,60 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// minWordLength — более короткие слова не индексируются и не ищутся
+const minWordLength = 2
+
+// DeriveKey получает из главного ключа отдельный ключ для указанной цели
+func DeriveKey(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// BlindIndex превращает слова в ключевые HMAC-токены: по токену можно найти
+// сообщение с этим словом, но нельзя восстановить само слово без ключа
+type BlindIndex struct {
+	key []byte
+}
+
+func NewBlindIndex(key []byte) *BlindIndex {
+	return &BlindIndex{key: key}
+}
+
+// Tokens возвращает уникальные токены нормализованных слов текста
+func (b *BlindIndex) Tokens(text string) []string {
+	words := NormalizeWords(text)
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		mac := hmac.New(sha256.New, b.key)
+		mac.Write([]byte(word))
+		tokens = append(tokens, hex.EncodeToString(mac.Sum(nil)[:16]))
+	}
+	return tokens
+}
+
+// NormalizeWords разбивает текст на слова в нижнем регистре без повторов
+func NormalizeWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(fields))
+	words := make([]string, 0, len(fields))
+	for _, word := range fields {
+		word = strings.ReplaceAll(word, "ё", "е")
+		if len([]rune(word)) < minWordLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words
+}
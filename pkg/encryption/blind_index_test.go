@@ -0,0 +1,55 @@
+package encryption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriveKey(t *testing.T) {
+	master := []byte("0123456789abcdef")
+
+	key := DeriveKey(master, "search")
+	assert.Len(t, key, 32)
+	assert.Equal(t, key, DeriveKey(master, "search"))
+	assert.NotEqual(t, key, DeriveKey(master, "attachments"))
+	assert.NotEqual(t, key, DeriveKey([]byte("fedcba9876543210"), "search"))
+	assert.NotEqual(t, master, key[:len(master)])
+}
+
+func TestNormalizeWords(t *testing.T) {
+	cases := map[string][]string{
+		"Hello, hello WORLD!":       {"hello", "world"},
+		"Ёлка и елка — одно слово":  {"елка", "одно", "слово"},
+		"a b c v2 42 x-ray":         {"v2", "42", "ray"},
+		"e-mail: bob@example.com":   {"mail", "bob", "example", "com"},
+		"  \t\n ... ":               {},
+		"Привет, мир; привет, МИР!": {"привет", "мир"},
+	}
+	for text, want := range cases {
+		assert.Equal(t, want, NormalizeWords(text), text)
+	}
+}
+
+func TestBlindIndexTokens(t *testing.T) {
+	index := NewBlindIndex(DeriveKey([]byte("0123456789abcdef"), "search"))
+
+	// Повторы и однобуквенные слова не дают токенов
+	tokens := index.Tokens("Meet me at the Station, station, I said!")
+	assert.Len(t, tokens, 6)
+	for _, token := range tokens {
+		assert.Len(t, token, 32)
+	}
+
+	// Один и тот же текст даёт те же токены, регистр и пунктуация не важны
+	assert.Equal(t, tokens, index.Tokens("meet ME at the station, said"))
+	assert.Equal(t, index.Tokens("station"), index.Tokens("STATION."))
+	assert.Contains(t, tokens, index.Tokens("station")[0])
+
+	// Токены не раскрывают слово и зависят от ключа
+	assert.NotContains(t, tokens, "station")
+	other := NewBlindIndex(DeriveKey([]byte("0123456789abcdef"), "other"))
+	assert.NotEqual(t, index.Tokens("station"), other.Tokens("station"))
+
+	assert.Empty(t, index.Tokens("a ! ?"))
+}
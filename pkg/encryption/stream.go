@@ -0,0 +1,73 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+)
+
+// FileKeySize — длина случайного ключа для шифрования одного файла (AES-256)
+const FileKeySize = 32
+
+var ErrChunkAuth = errors.New("chunk authentication failed")
+
+// NewFileKey генерирует случайный ключ для отдельного файла
+func NewFileKey() ([]byte, error) {
+	key := make([]byte, FileKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// SealChunk шифрует фрагмент файла AES-GCM со случайным nonce, который записывается
+// перед шифротекстом. Номер фрагмента и признак последнего фрагмента входят в
+// дополнительные данные, поэтому фрагменты нельзя переставить, подменить или отрезать хвост.
+// Nonce случайный, а не производный от номера: повторная загрузка того же фрагмента
+// с другим содержимым не шифрует два текста одной парой ключ/nonce.
+func SealChunk(key []byte, index uint32, last bool, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, chunkAAD(index, last)), nil
+}
+
+func OpenChunk(key []byte, index uint32, last bool, sealed []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrChunkAuth
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, chunkAAD(index, last))
+	if err != nil {
+		return nil, ErrChunkAuth
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkAAD(index uint32, last bool) []byte {
+	aad := make([]byte, 5)
+	binary.BigEndian.PutUint32(aad, index)
+	if last {
+		aad[4] = 1
+	}
+	return aad
+}
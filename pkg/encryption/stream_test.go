@@ -0,0 +1,65 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	key, err := NewFileKey()
+	require.NoError(t, err)
+	assert.Len(t, key, FileKeySize)
+
+	for _, plaintext := range [][]byte{[]byte("first chunk"), {}} {
+		sealed, err := SealChunk(key, 3, true, plaintext)
+		require.NoError(t, err)
+
+		opened, err := OpenChunk(key, 3, true, sealed)
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(plaintext, opened))
+	}
+}
+
+func TestChunkNonceIsRandom(t *testing.T) {
+	key, err := NewFileKey()
+	require.NoError(t, err)
+
+	// Повторная загрузка того же фрагмента не должна повторять nonce
+	a, err := SealChunk(key, 0, false, []byte("same index"))
+	require.NoError(t, err)
+	b, err := SealChunk(key, 0, false, []byte("same index"))
+	require.NoError(t, err)
+	assert.NotEqual(t, a[:12], b[:12])
+	assert.NotEqual(t, a, b)
+}
+
+func TestChunkTamper(t *testing.T) {
+	key, err := NewFileKey()
+	require.NoError(t, err)
+	sealed, err := SealChunk(key, 1, false, []byte("payload"))
+	require.NoError(t, err)
+
+	otherKey, err := NewFileKey()
+	require.NoError(t, err)
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	badNonce := append([]byte(nil), sealed...)
+	badNonce[0] ^= 1
+
+	cases := map[string]func() ([]byte, error){
+		"wrong index":     func() ([]byte, error) { return OpenChunk(key, 2, false, sealed) },
+		"truncated tail":  func() ([]byte, error) { return OpenChunk(key, 1, true, sealed) },
+		"flipped bit":     func() ([]byte, error) { return OpenChunk(key, 1, false, flipped) },
+		"modified nonce":  func() ([]byte, error) { return OpenChunk(key, 1, false, badNonce) },
+		"wrong key":       func() ([]byte, error) { return OpenChunk(otherKey, 1, false, sealed) },
+		"shorter than iv": func() ([]byte, error) { return OpenChunk(key, 1, false, sealed[:5]) },
+	}
+	for name, open := range cases {
+		_, err := open()
+		assert.ErrorIs(t, err, ErrChunkAuth, name)
+	}
+}
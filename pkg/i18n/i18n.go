@@ -0,0 +1,100 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	English = "en"
+	Russian = "ru"
+
+	// Default — язык, если клиент не выбрал поддерживаемый; в его каталоге есть все ключи
+	Default = English
+)
+
+// Каталоги: locales/<язык>.json, ключ — "error.<код ошибки>", "title.<HTTP-статус>",
+// "validation.<правило>" или "message.<системное сообщение>"
+//
+//go:embed locales/*.json
+var files embed.FS
+
+// languages — поставляемые каталоги; порядок совпадает с тегами matcher, первый — Default
+var languages = []string{English, Russian}
+
+var (
+	catalogs = map[string]map[string]string{}
+	matcher  language.Matcher
+)
+
+func init() {
+	tags := make([]language.Tag, 0, len(languages))
+	for _, lang := range languages {
+		data, err := files.ReadFile("locales/" + lang + ".json")
+		if err != nil {
+			panic(err)
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Errorf("i18n: catalog %s: %w", lang, err))
+		}
+		catalogs[lang] = catalog
+		tags = append(tags, language.MustParse(lang))
+	}
+	matcher = language.NewMatcher(tags)
+}
+
+// Languages возвращает поставляемые языки; первым идёт Default
+func Languages() []string {
+	return append([]string(nil), languages...)
+}
+
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Keys возвращает все ключи каталога lang
+func Keys(lang string) []string {
+	keys := make([]string, 0, len(catalogs[lang]))
+	for key := range catalogs[lang] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Match выбирает язык по заголовку Accept-Language (ru-RU → ru); без совпадений — Default
+func Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+	return languages[index]
+}
+
+// Lookup ищет перевод только в каталоге lang, без подстановки английского
+func Lookup(lang, key string) (string, bool) {
+	text, ok := catalogs[lang][key]
+	return text, ok
+}
+
+// T возвращает текст key на языке lang; если перевода нет — из каталога Default,
+// если нет и там — fallback. Плейсхолдер {param} заменяется на param.
+func T(lang, key, fallback, param string) string {
+	text, ok := Lookup(lang, key)
+	if !ok {
+		text, ok = Lookup(Default, key)
+	}
+	if !ok {
+		return fallback
+	}
+	return strings.ReplaceAll(text, "{param}", param)
+}
@@ -0,0 +1,80 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"secure-messenger/pkg/apperror"
+)
+
+func TestCatalogsComplete(t *testing.T) {
+	reference := Keys(Default)
+	sort.Strings(reference)
+	assert.NotEmpty(t, reference)
+
+	for _, lang := range Languages() {
+		assert.True(t, Supported(lang), lang)
+		// Общие коды apperror и заголовки всех статусов переведены; коды сервисов
+		// проверяет TestErrorCodesTranslated в handlers, где они все объявлены
+		for _, code := range apperror.Codes() {
+			_, ok := Lookup(lang, "error."+code)
+			assert.True(t, ok, "%s: error.%s", lang, code)
+		}
+		for kind := apperror.KindInternal; kind <= apperror.KindUnavailable; kind++ {
+			_, ok := Lookup(lang, fmt.Sprintf("title.%d", kind.Status()))
+			assert.True(t, ok, "%s: title.%d", lang, kind.Status())
+		}
+		// Каталоги не расходятся: ни лишних, ни пропущенных ключей
+		keys := Keys(lang)
+		sort.Strings(keys)
+		assert.Equal(t, reference, keys, lang)
+		for _, key := range keys {
+			text, _ := Lookup(lang, key)
+			assert.NotEmpty(t, strings.TrimSpace(text), "%s: %s", lang, key)
+			// Плейсхолдер не теряется в переводе
+			original, _ := Lookup(Default, key)
+			assert.Equal(t, strings.Contains(original, "{param}"), strings.Contains(text, "{param}"), "%s: %s", lang, key)
+		}
+	}
+	assert.Equal(t, Default, Languages()[0])
+	assert.False(t, Supported("de"))
+}
+
+func TestMatch(t *testing.T) {
+	cases := map[string]string{
+		"ru":                       Russian,
+		"ru-RU,ru;q=0.9":           Russian,
+		"de-DE,ru;q=0.5":           Russian,
+		"en-GB":                    English,
+		"ru;q=0.3,en;q=0.8":        English,
+		"de, fr;q=0.8":             Default,
+		"":                         Default,
+		"not a ;; language header": Default,
+	}
+	for header, want := range cases {
+		assert.Equal(t, want, Match(header), header)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	text, ok := Lookup(Russian, "error.not_found")
+	assert.True(t, ok)
+	assert.Equal(t, "не найдено", text)
+	_, ok = Lookup(Russian, "error.no_such_code")
+	assert.False(t, ok)
+	_, ok = Lookup("de", "error.not_found")
+	assert.False(t, ok)
+
+	assert.Equal(t, "не найдено", T(Russian, "error.not_found", "fallback", ""))
+	assert.Equal(t, "must be at most 5", T(English, "validation.max", "fallback", "5"))
+	assert.NotContains(t, T(Russian, "validation.max", "fallback", "5"), "{param}")
+	assert.Contains(t, T(Russian, "validation.max", "fallback", "5"), "5")
+
+	// Неизвестный язык — текст из Default, неизвестный ключ — fallback
+	assert.Equal(t, "not found", T("de", "error.not_found", "fallback", ""))
+	assert.Equal(t, "fallback", T(Russian, "error.no_such_code", "fallback", ""))
+}
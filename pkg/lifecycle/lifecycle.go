@@ -0,0 +1,137 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Worker — фоновая задача: Start запускает её, Stop отменяет и ждёт завершения
+type Worker interface {
+	Start(ctx context.Context)
+	Stop(ctx context.Context) error
+}
+
+type component struct {
+	name  string
+	start func(context.Context) error
+	stop  func(context.Context) error
+}
+
+// Manager запускает компоненты в порядке добавления и останавливает в обратном,
+// давая каждому не больше StopTimeout
+type Manager struct {
+	StopTimeout time.Duration
+
+	components []component
+	started    int
+}
+
+func NewManager(stopTimeout time.Duration) *Manager {
+	return &Manager{StopTimeout: stopTimeout}
+}
+
+// Add регистрирует компонент; start или stop могут быть nil
+func (m *Manager) Add(name string, start, stop func(context.Context) error) {
+	m.components = append(m.components, component{name: name, start: start, stop: stop})
+}
+
+func (m *Manager) AddWorker(name string, w Worker) {
+	m.Add(name, func(ctx context.Context) error {
+		w.Start(ctx)
+		return nil
+	}, w.Stop)
+}
+
+// AddHTTPServer открывает порт уже при запуске, чтобы ошибка вроде занятого порта
+// остановила старт, а при остановке дожидается завершения активных запросов.
+// fail вызывается, если сервер упал во время работы.
+func (m *Manager) AddHTTPServer(name string, srv *http.Server, fail func(error)) {
+	m.Add(name, func(ctx context.Context) error {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			return err
+		}
+		srv.Addr = ln.Addr().String() // фактический адрес, если порт был выбран системой
+		slog.Info("listening", "component", name, "addr", srv.Addr)
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fail(err)
+			}
+		}()
+		return nil
+	}, func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close() // не дождались — обрываем оставшиеся соединения
+			return err
+		}
+		return nil
+	})
+}
+
+// Start запускает компоненты по порядку. ctx живёт, пока работают компоненты.
+// Если компонент не запустился, уже запущенные останавливаются.
+func (m *Manager) Start(ctx context.Context) error {
+	for _, c := range m.components {
+		if c.start != nil {
+			if err := c.start(ctx); err != nil {
+				err = fmt.Errorf("%s: %w", c.name, err)
+				if stopErr := m.Stop(context.Background()); stopErr != nil {
+					err = errors.Join(err, stopErr)
+				}
+				return err
+			}
+		}
+		m.started++
+	}
+	return nil
+}
+
+// Stop останавливает запущенные компоненты в обратном порядке и собирает все ошибки
+func (m *Manager) Stop(ctx context.Context) error {
+	var errs []error
+	for ; m.started > 0; m.started-- {
+		c := m.components[m.started-1]
+		if c.stop == nil {
+			continue
+		}
+		if err := m.stopOne(ctx, c); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		slog.Info("stopped", "component", c.name)
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) stopOne(ctx context.Context, c component) error {
+	if m.StopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.StopTimeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.stop(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("stop timed out: %w", ctx.Err())
+	}
+}
+
+// Run запускает компоненты, ждёт отмены ctx (например, по SIGTERM) и останавливает их
+func (m *Manager) Run(ctx context.Context) error {
+	// компоненты живут дольше ctx: их останавливает Stop по очереди, а не общая отмена
+	if err := m.Start(context.WithoutCancel(ctx)); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	slog.Info("shutting down")
+	return m.Stop(context.Background())
+}
@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingWorker запоминает, когда его остановили
+type recordingWorker struct {
+	name    string
+	stopped *[]string
+	mu      *sync.Mutex
+	started bool
+}
+
+func (w *recordingWorker) Start(ctx context.Context) { w.started = true }
+
+func (w *recordingWorker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	*w.stopped = append(*w.stopped, w.name)
+	return nil
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	// closing закрывается компонентом, остановленным раньше сервера, — как поток событий
+	closing := make(chan struct{})
+	streaming := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		io.WriteString(w, "done")
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		close(streaming)
+		<-closing
+	})
+
+	var mu sync.Mutex
+	var stopped []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, name)
+			return nil
+		}
+	}
+
+	app := NewManager(5 * time.Second)
+	app.Add("database", nil, record("database"))
+	worker := &recordingWorker{name: "worker", stopped: &stopped, mu: &mu}
+	app.AddWorker("worker", worker)
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: mux}
+	app.AddHTTPServer("http server", srv, func(err error) { t.Errorf("server failed: %v", err) })
+	app.Add("realtime hub", nil, func(ctx context.Context) error {
+		close(closing)
+		return record("realtime hub")(ctx)
+	})
+	assert.NoError(t, app.Start(context.Background()))
+	assert.True(t, worker.started)
+
+	// Открытый поток событий и незавершённый запрос
+	stream, err := http.Get("http://" + srv.Addr + "/events")
+	assert.NoError(t, err)
+	defer stream.Body.Close()
+	<-streaming
+
+	slow := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + srv.Addr + "/slow")
+		assert.NoError(t, err)
+		slow <- resp
+	}()
+	<-entered
+
+	stopErr := make(chan error, 1)
+	go func() { stopErr <- app.Stop(context.Background()) }()
+
+	// Сервер ждёт активный запрос, а поток событий уже закрыт
+	select {
+	case err := <-stopErr:
+		t.Fatalf("stopped before in-flight request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = io.ReadAll(stream.Body)
+	assert.NoError(t, err)
+
+	close(release)
+	resp := <-slow
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "done", string(body))
+
+	assert.NoError(t, <-stopErr)
+	assert.Equal(t, []string{"realtime hub", "worker", "database"}, stopped)
+
+	// Новые соединения больше не принимаются
+	_, err = http.Get("http://" + srv.Addr + "/slow")
+	assert.Error(t, err)
+}
+
+func TestLifecycleFailures(t *testing.T) {
+	// Порт занят — запуск прерывается, уже запущенное останавливается
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer busy.Close()
+
+	var stopped []string
+	app := NewManager(time.Second)
+	app.Add("database", nil, func(context.Context) error {
+		stopped = append(stopped, "database")
+		return nil
+	})
+	app.AddHTTPServer("http server", &http.Server{Addr: busy.Addr().String()}, func(error) {})
+	err = app.Start(context.Background())
+	assert.ErrorContains(t, err, "http server")
+	assert.Equal(t, []string{"database"}, stopped)
+
+	// Компонент, не уложившийся в срок, не задерживает остальных
+	stopped = nil
+	app = NewManager(50 * time.Millisecond)
+	app.Add("database", nil, func(context.Context) error {
+		stopped = append(stopped, "database")
+		return nil
+	})
+	stuck := make(chan struct{})
+	defer close(stuck)
+	app.Add("stuck", nil, func(context.Context) error {
+		<-stuck // не завершается до конца теста
+		return nil
+	})
+	assert.NoError(t, app.Start(context.Background()))
+	err = app.Stop(context.Background())
+	assert.ErrorContains(t, err, "stuck: stop timed out")
+	assert.Equal(t, []string{"database"}, stopped)
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLogger направляет журнал gorm в slog: ошибки и медленные запросы, а при уровне
+// Info — все запросы на уровне debug. Значения параметров не пишутся никогда:
+// в них пароли, токены и содержимое сообщений.
+type GormLogger struct {
+	SlowThreshold time.Duration
+	Level         gormlogger.LogLevel
+}
+
+func NewGormLogger() *GormLogger {
+	return &GormLogger{SlowThreshold: 200 * time.Millisecond, Level: gormlogger.Warn}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	c := *l
+	c.Level = level
+	return &c
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.Level >= gormlogger.Info {
+		slog.InfoContext(ctx, "gorm: "+fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.Level >= gormlogger.Warn {
+		slog.WarnContext(ctx, "gorm: "+fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.Level >= gormlogger.Error {
+		slog.ErrorContext(ctx, "gorm: "+fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.Level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	attrs := func() []any {
+		sql, rows := fc()
+		return []any{"sql", sql, "rows", rows, "duration_ms", float64(elapsed.Microseconds()) / 1000}
+	}
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.Level >= gormlogger.Error:
+		slog.ErrorContext(ctx, "database query failed", append(attrs(), "error", err)...)
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold && l.Level >= gormlogger.Warn:
+		slog.WarnContext(ctx, "slow database query", attrs()...)
+	case l.Level >= gormlogger.Info:
+		slog.DebugContext(ctx, "database query", attrs()...)
+	}
+}
+
+// ParamsFilter убирает значения параметров из текста запроса
+func (l *GormLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	// Redacted заменяет значения секретных атрибутов
+	Redacted = "[REDACTED]"
+)
+
+// New создаёт логгер, который скрывает секреты и дописывает к каждой записи
+// данные запроса из контекста (см. WithRequest)
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q: use debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+
+	var handler slog.Handler
+	switch format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("log format %q: use json or text", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Ключи, значения которых никогда не попадают в лог: токены, пароли, ключи и текст сообщений
+var (
+	sensitiveKeys  = map[string]bool{"content": true, "plaintext": true, "plain_text": true, "body": true, "dsn": true}
+	sensitiveParts = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "api_key", "apikey", "jwt"}
+)
+
+// IsSensitive сообщает, скрывается ли значение атрибута с таким ключом
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, part := range sensitiveParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Токены в произвольном тексте (сообщения стандартного log, тексты ошибок)
+var tokenPattern = regexp.MustCompile(`(?i)bearer\s+[\w\-.~+/=]+|eyJ[\w-]+\.[\w-]+\.[\w-]+`)
+
+// Scrub заменяет токены, найденные в тексте
+func Scrub(s string) string {
+	return tokenPattern.ReplaceAllString(s, Redacted)
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	switch {
+	case a.Value.Kind() == slog.KindGroup:
+	case IsSensitive(a.Key):
+		return slog.String(a.Key, Redacted)
+	case a.Value.Kind() == slog.KindString:
+		return slog.String(a.Key, Scrub(a.Value.String()))
+	case a.Value.Kind() == slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error()))
+		}
+	}
+	return a
+}
+
+// RequestInfo — данные запроса, которые попадают в каждую запись лога.
+// UserID заполняется после проверки токена.
+type RequestInfo struct {
+	ID     string
+	Route  string
+	UserID uint
+}
+
+type requestKey struct{}
+
+func WithRequest(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestKey{}, info)
+}
+
+// RequestFrom возвращает данные запроса из контекста или nil
+func RequestFrom(ctx context.Context) *RequestInfo {
+	if ctx == nil {
+		return nil
+	}
+	info, _ := ctx.Value(requestKey{}).(*RequestInfo)
+	return info
+}
+
+// SetUserID запоминает авторизованного пользователя для записей этого запроса
+func SetUserID(ctx context.Context, userID uint) {
+	if info := RequestFrom(ctx); info != nil {
+		info.UserID = userID
+	}
+}
+
+// NewRequestID генерирует идентификатор для запроса без X-Request-ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand не возвращает ошибок на поддерживаемых платформах
+	}
+	return hex.EncodeToString(b)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = Scrub(r.Message)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if info := RequestFrom(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.ID))
+		if info.Route != "" {
+			r.AddAttrs(slog.String("route", info.Route))
+		}
+		if info.UserID != 0 {
+			r.AddAttrs(slog.Uint64("user_id", uint64(info.UserID)))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,38 @@
+package push
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryProvider запоминает отправленные уведомления вместо настоящей доставки;
+// используется в тестах. Fail, если задан, решает, какую ошибку вернуть.
+type MemoryProvider struct {
+	Fail func(Notification) error
+
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{}
+}
+
+func (p *MemoryProvider) Send(_ context.Context, n Notification) error {
+	if p.Fail != nil {
+		if err := p.Fail(n); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	p.sent = append(p.sent, n)
+	p.mu.Unlock()
+	return nil
+}
+
+// Sent возвращает копию доставленных уведомлений
+func (p *MemoryProvider) Sent() []Notification {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Notification(nil), p.sent...)
+}
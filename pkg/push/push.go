@@ -0,0 +1,22 @@
+package push
+
+import (
+	"errors"
+)
+
+var (
+	// ErrInvalidToken — провайдер больше не принимает токен устройства; его нужно забыть
+	ErrInvalidToken = errors.New("device token is no longer valid")
+	// ErrRejected — провайдер отклонил уведомление, повтор не поможет
+	ErrRejected = errors.New("notification rejected")
+)
+
+// Notification — уведомление для одного устройства. Тексты пустые, если пользователь
+// не разрешил показывать содержимое сообщений: клиент сам загрузит сообщение по Data.
+type Notification struct {
+	Platform string            `json:"platform"`
+	Token    string            `json:"token"`
+	Title    string            `json:"title,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+}
@@ -0,0 +1,69 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookProvider передаёт уведомления внешнему шлюзу (APNs/FCM и т.п.) POST-запросом
+// с JSON-телом Notification. Если задан Secret, тело подписывается HMAC-SHA256
+// в заголовке X-Push-Signature.
+//
+// Ответ 404 или 410 означает, что токен устройства недействителен; прочие 4xx —
+// что уведомление отклонено; 5xx и сетевые ошибки можно повторить.
+type WebhookProvider struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+}
+
+func NewWebhookProvider(url string, secret []byte) *WebhookProvider {
+	return &WebhookProvider{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *WebhookProvider) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(p.Secret) > 0 {
+		mac := hmac.New(sha256.New, p.Secret)
+		mac.Write(body)
+		req.Header.Set("X-Push-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrInvalidToken
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d", ErrRejected, resp.StatusCode)
+	default:
+		return fmt.Errorf("push webhook: status %d", resp.StatusCode)
+	}
+}
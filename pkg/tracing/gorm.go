@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// GormPlugin оборачивает запросы gorm в спаны. Спан создаётся только внутри уже
+// начатой трассы (db.WithContext с контекстом запроса), поэтому опрос базы
+// фоновыми задачами не порождает отдельных трасс. В спан попадает текст
+// запроса с плейсхолдерами, без значений параметров.
+type GormPlugin struct {
+	system string
+}
+
+// NewGormPlugin — system: имя СУБД для атрибута db.system.name (postgres, sqlite)
+func NewGormPlugin(system string) *GormPlugin {
+	return &GormPlugin{system: system}
+}
+
+func (p *GormPlugin) Name() string {
+	return "tracing"
+}
+
+type statementSpan struct {
+	span   trace.Span
+	parent context.Context
+	ended  bool // та же запись могла остаться от предыдущей операции над этим Statement
+}
+
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", p.before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", p.after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", p.before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", p.after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", p.before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", p.after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", p.before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", p.after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", p.before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", p.after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", p.before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", p.after),
+	)
+}
+
+func (p *GormPlugin) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		parent := db.Statement.Context
+		if parent == nil || !trace.SpanContextFromContext(parent).IsValid() {
+			return
+		}
+		ctx, span := otel.Tracer("secure-messenger/pkg/tracing").Start(parent, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system.name", p.system),
+				attribute.String("db.operation.name", operation),
+			),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, &statementSpan{span: span, parent: parent})
+	}
+}
+
+func (p *GormPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	s := value.(*statementSpan)
+	if s.ended {
+		return
+	}
+	s.ended = true
+	db.Statement.Context = s.parent
+
+	s.span.SetAttributes(
+		attribute.String("db.collection.name", db.Statement.Table),
+		attribute.String("db.query.text", db.Statement.SQL.String()),
+		attribute.Int64("db.response.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		s.span.RecordError(db.Error)
+		s.span.SetStatus(codes.Error, db.Error.Error())
+	}
+	s.span.End()
+}